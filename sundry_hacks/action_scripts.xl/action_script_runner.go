@@ -0,0 +1,246 @@
+package main
+
+/*
+.SYNOPSIS
+One binary for all the action scripts on an action script server, and the action_scripts_manifest.json that points Turbo at it.
+
+.DESCRIPTION
+Does what the bash scripts in this directory (pre/replace/post for RIGHT_SIZE and MOVE, and slack.sh) do, from a declarative config:
+- "action_script_runner manifest" writes action_scripts_manifest.json with a script for each phase of each entry in the config
+  and, with -link, creates the scripts it names as links to this binary.
+- When Turbo runs one of those scripts over SSH, this binary sees which script it was run as, reads the action Turbo passes
+  as JSON on stdin and hands it to the script's handlers: audit (a line in a local file) and/or slack (a Slack webhook message).
+For REPLACE scripts Turbo takes the exit status as the result of the action, so, like the bash scripts, nothing is done
+to the entity itself. A non-zero exit from a PRE script stops the action and from a REPLACE script fails it, so the exit status
+is only not 0 if the config can't be read, the script isn't in it or there's no action on stdin. Handler errors (e.g. Slack
+being down) are written to stderr and don't stop the action, as with the bash scripts and slack.sh.
+
+.EXAMPLE
+action_script_runner manifest -config runner_config.json -link
+Writes action_scripts_manifest.json next to runner_config.json and links pre_resize_vm, replace_resize_vm, etc. to the runner.
+
+action_script_runner run -config runner_config.json -script pre_resize_vm < testdata/payloads/right_size_vm.json
+Runs the pre_resize_vm script by hand with a recorded action, as Turbo would.
+
+.PARAMETER config
+JSON config file. Default is $ACTION_RUNNER_CONFIG, or runner_config.json in the runner's directory. For example:
+{
+  "audit_file": "/tmp/output_actionscript.out",
+  "slack": {"webhook_env": "SLACK_WEBHOOK"},
+  "scripts": [
+    {"entity_type": "VIRTUAL_MACHINE", "action_type": "RIGHT_SIZE", "phases": ["PRE", "REPLACE", "POST"], "handlers": ["audit", "slack"]},
+    {"entity_type": "VIRTUAL_MACHINE", "action_type": "MOVE"}
+  ]
+}
+- audit_file: where the audit handler appends a line per run. Default /tmp/output_actionscript.out.
+- slack.webhook_url: the Slack webhook. If not given it comes from the environment variable named by slack.webhook_env
+  (default SLACK_WEBHOOK). No webhook means the slack handler does nothing, like slack.sh.
+  Turbo's SSH session doesn't source .bash_profile the way slack.sh does, so set it in the config or the SSH user's environment.
+- script_dir: directory of the scripts relative to the manifest. Default ".".
+- scripts: entity_type and action_type use Turbo's names. phases defaults to PRE, REPLACE and POST (ON_GENERATION and
+  AFTER_EXECUTION may also be given) and handlers to audit and slack. Each phase becomes a script named <phase>_<name>,
+  where name defaults to the action and entity type, e.g. resize_vm for RIGHT_SIZE on VIRTUAL_MACHINE.
+
+.PARAMETER output
+Only used with manifest. The manifest file to write. Default action_scripts_manifest.json in the config file's directory.
+
+.PARAMETER link
+Only used with manifest. Also create the manifest's scripts as links to this binary. Existing links are replaced, other files are left alone.
+
+.PARAMETER script
+Only used with run. The name of the manifest script to run as, e.g. pre_resize_vm.
+
+CROSS-COMPLIATION NOTES
+env GOOS=linux GOARCH=amd64 go build ./action_script_runner.go ./runner_*.go
+
+TESTING NOTES
+go test ./action_script_runner.go ./action_script_runner_test.go ./runner_*.go
+testdata/payloads holds recorded actions as Turbo passes them on stdin.
+
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Name of the binary itself. Run under any other name, it runs the manifest script of that name.
+const runnerName = "action_script_runner"
+
+func main() {
+	// 1.0 Initial version: replaces the bash scripts and slack.sh.
+	version := "1.0"
+
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if name != runnerName {
+		os.Exit(runCommand(name, nil))
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Println("*** Usage: " + runnerName + " manifest|run|version [flags] (-h after the command for its flags)")
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "manifest":
+		os.Exit(manifestCommand(os.Args[2:]))
+	case "run":
+		os.Exit(runCommand("", os.Args[2:]))
+	case "version":
+		fmt.Println(runnerName + " version " + version)
+	default:
+		fmt.Println("*** Unknown command: " + os.Args[1] + " (use manifest, run or version)")
+		os.Exit(1)
+	}
+}
+
+// The config file to use if -config isn't given
+func defaultConfigFile() string {
+	if config_file := os.Getenv("ACTION_RUNNER_CONFIG"); config_file != "" {
+		return config_file
+	}
+	return filepath.Join(filepath.Dir(os.Args[0]), "runner_config.json")
+}
+
+// Writes the manifest (and the script links). Returns the exit status.
+func manifestCommand(args []string) int {
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	config_file := flags.String("config", defaultConfigFile(), "JSON config file")
+	output := flags.String("output", "", "Manifest file to write (default action_scripts_manifest.json next to the config file)")
+	link := flags.Bool("link", false, "Also create the manifest's scripts as links to this binary")
+	flags.Parse(args)
+
+	config, err := loadRunnerConfig(*config_file)
+	if err != nil {
+		fmt.Println("*** " + err.Error())
+		return 1
+	}
+	if *output == "" {
+		*output = filepath.Join(filepath.Dir(*config_file), "action_scripts_manifest.json")
+	}
+	if err := writeManifest(config, *output); err != nil {
+		fmt.Println("*** " + err.Error())
+		return 1
+	}
+	fmt.Printf("*** Wrote %d script(s) to %s\n", len(config.phaseScripts()), *output)
+
+	if *link {
+		runner, err := os.Executable()
+		if err != nil {
+			fmt.Println("*** Can't find the runner binary to link to: " + err.Error())
+			return 1
+		}
+		scriptDir := filepath.Join(filepath.Dir(*output), config.ScriptDir)
+		linked, skipped, err := linkScripts(config, scriptDir, runner)
+		if err != nil {
+			fmt.Println("*** " + err.Error())
+			return 1
+		}
+		fmt.Printf("*** Linked %d script(s) in %s to %s\n", linked, scriptDir, runner)
+		for _, path := range skipped {
+			fmt.Println("### Left " + path + " alone since it isn't a link")
+		}
+	}
+	return 0
+}
+
+func writeManifest(config runnerConfig, output string) error {
+	data, err := json.MarshalIndent(config.manifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(output, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing manifest %s: %v", output, err)
+	}
+	return nil
+}
+
+// Creates each manifest script in scriptDir as a link to the runner.
+// Returns the number of links made and the scripts that were skipped because a file that isn't a link is in the way.
+func linkScripts(config runnerConfig, scriptDir string, runner string) (int, []string, error) {
+	linked := 0
+	var skipped []string
+	for _, phaseScript := range config.phaseScripts() {
+		path := filepath.Join(scriptDir, phaseScript.name)
+		if info, err := os.Lstat(path); err == nil {
+			if info.Mode()&os.ModeSymlink == 0 {
+				skipped = append(skipped, path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return linked, skipped, fmt.Errorf("error replacing link %s: %v", path, err)
+			}
+		}
+		if err := os.Symlink(runner, path); err != nil {
+			return linked, skipped, fmt.Errorf("error linking %s: %v", path, err)
+		}
+		linked++
+	}
+	return linked, skipped, nil
+}
+
+// Runs a manifest script. script is the name the binary was run as, or "" to take it from -script. Returns the exit status.
+func runCommand(script string, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	config_file := flags.String("config", defaultConfigFile(), "JSON config file")
+	script_name := flags.String("script", script, "Manifest script to run as, e.g. pre_resize_vm")
+	flags.Parse(args)
+
+	if *script_name == "" {
+		fmt.Fprintln(os.Stderr, "*** Missing -script")
+		return 1
+	}
+	config, err := loadRunnerConfig(*config_file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "*** "+err.Error())
+		return 1
+	}
+
+	// Run by hand without anything piped in, there's no action to wait for on stdin
+	var stdin io.Reader = os.Stdin
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		stdin = strings.NewReader("")
+	}
+	message, handlerErrors, err := runScript(config, *script_name, stdin, os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "*** "+err.Error())
+		return 2
+	}
+	fmt.Println(message)
+	// Notifications failing mustn't fail or block the action
+	for _, handlerErr := range handlerErrors {
+		fmt.Fprintln(os.Stderr, "### ERROR ### "+handlerErr.Error())
+	}
+	return 0
+}
+
+// Reads the action and hands it to each of the script's handlers. All the handlers are run even if one fails.
+// Returns the message sent and the handlers' errors. err is only set if the script or action couldn't be found.
+func runScript(config runnerConfig, script_name string, stdin io.Reader, getenv func(string) string) (string, []error, error) {
+	script, ok := config.findScript(script_name)
+	if !ok {
+		return "", nil, fmt.Errorf("script %s isn't in the config", script_name)
+	}
+	action, err := readScriptAction(stdin, getenv)
+	if err != nil {
+		return "", nil, err
+	}
+
+	message := action.message(script)
+	var handlerErrors []error
+	for _, name := range script.script.Handlers {
+		handler, err := newActionHandler(name, config, getenv)
+		if err == nil {
+			err = handler.handle(script, action, message)
+		}
+		if err != nil {
+			handlerErrors = append(handlerErrors, fmt.Errorf("%s handler: %v", name, err))
+		}
+	}
+	return message, handlerErrors, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs each script with a recorded action and checks what lands in the audit file and Slack.
+func TestRunScriptWithRecordedPayloads(t *testing.T) {
+	var slackMessages []string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		json.NewDecoder(r.Body).Decode(&message)
+		slackMessages = append(slackMessages, message["text"])
+	}))
+	defer slack.Close()
+
+	config, err := loadRunnerConfig("runner_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AuditFile = filepath.Join(t.TempDir(), "audit.out")
+	getenv := func(name string) string {
+		if name == "SLACK_WEBHOOK" {
+			return slack.URL
+		}
+		return ""
+	}
+
+	cases := []struct {
+		script  string
+		payload string
+		message string
+	}{
+		{"pre_resize_vm", "right_size_vm.json", "PRE RESIZE action script run for VM: HR-DB-01 (16 GB -> 20 GB)"},
+		{"replace_move_vm", "move_vm.json", "REPLACE MOVE action script run for VM: payweb-prd-01 (esx-west-04 -> esx-west-07)"},
+	}
+	for _, tc := range cases {
+		payload, err := os.Open(filepath.Join("testdata", "payloads", tc.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, handlerErrors, err := runScript(config, tc.script, payload, getenv)
+		payload.Close()
+		if err != nil || len(handlerErrors) > 0 {
+			t.Fatal(err, handlerErrors)
+		}
+		if message != tc.message {
+			t.Errorf("%s: message %q, want %q", tc.script, message, tc.message)
+		}
+	}
+
+	if strings.Join(slackMessages, "\n") != "Action Script Execution: "+cases[0].message+"\nAction Script Execution: "+cases[1].message {
+		t.Errorf("Slack got %q", slackMessages)
+	}
+	audit, _ := ioutil.ReadFile(config.AuditFile)
+	for _, line := range []string{
+		cases[0].message + " [pre_resize_vm 637145236489202 IN_PROGRESS] Resize up VMem for Virtual Machine HR-DB-01 from 16 GB to 20 GB",
+		cases[1].message + " [replace_move_vm 637145236489311 IN_PROGRESS] Move Virtual Machine payweb-prd-01 from esx-west-04 to esx-west-07",
+	} {
+		if !strings.Contains(string(audit), line) {
+			t.Errorf("audit file doesn't have %q:\n%s", line, audit)
+		}
+	}
+}
+
+func TestRunScriptFallbacksAndErrors(t *testing.T) {
+	config, err := loadRunnerConfig("runner_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AuditFile = filepath.Join(t.TempDir(), "audit.out")
+	failingSlack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no_service", http.StatusNotFound)
+	}))
+	defer failingSlack.Close()
+	config.Slack.WebhookUrl = failingSlack.URL
+
+	// No action on stdin: the target comes from the environment as in the bash scripts
+	env := map[string]string{"VMT_TARGET_NAME": "HR-APP-01"}
+	message, handlerErrors, err := runScript(config, "post_move_vm", strings.NewReader(""), func(name string) string { return env[name] })
+	if err != nil || message != "POST MOVE action script run for VM: HR-APP-01" {
+		t.Errorf("got %q %v", message, err)
+	}
+	// The audit line is still written when Slack fails
+	if len(handlerErrors) != 1 || !strings.Contains(handlerErrors[0].Error(), "slack handler") {
+		t.Errorf("handler errors %v, want just Slack's", handlerErrors)
+	}
+	if audit, _ := ioutil.ReadFile(config.AuditFile); !strings.Contains(string(audit), message) {
+		t.Errorf("audit file has %q", audit)
+	}
+
+	if _, _, err := runScript(config, "pre_suspend_host", strings.NewReader(""), func(string) string { return "x" }); err == nil {
+		t.Error("expected an error for a script that isn't in the config")
+	}
+	if _, _, err := runScript(config, "pre_move_vm", strings.NewReader(""), func(string) string { return "" }); err == nil {
+		t.Error("expected an error with no action and no VMT_TARGET_NAME")
+	}
+	if _, _, err := runScript(config, "pre_move_vm", strings.NewReader("{not json"), func(string) string { return "" }); err == nil {
+		t.Error("expected an error for a bad action")
+	}
+}
+
+func TestLinkScripts(t *testing.T) {
+	config, err := loadRunnerConfig("runner_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	// A file that isn't a link is left alone, an old link is replaced
+	ioutil.WriteFile(filepath.Join(dir, "pre_move_vm"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("/nowhere", filepath.Join(dir, "post_move_vm"))
+
+	linked, skipped, err := linkScripts(config, dir, "/opt/turbo/action_script_runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked != 5 || len(skipped) != 1 || filepath.Base(skipped[0]) != "pre_move_vm" {
+		t.Errorf("linked %d, skipped %v", linked, skipped)
+	}
+	if target, _ := os.Readlink(filepath.Join(dir, "post_move_vm")); target != "/opt/turbo/action_script_runner" {
+		t.Errorf("post_move_vm links to %s", target)
+	}
+}
+
+// A Slack outage mustn't fail (REPLACE) or block (PRE) the action, but a script that isn't configured must.
+func TestRunCommandExitStatus(t *testing.T) {
+	failingSlack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer failingSlack.Close()
+	dir := t.TempDir()
+	config_file := filepath.Join(dir, "runner_config.json")
+	config := `{"audit_file": "` + filepath.Join(dir, "audit.out") + `", "slack": {"webhook_url": "` + failingSlack.URL + `"},
+		"scripts": [{"entity_type": "VIRTUAL_MACHINE", "action_type": "RIGHT_SIZE"}]}`
+	if err := ioutil.WriteFile(config_file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := os.Stdin
+	defer func() { os.Stdin = saved }()
+	run := func(script string) int {
+		payload, err := os.Open(filepath.Join("testdata", "payloads", "right_size_vm.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer payload.Close()
+		os.Stdin = payload
+		return runCommand(script, []string{"-config", config_file})
+	}
+
+	for _, script := range []string{"pre_resize_vm", "replace_resize_vm"} {
+		if status := run(script); status != 0 {
+			t.Errorf("%s exited %d with Slack down, want 0", script, status)
+		}
+	}
+	if status := run("pre_move_vm"); status == 0 {
+		t.Error("pre_move_vm isn't in the config but exited 0")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+/*
+The action Turbo runs an action script for.
+
+Turbo passes the action (as the actions API returns it) as JSON on stdin and sets VMT_* environment variables.
+If stdin is empty, e.g. when a script is run by hand, the target comes from VMT_TARGET_NAME and VMT_TARGET_UUID as the
+bash scripts do.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type scriptAction struct {
+	uuid       string
+	actionType string
+	state      string
+	details    string
+	targetName string
+	targetUuid string
+	targetType string
+	// e.g. 16 GB -> 20 GB for a resize or the source and destination host for a move. "" if the action doesn't give them.
+	from   string
+	to     string
+	reason string
+}
+
+// Reads the action JSON from stdin, falling back to the environment if there isn't any.
+func readScriptAction(stdin io.Reader, getenv func(string) string) (scriptAction, error) {
+	var action scriptAction
+	data, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return action, fmt.Errorf("error reading the action from stdin: %v", err)
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		var responseAction map[string]interface{}
+		if err := json.Unmarshal(data, &responseAction); err != nil {
+			return action, fmt.Errorf("error decoding the action from stdin: %v", err)
+		}
+		action = parseScriptAction(responseAction)
+	}
+
+	if action.targetName == "" {
+		action.targetName = getenv("VMT_TARGET_NAME")
+	}
+	if action.targetUuid == "" {
+		action.targetUuid = getenv("VMT_TARGET_UUID")
+	}
+	if action.targetName == "" && action.targetUuid == "" {
+		return action, fmt.Errorf("no action on stdin and VMT_TARGET_NAME isn't set")
+	}
+	return action, nil
+}
+
+func parseScriptAction(responseAction map[string]interface{}) scriptAction {
+	target, _ := responseAction["target"].(map[string]interface{})
+	risk, _ := responseAction["risk"].(map[string]interface{})
+	action := scriptAction{
+		uuid:       jsonString(responseAction, "uuid"),
+		actionType: jsonString(responseAction, "actionType"),
+		state:      jsonString(responseAction, "actionState"),
+		details:    jsonString(responseAction, "details"),
+		targetName: jsonString(target, "displayName"),
+		targetUuid: jsonString(target, "uuid"),
+		targetType: jsonString(target, "className"),
+		reason:     jsonString(risk, "description"),
+	}
+
+	// Resizes give values, moves and cloud scales give the entities (hosts, storages or templates)
+	currentValue, resizeToValue := jsonString(responseAction, "currentValue"), jsonString(responseAction, "resizeToValue")
+	if currentValue != "" && resizeToValue != "" {
+		units := jsonString(responseAction, "valueUnits")
+		action.from = formatResizeValue(currentValue, units)
+		action.to = formatResizeValue(resizeToValue, units)
+	} else {
+		currentEntity, _ := responseAction["currentEntity"].(map[string]interface{})
+		newEntity, _ := responseAction["newEntity"].(map[string]interface{})
+		action.from = jsonString(currentEntity, "displayName")
+		action.to = jsonString(newEntity, "displayName")
+	}
+	return action
+}
+
+// Shows memory and storage sizes in GB, e.g. 16777216.0 KB as 16 GB. Other values are shown as Turbo gives them.
+func formatResizeValue(value string, units string) string {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return strings.TrimSpace(value + " " + units)
+	}
+	switch units {
+	case "KB":
+		number, units = number/(1024*1024), "GB"
+	case "MB":
+		number, units = number/1024, "GB"
+	}
+	return strings.TrimSpace(strconv.FormatFloat(math.Round(number*100)/100, 'f', -1, 64) + " " + units)
+}
+
+// The message the handlers send, e.g. "PRE RESIZE action script run for VM: HR-DB-01"
+func (action scriptAction) message(script phaseScript) string {
+	phase := strings.Replace(script.phase, "_", " ", -1)
+	message := fmt.Sprintf("%s %s action script run for %s: %s", phase, strings.ToUpper(label(actionLabels, script.script.ActionType)),
+		strings.ToUpper(label(entityLabels, script.script.EntityType)), action.targetName)
+	if action.from != "" || action.to != "" {
+		message += fmt.Sprintf(" (%s -> %s)", action.from, action.to)
+	}
+	return message
+}
+
+// Returns the string value of a field in the decoded action, or "" if it isn't there or isn't a string
+func jsonString(object map[string]interface{}, field string) string {
+	value, _ := object[field].(string)
+	return value
+}
@@ -0,0 +1,206 @@
+package main
+
+/*
+The runner's config and the action script manifest generated from it.
+
+Each entry in "scripts" is one action type on one entity type, run in one or more phases. It becomes one manifest script per
+phase, named <phase>_<name>, e.g. pre_resize_vm. The name defaults to the action and entity type (resize_vm for RIGHT_SIZE on
+VIRTUAL_MACHINE) so the defaults give the same names as the bash scripts' manifest.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+type runnerConfig struct {
+	// Where the audit handler appends a line for each run. Default /tmp/output_actionscript.out, as the bash scripts use.
+	AuditFile string      `json:"audit_file"`
+	Slack     slackConfig `json:"slack"`
+	// Directory the manifest's script paths are relative to the manifest in. Default "." (next to the manifest).
+	ScriptDir string         `json:"script_dir"`
+	Scripts   []scriptConfig `json:"scripts"`
+}
+
+type slackConfig struct {
+	// Used if set, otherwise the webhook comes from the environment variable named by WebhookEnv
+	WebhookUrl string `json:"webhook_url"`
+	// Default SLACK_WEBHOOK, as slack.sh uses
+	WebhookEnv string `json:"webhook_env"`
+}
+
+type scriptConfig struct {
+	// Optional. The part of the manifest script names after the phase, e.g. resize_vm
+	Name string `json:"name"`
+	// Turbo's names, e.g. VIRTUAL_MACHINE and RIGHT_SIZE
+	EntityType string `json:"entity_type"`
+	ActionType string `json:"action_type"`
+	// Default PRE, REPLACE and POST
+	Phases []string `json:"phases"`
+	// Default audit and slack
+	Handlers []string `json:"handlers"`
+}
+
+// Entry in action_scripts_manifest.json
+type manifestScript struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ScriptPath  string `json:"scriptPath"`
+	EntityType  string `json:"entityType"`
+	ActionType  string `json:"actionType"`
+	ActionPhase string `json:"actionPhase"`
+}
+
+type actionScriptsManifest struct {
+	Scripts []manifestScript `json:"scripts"`
+}
+
+// A manifest script: what the runner does when it is run under that script's name
+type phaseScript struct {
+	name   string
+	phase  string
+	script scriptConfig
+}
+
+var defaultPhases = []string{"PRE", "REPLACE", "POST"}
+var defaultHandlers = []string{"audit", "slack"}
+
+// Phases Turbo runs action scripts in and how the manifest describes them ({action} is the action's label, e.g. resize)
+var phaseDescriptions = map[string]string{
+	"ON_GENERATION":   "Runs when Turbonomic generates a {action} action",
+	"PRE":             "Runs BEFORE Turbonomic {action} orchestration",
+	"REPLACE":         "REPLACES Turbonomic {action} orchestration",
+	"POST":            "Runs AFTER Turbonomic {action} orchestration",
+	"AFTER_EXECUTION": "Runs after a {action} action has executed, whether or not it succeeded",
+}
+
+// Short names for the action and entity types, used for script names and messages. Others are just lower-cased.
+var actionLabels = map[string]string{"RIGHT_SIZE": "resize", "RESIZE": "resize", "SCALE": "scale", "MOVE": "move"}
+var entityLabels = map[string]string{"VIRTUAL_MACHINE": "vm", "PHYSICAL_MACHINE": "host", "STORAGE": "storage", "DATABASE_SERVER": "dbserver", "DATABASE": "db"}
+
+func loadRunnerConfig(config_file string) (runnerConfig, error) {
+	var config runnerConfig
+	data, err := ioutil.ReadFile(config_file)
+	if err != nil {
+		return config, fmt.Errorf("error reading config file %s: %v", config_file, err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error decoding config file %s: %v", config_file, err)
+	}
+	return config.normalized()
+}
+
+// Fills in the defaults, puts the types and phases in upper case and checks them.
+func (config runnerConfig) normalized() (runnerConfig, error) {
+	if config.AuditFile == "" {
+		config.AuditFile = "/tmp/output_actionscript.out"
+	}
+	if config.Slack.WebhookEnv == "" {
+		config.Slack.WebhookEnv = "SLACK_WEBHOOK"
+	}
+	if config.ScriptDir == "" {
+		config.ScriptDir = "."
+	}
+	if len(config.Scripts) == 0 {
+		return config, fmt.Errorf("no scripts in the config")
+	}
+
+	names := make(map[string]bool)
+	scripts := make([]scriptConfig, len(config.Scripts))
+	for i, script := range config.Scripts {
+		script.EntityType = strings.ToUpper(strings.TrimSpace(script.EntityType))
+		script.ActionType = strings.ToUpper(strings.TrimSpace(script.ActionType))
+		if script.EntityType == "" || script.ActionType == "" {
+			return config, fmt.Errorf("script %d needs an entity_type and an action_type", i+1)
+		}
+		if script.Name == "" {
+			script.Name = label(actionLabels, script.ActionType) + "_" + label(entityLabels, script.EntityType)
+		}
+
+		if len(script.Phases) == 0 {
+			script.Phases = defaultPhases
+		}
+		var phases []string
+		for _, phase := range script.Phases {
+			phase = strings.ToUpper(strings.TrimSpace(phase))
+			if _, ok := phaseDescriptions[phase]; !ok {
+				return config, fmt.Errorf("script %s has unknown phase %s (use %s)", script.Name, phase, strings.Join(knownPhases(), ", "))
+			}
+			name := strings.ToLower(phase) + "_" + script.Name
+			if names[name] {
+				return config, fmt.Errorf("more than one script named %s", name)
+			}
+			names[name] = true
+			phases = append(phases, phase)
+		}
+		script.Phases = phases
+
+		if len(script.Handlers) == 0 {
+			script.Handlers = defaultHandlers
+		}
+		for _, handler := range script.Handlers {
+			if _, ok := handlerConstructors[handler]; !ok {
+				return config, fmt.Errorf("script %s has unknown handler %s (use %s)", script.Name, handler, strings.Join(knownHandlers(), ", "))
+			}
+		}
+		scripts[i] = script
+	}
+	config.Scripts = scripts
+	return config, nil
+}
+
+// The manifest scripts, in config order
+func (config runnerConfig) phaseScripts() []phaseScript {
+	var phaseScripts []phaseScript
+	for _, script := range config.Scripts {
+		for _, phase := range script.Phases {
+			phaseScripts = append(phaseScripts, phaseScript{name: strings.ToLower(phase) + "_" + script.Name, phase: phase, script: script})
+		}
+	}
+	return phaseScripts
+}
+
+func (config runnerConfig) findScript(name string) (phaseScript, bool) {
+	for _, phaseScript := range config.phaseScripts() {
+		if phaseScript.name == name {
+			return phaseScript, true
+		}
+	}
+	return phaseScript{}, false
+}
+
+// The action_scripts_manifest.json for the config. Each script path is a link to the runner named after the script.
+func (config runnerConfig) manifest() actionScriptsManifest {
+	manifest := actionScriptsManifest{Scripts: []manifestScript{}}
+	for _, phaseScript := range config.phaseScripts() {
+		description := strings.Replace(phaseDescriptions[phaseScript.phase], "{action}", label(actionLabels, phaseScript.script.ActionType), 1)
+		manifest.Scripts = append(manifest.Scripts, manifestScript{
+			Name:        phaseScript.name,
+			Description: description,
+			ScriptPath:  strings.TrimSuffix(config.ScriptDir, "/") + "/" + phaseScript.name,
+			EntityType:  phaseScript.script.EntityType,
+			ActionType:  phaseScript.script.ActionType,
+			ActionPhase: phaseScript.phase,
+		})
+	}
+	return manifest
+}
+
+func label(labels map[string]string, value string) string {
+	if short, ok := labels[value]; ok {
+		return short
+	}
+	return strings.ToLower(value)
+}
+
+func knownPhases() []string {
+	var phases []string
+	for phase := range phaseDescriptions {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	return phases
+}
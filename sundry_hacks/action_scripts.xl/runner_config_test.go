@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The example config makes the same scripts as the bash scripts' manifest, only pointing at the runner.
+func TestManifestMatchesBashScripts(t *testing.T) {
+	config, err := loadRunnerConfig("runner_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("action_scripts_manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bash actionScriptsManifest
+	if err := json.Unmarshal(data, &bash); err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(script manifestScript) string {
+		return strings.Join([]string{script.Name, script.Description, script.EntityType, script.ActionType, script.ActionPhase}, "|")
+	}
+	var want, got []string
+	for _, script := range bash.Scripts {
+		want = append(want, key(script))
+	}
+	for _, script := range config.manifest().Scripts {
+		got = append(got, key(script))
+		if script.ScriptPath != "./"+script.Name {
+			t.Errorf("%s has script path %s", script.Name, script.ScriptPath)
+		}
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("manifest scripts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunnerConfigDefaultsAndErrors(t *testing.T) {
+	config, err := runnerConfig{Scripts: []scriptConfig{{EntityType: "physical_machine", ActionType: "suspend", Name: "", Phases: []string{"post"}}}}.normalized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, ok := config.findScript("post_suspend_host")
+	if !ok || script.phase != "POST" || strings.Join(script.script.Handlers, ",") != "audit,slack" || config.AuditFile != "/tmp/output_actionscript.out" {
+		t.Errorf("got %+v %v from %+v", script, ok, config)
+	}
+
+	bad := map[string]runnerConfig{
+		"no scripts":      {},
+		"no action type":  {Scripts: []scriptConfig{{EntityType: "VIRTUAL_MACHINE"}}},
+		"unknown phase":   {Scripts: []scriptConfig{{EntityType: "VIRTUAL_MACHINE", ActionType: "MOVE", Phases: []string{"DURING"}}}},
+		"unknown handler": {Scripts: []scriptConfig{{EntityType: "VIRTUAL_MACHINE", ActionType: "MOVE", Handlers: []string{"email"}}}},
+		"duplicate name":  {Scripts: []scriptConfig{{EntityType: "VIRTUAL_MACHINE", ActionType: "MOVE"}, {EntityType: "VIRTUAL_MACHINE", ActionType: "MOVE", Phases: []string{"POST"}}}},
+	}
+	for what, config := range bad {
+		if _, err := config.normalized(); err == nil {
+			t.Errorf("expected an error for %s", what)
+		}
+	}
+}
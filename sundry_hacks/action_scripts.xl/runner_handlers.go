@@ -0,0 +1,97 @@
+package main
+
+/*
+What the runner does with an action. Each script in the config lists its handlers by name:
+- audit: appends a line to the audit file, like the bash scripts' echo to /tmp/output_actionscript.out
+- slack: posts the message to the Slack webhook, like slack.sh. Does nothing if there is no webhook.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type actionHandler interface {
+	handle(script phaseScript, action scriptAction, message string) error
+}
+
+var handlerConstructors = map[string]func(config runnerConfig, getenv func(string) string) actionHandler{
+	"audit": newAuditHandler,
+	"slack": newSlackHandler,
+}
+
+// Returns the handler with the given name. The name must be one of handlerConstructors'.
+func newActionHandler(name string, config runnerConfig, getenv func(string) string) (actionHandler, error) {
+	constructor, ok := handlerConstructors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown handler %s", name)
+	}
+	return constructor(config, getenv), nil
+}
+
+func knownHandlers() []string {
+	var names []string
+	for name := range handlerConstructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type auditHandler struct {
+	auditFile string
+	// now is a field so tests get a known time
+	now func() time.Time
+}
+
+func newAuditHandler(config runnerConfig, getenv func(string) string) actionHandler {
+	return &auditHandler{auditFile: config.AuditFile, now: time.Now}
+}
+
+// Appends "<date> <message> [<script> <action uuid> <state>] <details>" to the audit file
+func (handler *auditHandler) handle(script phaseScript, action scriptAction, message string) error {
+	file, err := os.OpenFile(handler.auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening audit file %s: %v", handler.auditFile, err)
+	}
+	line := fmt.Sprintf("%s %s [%s %s %s] %s\n", handler.now().Format(time.UnixDate), message, script.name, action.uuid, action.state, action.details)
+	if _, err := file.WriteString(line); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing audit file %s: %v", handler.auditFile, err)
+	}
+	return file.Close()
+}
+
+type slackHandler struct {
+	webhookUrl string
+	client     *http.Client
+}
+
+func newSlackHandler(config runnerConfig, getenv func(string) string) actionHandler {
+	webhookUrl := config.Slack.WebhookUrl
+	if webhookUrl == "" {
+		webhookUrl = getenv(config.Slack.WebhookEnv)
+	}
+	return &slackHandler{webhookUrl: webhookUrl, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (handler *slackHandler) handle(script phaseScript, action scriptAction, message string) error {
+	if handler.webhookUrl == "" {
+		return nil
+	}
+	payload, _ := json.Marshal(map[string]string{"text": "Action Script Execution: " + message})
+	res, err := handler.client.Post(handler.webhookUrl, "application/json", strings.NewReader(string(payload)))
+	if err != nil {
+		return fmt.Errorf("error posting to Slack: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetActionFromTo(t *testing.T) {
+	// Host UUID -> cluster name, as built from the -cluster_group members
+	hostClusterMap := map[string]string{"h2": "Prod-Cluster", "h3": "DR-Cluster"}
+
+	cases := []struct {
+		name       string
+		actionType string
+		action     string
+		want       Action
+	}{
+		{
+			name:       "host move",
+			actionType: "MOVE",
+			action: `{"target": {"uuid": "v1", "displayName": "payroll-db01", "className": "VirtualMachine"},
+				"currentEntity": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+				"newEntity": {"uuid": "h2", "displayName": "esx02", "className": "PhysicalMachine"}}`,
+			want: Action{actionFrom: "esx01", actionFromType: "PhysicalMachine", actionTo: "esx02", actionToType: "PhysicalMachine", actionToCluster: "Prod-Cluster"},
+		},
+		{
+			name:       "storage move outside the clusters",
+			actionType: "MOVE",
+			action: `{"currentEntity": {"uuid": "s1", "displayName": "ds01", "className": "Storage"},
+				"newEntity": {"uuid": "s2", "displayName": "ds02", "className": "Storage"}}`,
+			want: Action{actionFrom: "ds01", actionFromType: "Storage", actionTo: "ds02", actionToType: "Storage"},
+		},
+		{
+			name:       "compound host and storage move",
+			actionType: "MOVE",
+			action: `{"currentEntity": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+				"newEntity": {"uuid": "h2", "displayName": "esx02", "className": "PhysicalMachine"},
+				"compoundActions": [
+					{"currentEntity": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+					 "newEntity": {"uuid": "h3", "displayName": "esx03", "className": "PhysicalMachine"}},
+					{"currentEntity": {"uuid": "s1", "displayName": "ds01", "className": "Storage"},
+					 "newEntity": {"uuid": "s2", "displayName": "ds02", "className": "Storage"}},
+					{"currentEntity": {"uuid": "s3", "displayName": "ds03", "className": "Storage"},
+					 "newEntity": {"uuid": "s4", "displayName": "ds04", "className": "Storage"}}
+				]}`,
+			// The compound actions replace the top-level move and each type is only listed once
+			want: Action{actionFrom: "esx01, ds01, ds03", actionFromType: "PhysicalMachine, Storage", actionTo: "esx03, ds02, ds04", actionToType: "PhysicalMachine, Storage", actionToCluster: "DR-Cluster"},
+		},
+		{
+			name:       "move without entities",
+			actionType: "MOVE",
+			action:     `{"target": {"uuid": "v1", "displayName": "payroll-db01", "className": "VirtualMachine"}}`,
+			want:       Action{},
+		},
+		{
+			name:       "provision from the current entity",
+			actionType: "PROVISION",
+			action: `{"target": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+				"currentEntity": {"uuid": "h4", "displayName": "esx04", "className": "PhysicalMachine"},
+				"newEntity": {"uuid": "h5", "displayName": "esx04_clone", "className": "PhysicalMachine"}}`,
+			want: Action{actionFrom: "esx04", actionFromType: "PhysicalMachine", actionTo: "esx04_clone", actionToType: "PhysicalMachine"},
+		},
+		{
+			name:       "provision from the target",
+			actionType: "PROVISION",
+			action:     `{"target": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"}}`,
+			want:       Action{actionFrom: "esx01", actionFromType: "PhysicalMachine"},
+		},
+		{
+			name:       "suspend",
+			actionType: "SUSPEND",
+			action: `{"target": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+				"currentEntity": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"}}`,
+			want: Action{actionFrom: "esx01", actionFromType: "PhysicalMachine"},
+		},
+		{
+			name:       "other action types are left alone",
+			actionType: "RESIZE",
+			action: `{"target": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+				"currentEntity": {"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"}}`,
+			want: Action{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var responseAction map[string]interface{}
+			if err := json.Unmarshal([]byte(c.action), &responseAction); err != nil {
+				t.Fatal(err)
+			}
+			action := Action{actionType: c.actionType}
+			setActionFromTo(&action, responseAction, hostClusterMap)
+			c.want.actionType = c.actionType
+			if action != c.want {
+				t.Errorf("got %+v\nwant %+v", action, c.want)
+			}
+		})
+	}
+}
+
+func TestPushPowerBiDataSendsOnePostPerCluster(t *testing.T) {
+	fake, url := startFakePowerBi(t, "cluster_impact")
+	fake.strict = true
+	fake.injectStatus(http.StatusInternalServerError)
+
+	clusterNameMap := map[string]string{"c1": "Prod-Cluster", "c2": "DR-Cluster", "c3": "Idle-Cluster"}
+	clusterActionsMap := map[string][]Action{
+		"c1": {
+			{entityName: "esx01", entityType: "PhysicalMachine", actionType: "SUSPEND", actionFrom: "esx01", actionFromType: "PhysicalMachine", impactedApps: "Payroll"},
+			// Quotes in names used to break the hand-built JSON
+			{entityName: `vm "a"`, entityType: "VirtualMachine", actionType: "MOVE", actionTo: "esx02", actionToCluster: "Prod-Cluster"},
+		},
+		"c2": {{entityName: "esx09", entityType: "PhysicalMachine", actionType: "PROVISION"}},
+	}
+	pushPowerBiData(clusterNameMap, clusterActionsMap, "2024-01-02T03:04:05Z", true, url)
+
+	fake.assertNoSchemaErrors(t)
+	// DR-Cluster is sent first and gets the 500, the other clusters are still sent and Idle-Cluster has nothing to send
+	fake.assertPostCount(t, 2)
+	fake.assertRowCount(t, 2)
+	fake.assertRowsWhere(t, map[string]interface{}{"Cluster_Name": "Prod-Cluster", "Entity_Name": `vm "a"`, "Action_To_Cluster": "Prod-Cluster", "Impacted_Applications": ""}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Cluster_Name": "Prod-Cluster", "Action_Type": "SUSPEND", "Impacted_Applications": "Payroll"}, 1)
+}
+
+func TestPushPowerBiDataThrottles(t *testing.T) {
+	var slept []time.Duration
+	savedCalls, savedSleep := powerBiThrottleCalls, powerBiSleep
+	powerBiThrottleCalls = 3
+	powerBiSleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { powerBiThrottleCalls, powerBiSleep = savedCalls, savedSleep })
+
+	fake, url := startFakePowerBi(t, "cluster")
+	fake.strict = true
+	clusterNameMap := make(map[string]string)
+	clusterActionsMap := make(map[string][]Action)
+	for i := 0; i < 7; i++ {
+		clusterUuid := "c" + strconv.Itoa(i)
+		clusterNameMap[clusterUuid] = "Cluster-" + strconv.Itoa(i)
+		clusterActionsMap[clusterUuid] = []Action{{entityName: "esx" + strconv.Itoa(i), actionType: "SUSPEND"}}
+	}
+	pushPowerBiData(clusterNameMap, clusterActionsMap, "2024-01-02T03:04:05Z", false, url)
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertPostCount(t, 7)
+	fake.assertRowCount(t, 7)
+	// A pause after the 3rd and 6th POSTs
+	if len(slept) != 2 || slept[0] != powerBiThrottleSleep {
+		t.Errorf("throttle slept %v, want two sleeps of %v", slept, powerBiThrottleSleep)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+/*
+Capacity and headroom of the clusters the cluster tool reports on, for a second table next to the host actions.
+
+The stats come from POST /stats/{cluster uuid}. Turbo gives the used and capacity values of the hosts' CPU and Mem and
+the datastores' StorageAmount, the VM headroom for each of those and the host and VM counts.
+Each cluster gets one row with the same Timestamp as the action rows from the run.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var clusterCapacityColumns = []string{"Timestamp", "Cluster_Name", "CPU_Utilization", "Mem_Utilization", "Storage_Utilization", "CPU_Headroom", "Mem_Headroom", "Storage_Headroom", "VM_Headroom", "Host_Count", "VM_Count"}
+
+// The stats asked for. In the *Headroom stats value is the number of VMs in the cluster and capacity.total is how many
+// fit by that resource, so the headroom is the difference (see vmHeadroom).
+var clusterStatNames = []string{"CPU", "Mem", "StorageAmount", "CPUHeadroom", "MemHeadroom", "StorageHeadroom", "numHosts", "numVMs"}
+
+type clusterCapacity struct {
+	// Percentages, -1 if Turbo didn't give the stat
+	cpuUtilization     float64
+	memUtilization     float64
+	storageUtilization float64
+	// VMs, -1 if Turbo didn't give the stat
+	cpuHeadroom     float64
+	memHeadroom     float64
+	storageHeadroom float64
+	hostCount       float64
+	vmCount         float64
+}
+
+// Gets the current capacity stats of the cluster.
+func getClusterCapacity(turbo_instance string, auth string, clusterUuid string) (clusterCapacity, error) {
+	var statistics []map[string]string
+	for _, name := range clusterStatNames {
+		statistics = append(statistics, map[string]string{"name": name})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"statistics": statistics})
+	responseBody, _, err := turboApiRequest(turbo_instance, auth, "POST", "/stats/"+clusterUuid, body)
+	if err != nil {
+		return clusterCapacity{}, err
+	}
+	var snapshots []map[string]interface{}
+	if err := json.Unmarshal(responseBody, &snapshots); err != nil {
+		return clusterCapacity{}, fmt.Errorf("decoding stats for cluster %s: %v", clusterUuid, err)
+	}
+	return parseClusterStats(snapshots), nil
+}
+
+// Works out the capacity from the stat snapshots. The snapshot for now (epoch CURRENT) is used if there is one,
+// otherwise the latest one.
+func parseClusterStats(snapshots []map[string]interface{}) clusterCapacity {
+	capacity := clusterCapacity{-1, -1, -1, -1, -1, -1, -1, -1}
+	if len(snapshots) == 0 {
+		return capacity
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return jsonString(snapshots[i], "date") < jsonString(snapshots[j], "date")
+	})
+	snapshot := snapshots[len(snapshots)-1]
+	for _, candidate := range snapshots {
+		if jsonString(candidate, "epoch") == "CURRENT" {
+			snapshot = candidate
+		}
+	}
+
+	statistics, _ := snapshot["statistics"].([]interface{})
+	for _, item := range statistics {
+		stat, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		used := statNumber(stat, "values", "avg")
+		if used < 0 {
+			used = statValue(stat)
+		}
+		switch jsonString(stat, "name") {
+		case "CPU":
+			capacity.cpuUtilization = utilization(used, statNumber(stat, "capacity", "total"))
+		case "Mem":
+			capacity.memUtilization = utilization(used, statNumber(stat, "capacity", "total"))
+		case "StorageAmount":
+			capacity.storageUtilization = utilization(used, statNumber(stat, "capacity", "total"))
+		case "CPUHeadroom":
+			capacity.cpuHeadroom = vmHeadroom(stat)
+		case "MemHeadroom":
+			capacity.memHeadroom = vmHeadroom(stat)
+		case "StorageHeadroom":
+			capacity.storageHeadroom = vmHeadroom(stat)
+		case "numHosts":
+			capacity.hostCount = statValue(stat)
+		case "numVMs":
+			capacity.vmCount = statValue(stat)
+		}
+	}
+	return capacity
+}
+
+// The number of VMs that still fit by a *Headroom stat's resource: the VMs that fit less those already there.
+// 0 if the cluster is already over, -1 if Turbo didn't give both numbers.
+func vmHeadroom(stat map[string]interface{}) float64 {
+	placed, fit := statValue(stat), statNumber(stat, "capacity", "total")
+	if placed < 0 || fit < 0 {
+		return -1
+	}
+	return math.Max(fit-placed, 0)
+}
+
+func utilization(used float64, capacity float64) float64 {
+	if used < 0 || capacity <= 0 {
+		return -1
+	}
+	return math.Round(used/capacity*10000) / 100
+}
+
+func clusterCapacityRow(timeString string, clusterName string, capacity clusterCapacity) map[string]interface{} {
+	// The cluster can only take as many more VMs as its tightest resource allows
+	vmHeadroom := -1.0
+	for _, headroom := range []float64{capacity.cpuHeadroom, capacity.memHeadroom, capacity.storageHeadroom} {
+		if headroom >= 0 && (vmHeadroom < 0 || headroom < vmHeadroom) {
+			vmHeadroom = headroom
+		}
+	}
+	return map[string]interface{}{
+		"Timestamp":           timeString,
+		"Cluster_Name":        clusterName,
+		"CPU_Utilization":     optionalNumber(capacity.cpuUtilization),
+		"Mem_Utilization":     optionalNumber(capacity.memUtilization),
+		"Storage_Utilization": optionalNumber(capacity.storageUtilization),
+		"CPU_Headroom":        optionalNumber(capacity.cpuHeadroom),
+		"Mem_Headroom":        optionalNumber(capacity.memHeadroom),
+		"Storage_Headroom":    optionalNumber(capacity.storageHeadroom),
+		"VM_Headroom":         optionalNumber(vmHeadroom),
+		"Host_Count":          optionalNumber(capacity.hostCount),
+		"VM_Count":            optionalNumber(capacity.vmCount),
+	}
+}
+
+// Stats Turbo didn't give are sent as null so they are blank in Power BI rather than 0
+func optionalNumber(value float64) interface{} {
+	if value < 0 {
+		return nil
+	}
+	return value
+}
+
+// Gets the capacity of each cluster and writes a row for each to the given file or Power BI URL.
+// A cluster whose stats can't be read still gets a row, with the stats left blank.
+func pushClusterCapacity(turbo_instance string, auth string, clusterNameMap map[string]string, timeString string, destination string) error {
+	var clusterUuids []string
+	for clusterUuid := range clusterNameMap {
+		clusterUuids = append(clusterUuids, clusterUuid)
+	}
+	sort.Slice(clusterUuids, func(i, j int) bool {
+		return clusterNameMap[clusterUuids[i]] < clusterNameMap[clusterUuids[j]]
+	})
+
+	var rows []map[string]interface{}
+	for _, clusterUuid := range clusterUuids {
+		capacity, err := getClusterCapacity(turbo_instance, auth, clusterUuid)
+		if err != nil {
+			fmt.Printf("### ERROR ### getting stats for cluster %s: %v\n", clusterNameMap[clusterUuid], err)
+			capacity = parseClusterStats(nil)
+		}
+		rows = append(rows, clusterCapacityRow(timeString, clusterNameMap[clusterUuid], capacity))
+	}
+
+	sink, err := newRowSink(destination, clusterCapacityColumns)
+	if err != nil {
+		return err
+	}
+	if err := sink.writeRows("cluster capacity", rows); err != nil {
+		sink.close()
+		return err
+	}
+	return sink.close()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Recorded POST /stats/{cluster} response with a past snapshot and the current one
+const clusterStatsResponse = `[
+	{"date": "2020-09-07T12:00:00Z", "statistics": [{"name": "numHosts", "value": 3}]},
+	{"date": "2020-09-08T12:00:00Z", "epoch": "CURRENT", "statistics": [
+		{"name": "CPU", "units": "MHz", "relatedEntityType": "PhysicalMachine", "capacity": {"avg": 100000, "total": 100000}, "values": {"avg": 45678, "max": 60000}, "value": 45678},
+		{"name": "Mem", "units": "KB", "relatedEntityType": "PhysicalMachine", "capacity": {"total": 2000}, "value": 1500},
+		{"name": "CPUHeadroom", "units": "VM", "value": 80, "capacity": {"total": 120}},
+		{"name": "MemHeadroom", "units": "VM", "value": 80, "capacity": {"total": 92}},
+		{"name": "StorageHeadroom", "units": "VM", "value": 80, "capacity": {"total": 75}},
+		{"name": "numHosts", "value": 4},
+		{"name": "numVMs", "value": 80}
+	]}
+]`
+
+func TestClusterCapacityRows(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/stats/101", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(clusterStatsResponse))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	turbo_instance := strings.TrimPrefix(server.URL, "https://")
+
+	fake, url := startFakePowerBi(t, "cluster_capacity")
+	fake.strict = true
+	// Cluster 102 has no stats endpoint so its stats are left blank
+	err := pushClusterCapacity(turbo_instance, "", map[string]string{"101": "East", "102": "West"}, "2020-09-08T12:00:00Z", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 2)
+	fake.assertRowsWhere(t, map[string]interface{}{
+		"Cluster_Name":        "East",
+		"CPU_Utilization":     45.68,
+		"Mem_Utilization":     75.0,
+		"Storage_Utilization": nil,
+		"CPU_Headroom":        40.0,
+		"Mem_Headroom":        12.0,
+		"Storage_Headroom":    0.0,
+		"VM_Headroom":         0.0,
+		"Host_Count":          4.0,
+		"VM_Count":            80.0,
+	}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Cluster_Name": "West", "VM_Headroom": nil, "Host_Count": nil}, 1)
+}
+
+func TestParseClusterStatsHeadroom(t *testing.T) {
+	// The VMs that fit less the VMs already in the cluster, blank without both
+	capacity := parseClusterStats([]map[string]interface{}{{"statistics": []interface{}{
+		map[string]interface{}{"name": "CPUHeadroom", "value": 30.0, "capacity": map[string]interface{}{"total": 50.0}},
+		map[string]interface{}{"name": "MemHeadroom", "value": 30.0},
+		map[string]interface{}{"name": "StorageHeadroom", "capacity": map[string]interface{}{"total": 50.0}},
+	}}})
+	if capacity.cpuHeadroom != 20 || capacity.memHeadroom != -1 || capacity.storageHeadroom != -1 {
+		t.Errorf("headroom = %v/%v/%v, want 20/-1/-1", capacity.cpuHeadroom, capacity.memHeadroom, capacity.storageHeadroom)
+	}
+	row := clusterCapacityRow("2020-09-08T12:00:00Z", "East", capacity)
+	if row["VM_Headroom"] != 20.0 || row["Mem_Headroom"] != nil {
+		t.Errorf("row = %v", row)
+	}
+}
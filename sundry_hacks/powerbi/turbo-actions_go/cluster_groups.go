@@ -0,0 +1,154 @@
+package main
+
+/*
+Looking up the Turbo group(s) the cluster tool reports on. common_groups.go finds each group by its UUID or name.
+An exact or ignore_case name that matches more than one group is an error that lists the candidates, so the UUID of the
+one meant can be given instead. Only with -group_match regex are all the groups the name matches used.
+
+The groups are then expanded into the clusters to report on: a cluster is used as is, a group of groups is expanded
+recursively and a group of hosts is turned into the clusters those hosts are in. A cluster found more than one way is only reported once.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The -cluster_group flag, which can be given more than once
+type clusterGroupList []string
+
+func (list *clusterGroupList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *clusterGroupList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Finds the groups for each of the given groups. With regex matching all the groups that match are used,
+// otherwise each must match just one group (see resolveGroup). Groups found more than once are only returned once.
+func resolveGroups(turbo_instance string, auth string, groups []string, match string) ([]turboGroup, error) {
+	var resolved []turboGroup
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		var found []turboGroup
+		if match == "regex" && !turboUuidPattern.MatchString(strings.TrimSpace(group)) {
+			candidates, err := findGroups(turbo_instance, auth, group, match)
+			if err != nil {
+				return nil, err
+			}
+			found = candidates
+		} else {
+			candidate, err := resolveGroup(turbo_instance, auth, group, match)
+			if err != nil {
+				return nil, err
+			}
+			found = []turboGroup{candidate}
+		}
+		for _, candidate := range found {
+			if !seen[candidate.uuid] {
+				seen[candidate.uuid] = true
+				resolved = append(resolved, candidate)
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// The clusters found in the groups
+type clusterExpansion struct {
+	// Cluster UUID -> Cluster Name
+	clusterNameMap map[string]string
+	// Cluster UUID -> how the cluster was found, e.g. "Prod Clusters > East Clusters" or "ESX Hosts (host esx01)"
+	clusterPaths map[string][]string
+	// Members that aren't clusters, groups or hosts and so were skipped
+	warnings []string
+}
+
+// Expands the groups into the clusters they contain.
+func expandClusterGroups(turbo_instance string, auth string, groups []turboGroup) (clusterExpansion, error) {
+	clusterNameMap := make(map[string]string)
+	clusterPaths := make(map[string][]string)
+	var warnings []string
+	visited := make(map[string]bool)
+	// Host UUID -> its clusters, since hosts can be in more than one of the groups
+	hostClusters := make(map[string][]turboGroup)
+
+	var expand func(group turboGroup, path string) error
+	expand = func(group turboGroup, path string) error {
+		if visited[group.uuid] {
+			return nil
+		}
+		visited[group.uuid] = true
+
+		if group.className == "Cluster" {
+			addCluster(clusterNameMap, clusterPaths, group, path)
+			return nil
+		}
+
+		members, unexpected, err := getTypedGroupMembers(turbo_instance, auth, group.uuid, "Cluster", "Group", "PhysicalMachine")
+		if err != nil {
+			return fmt.Errorf("getting members of group %s: %v", group, err)
+		}
+		for _, member := range unexpected {
+			warnings = append(warnings, fmt.Sprintf("skipping %s in group %s, it isn't a cluster, group or host", member, path))
+		}
+		for _, member := range members {
+			memberGroup := turboGroup{uuid: member.uuid, name: member.name, className: member.className}
+			switch member.className {
+			case "Cluster":
+				addCluster(clusterNameMap, clusterPaths, memberGroup, path)
+			case "Group":
+				if err := expand(memberGroup, path+" > "+memberGroup.name); err != nil {
+					return err
+				}
+			case "PhysicalMachine":
+				clusters, ok := hostClusters[memberGroup.uuid]
+				if !ok {
+					clusters, err = getHostClusters(turbo_instance, auth, memberGroup.uuid)
+					if err != nil {
+						return fmt.Errorf("getting the cluster of host %s: %v", memberGroup.name, err)
+					}
+					hostClusters[memberGroup.uuid] = clusters
+				}
+				for _, cluster := range clusters {
+					addCluster(clusterNameMap, clusterPaths, cluster, path+" (host "+memberGroup.name+")")
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, group := range groups {
+		if err := expand(group, group.name); err != nil {
+			return clusterExpansion{}, err
+		}
+	}
+	return clusterExpansion{clusterNameMap: clusterNameMap, clusterPaths: clusterPaths, warnings: warnings}, nil
+}
+
+func addCluster(clusterNameMap map[string]string, clusterPaths map[string][]string, cluster turboGroup, path string) {
+	clusterNameMap[cluster.uuid] = cluster.name
+	for _, existing := range clusterPaths[cluster.uuid] {
+		if existing == path {
+			return
+		}
+	}
+	clusterPaths[cluster.uuid] = append(clusterPaths[cluster.uuid], path)
+}
+
+// Returns the compute clusters the host is in.
+func getHostClusters(turbo_instance string, auth string, hostUuid string) ([]turboGroup, error) {
+	groups, err := turboApiGetAll(turbo_instance, auth, "GET", "/entities/"+hostUuid+"/groups", nil)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []turboGroup
+	for _, group := range groups {
+		if jsonString(group, "className") == "Cluster" {
+			clusters = append(clusters, turboGroupFromJson(group))
+		}
+	}
+	return clusters, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveGroupsRegexUsesAllMatches(t *testing.T) {
+	turbo_instance := startFakeTurboGroups(t, testGroups)
+	groups, err := resolveGroups(turbo_instance, "", []string{"^Prod Clusters", "Prod Clusters \\(East\\)", "284551234567004"}, "regex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuids []string
+	for _, group := range groups {
+		uuids = append(uuids, group.uuid)
+	}
+	// The first two both match 001 and the case insensitive search also finds 003
+	want := "284551234567001,284551234567002,284551234567003,284551234567004"
+	if strings.Join(uuids, ",") != want {
+		t.Errorf("got %v, want %s", uuids, want)
+	}
+}
+
+func TestExpandClusterGroups(t *testing.T) {
+	host := func(uuid, name string) map[string]interface{} {
+		return map[string]interface{}{"uuid": uuid, "displayName": name, "className": "PhysicalMachine"}
+	}
+	cluster := func(uuid, name string, hosts ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"uuid": uuid, "displayName": name, "className": "Cluster", "groupType": "PhysicalMachine", "members": hosts}
+	}
+	group := func(uuid, name, groupType string, members ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"uuid": uuid, "displayName": name, "className": "Group", "groupType": groupType, "members": members}
+	}
+	east := cluster("101", "East", host("1", "esx01"), host("2", "esx02"))
+	west := cluster("102", "West", host("3", "esx03"))
+	dr := cluster("103", "DR", host("4", "esx04"))
+	prod := group("201", "Prod Clusters", "Cluster", east, west)
+	all := group("202", "All Clusters", "Group", prod, group("203", "DR Clusters", "Cluster", dr))
+	hosts := group("204", "Patch Tuesday Hosts", "PhysicalMachine", host("2", "esx02"), host("4", "esx04"))
+	// A group that contains itself doesn't loop
+	loop := group("205", "Loop", "Group")
+	loop["members"] = []map[string]interface{}{group("205", "Loop", "Group"), west}
+	turbo_instance := startFakeTurboGroups(t, []map[string]interface{}{east, west, dr, prod, all, all["members"].([]map[string]interface{})[1], hosts, loop})
+
+	expansion, err := expandClusterGroups(turbo_instance, "", []turboGroup{
+		{uuid: "202", name: "All Clusters", className: "Group", groupType: "Group"},
+		{uuid: "204", name: "Patch Tuesday Hosts", className: "Group", groupType: "PhysicalMachine"},
+		{uuid: "205", name: "Loop", className: "Group", groupType: "Group"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterNameMap, clusterPaths := expansion.clusterNameMap, expansion.clusterPaths
+	want := map[string]string{"101": "East", "102": "West", "103": "DR"}
+	if len(clusterNameMap) != len(want) {
+		t.Errorf("got clusters %v, want %v", clusterNameMap, want)
+	}
+	for uuid, name := range want {
+		if clusterNameMap[uuid] != name {
+			t.Errorf("cluster %s = %q, want %q", uuid, clusterNameMap[uuid], name)
+		}
+	}
+	wantPaths := map[string]string{
+		"101": "All Clusters > Prod Clusters; Patch Tuesday Hosts (host esx02)",
+		"102": "All Clusters > Prod Clusters; Loop",
+		"103": "All Clusters > DR Clusters; Patch Tuesday Hosts (host esx04)",
+	}
+	for uuid, paths := range wantPaths {
+		if got := strings.Join(clusterPaths[uuid], "; "); got != paths {
+			t.Errorf("paths for %s = %q, want %q", uuid, got, paths)
+		}
+	}
+}
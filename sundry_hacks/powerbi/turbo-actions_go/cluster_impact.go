@@ -0,0 +1,86 @@
+package main
+
+/*
+Works out which applications a cluster action affects, using the same application to server mapping CSV as the resize tool.
+
+- An action on a VM (e.g. a MOVE) affects the applications that VM is mapped to.
+- An action on a host or datastore (e.g. SUSPEND or PROVISION) affects the applications of the VMs on it.
+
+Servers are matched to the mapping by Server_UUID if the CSV has one for the server, otherwise by name (not case sensitive).
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Server UUID or name -> App Names
+type appImpactIndex struct {
+	byUuid map[string][]string
+	byName map[string][]string
+}
+
+func newAppImpactIndex(mapping appMapping) appImpactIndex {
+	index := appImpactIndex{byUuid: make(map[string][]string), byName: make(map[string][]string)}
+	for appId, serverNames := range mapping.appId2Servers {
+		appName := mapping.appId2Name[appId]
+		for _, serverName := range serverNames {
+			if serverUuid := mapping.appServerUuids[appId][serverName]; serverUuid != "" {
+				index.byUuid[serverUuid] = appendUnique(index.byUuid[serverUuid], appName)
+			} else {
+				key := strings.ToLower(serverName)
+				index.byName[key] = appendUnique(index.byName[key], appName)
+			}
+		}
+	}
+	return index
+}
+
+// The applications the server is mapped to. The slice is the caller's to change.
+func (index appImpactIndex) apps(serverUuid string, serverName string) []string {
+	apps := append([]string(nil), index.byUuid[serverUuid]...)
+	for _, app := range index.byName[strings.ToLower(serverName)] {
+		apps = appendUnique(apps, app)
+	}
+	return apps
+}
+
+// Fills in the impacted applications of each action. The VMs on a host or datastore are only looked up once.
+// If they can't be found the action's impacted applications are left blank with a warning.
+// Returns the number of hosts or datastores whose VMs couldn't be found.
+func setImpactedApplications(turbo_instance string, auth string, index appImpactIndex, clusterActionsMap map[string][]Action) int {
+	// Entity UUID -> the VMs on it
+	entityVms := make(map[string][]map[string]interface{})
+	// Entity UUID -> true if its VMs couldn't be found
+	failedEntities := make(map[string]bool)
+	for _, actions := range clusterActionsMap {
+		for i := range actions {
+			action := &actions[i]
+			var apps []string
+			if action.entityType == "VirtualMachine" {
+				apps = index.apps(action.entityUuid, action.entityName)
+			} else if action.entityUuid != "" {
+				vms, ok := entityVms[action.entityUuid]
+				if !ok && !failedEntities[action.entityUuid] {
+					var err error
+					vms, err = turboScopedSearch(turbo_instance, auth, "VirtualMachine", action.entityUuid)
+					if err != nil {
+						fmt.Printf("### ERROR ### finding the VMs on %s (%s), so its actions won't have impacted applications: %v\n", action.entityName, action.entityUuid, err)
+						failedEntities[action.entityUuid] = true
+					} else {
+						entityVms[action.entityUuid] = vms
+					}
+				}
+				for _, vm := range vms {
+					for _, app := range index.apps(jsonString(vm, "uuid"), jsonString(vm, "displayName")) {
+						apps = appendUnique(apps, app)
+					}
+				}
+			}
+			sort.Strings(apps)
+			action.impactedApps = strings.Join(apps, "; ")
+		}
+	}
+	return len(failedEntities)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestImpactedApplications(t *testing.T) {
+	// The VMs on each host, as found by a search scoped to the host
+	hostVms := map[string][]map[string]interface{}{
+		"h1": {{"uuid": "v1", "displayName": "PAYROLL-DB01"}, {"uuid": "v2", "displayName": "hr-web01"}},
+		"h2": {{"uuid": "v3", "displayName": "unmapped01"}},
+	}
+	searches := 0
+	// Searches scoped to these fail
+	failingHosts := map[string]bool{"h3": true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+		searches++
+		body, _ := ioutil.ReadAll(r.Body)
+		var search struct {
+			Scope []string `json:"scope"`
+		}
+		json.Unmarshal(body, &search)
+		if failingHosts[search.Scope[0]] {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		data, _ := json.Marshal(hostVms[search.Scope[0]])
+		w.Write(data)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	mapping := newAppMapping()
+	mapping.appId2Name = map[string]string{"1": "Payroll", "2": "HR", "3": "Payroll Reports"}
+	mapping.appId2Servers = map[string][]string{"1": {"payroll-db01"}, "2": {"hr-web01", "renamed-vm"}, "3": {"payroll-db01"}}
+	mapping.appServerUuids = map[string]map[string]string{"2": {"renamed-vm": "v9"}}
+
+	clusterActionsMap := map[string][]Action{
+		"101": {
+			{entityUuid: "h1", entityName: "esx01", entityType: "PhysicalMachine", actionType: "SUSPEND"},
+			{entityUuid: "h1", entityName: "esx01", entityType: "PhysicalMachine", actionType: "PROVISION"},
+			{entityUuid: "h2", entityName: "esx02", entityType: "PhysicalMachine", actionType: "SUSPEND"},
+			{entityUuid: "v9", entityName: "old-name", entityType: "VirtualMachine", actionType: "MOVE"},
+			{entityUuid: "h3", entityName: "esx03", entityType: "PhysicalMachine", actionType: "SUSPEND"},
+			{entityUuid: "h3", entityName: "esx03", entityType: "PhysicalMachine", actionType: "PROVISION"},
+		},
+	}
+	index := newAppImpactIndex(mapping)
+	failed := setImpactedApplications(strings.TrimPrefix(server.URL, "https://"), "", index, clusterActionsMap)
+	if failed != 1 {
+		t.Errorf("%d hosts failed, want 1", failed)
+	}
+
+	// The host whose VMs couldn't be found doesn't stop the others
+	want := []string{"HR; Payroll; Payroll Reports", "HR; Payroll; Payroll Reports", "", "HR", "", ""}
+	for i, action := range clusterActionsMap["101"] {
+		if action.impactedApps != want[i] {
+			t.Errorf("action %d impacted %q, want %q", i, action.impactedApps, want[i])
+		}
+	}
+	if searches != 3 {
+		t.Errorf("searched for VMs %d times, want once per host", searches)
+	}
+	// Sorting and adding to the impacted applications mustn't change the index
+	if apps := index.apps("v9", "hr-web01"); strings.Join(apps, "; ") != "HR" {
+		t.Errorf("index changed: %v", apps)
+	}
+
+	fake, url := startFakePowerBi(t, "cluster_impact")
+	fake.strict = true
+	pushPowerBiData(map[string]string{"101": "East"}, clusterActionsMap, "2020-09-08T12:00:00Z", true, url)
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowsWhere(t, map[string]interface{}{"Impacted_Applications": "HR"}, 1)
+}
+
+func TestAppImpactIndexAppsIsACopy(t *testing.T) {
+	byUuid := make([]string, 0, 4)
+	index := appImpactIndex{byUuid: map[string][]string{"v1": append(byUuid, "Zeta", "Alpha")}, byName: map[string][]string{"db01": {"Beta"}}}
+
+	apps := index.apps("v1", "DB01")
+	sort.Strings(apps)
+	apps[0] = "Changed"
+	index.apps("v1", "")
+
+	if got := strings.Join(index.byUuid["v1"], ","); got != "Zeta,Alpha" {
+		t.Errorf("index changed to %s", got)
+	}
+	if got := strings.Join(index.apps("v1", "db01"), ","); got != "Zeta,Alpha,Beta" {
+		t.Errorf("apps = %s", got)
+	}
+}
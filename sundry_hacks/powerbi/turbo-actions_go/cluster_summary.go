@@ -0,0 +1,83 @@
+package main
+
+/*
+One summary row per cluster per run with the number of actions by type and by severity.
+Clusters without any actions get a row of zeros so the dashboard can show the healthy clusters too.
+*/
+
+import (
+	"sort"
+	"strings"
+)
+
+var clusterSummaryColumns = []string{"Timestamp", "Cluster_Name", "Action_Count", "Provision_Count", "Suspend_Count", "Move_Count", "Resize_Count", "Other_Count", "Critical_Count", "Major_Count", "Minor_Count", "Normal_Count"}
+
+// Action type -> the column it is counted in. Anything else is counted in Other_Count.
+var clusterSummaryTypeColumns = map[string]string{
+	"PROVISION":  "Provision_Count",
+	"SUSPEND":    "Suspend_Count",
+	"MOVE":       "Move_Count",
+	"RESIZE":     "Resize_Count",
+	"RIGHT_SIZE": "Resize_Count",
+	"SCALE":      "Resize_Count",
+}
+
+// Severity -> the column it is counted in
+var clusterSummarySeverityColumns = map[string]string{
+	"CRITICAL": "Critical_Count",
+	"MAJOR":    "Major_Count",
+	"MINOR":    "Minor_Count",
+	"NORMAL":   "Normal_Count",
+}
+
+func clusterSummaryRow(timeString string, clusterName string, actions []Action) map[string]interface{} {
+	row := map[string]interface{}{
+		"Timestamp":    timeString,
+		"Cluster_Name": clusterName,
+	}
+	counts := make(map[string]float64)
+	for _, column := range clusterSummaryColumns[2:] {
+		counts[column] = 0
+	}
+	for _, action := range actions {
+		counts["Action_Count"]++
+		if column, ok := clusterSummaryTypeColumns[strings.ToUpper(action.actionType)]; ok {
+			counts[column]++
+		} else {
+			counts["Other_Count"]++
+		}
+		if column, ok := clusterSummarySeverityColumns[strings.ToUpper(action.severity)]; ok {
+			counts[column]++
+		}
+	}
+	for column, count := range counts {
+		row[column] = count
+	}
+	return row
+}
+
+// Writes a summary row for every cluster, including those with no actions, to the given file or Power BI URL.
+func pushClusterSummary(clusterNameMap map[string]string, clusterActionsMap map[string][]Action, timeString string, destination string) error {
+	var clusterUuids []string
+	for clusterUuid := range clusterNameMap {
+		clusterUuids = append(clusterUuids, clusterUuid)
+	}
+	sort.Slice(clusterUuids, func(i, j int) bool {
+		return clusterNameMap[clusterUuids[i]] < clusterNameMap[clusterUuids[j]]
+	})
+
+	var rows []map[string]interface{}
+	for _, clusterUuid := range clusterUuids {
+		rows = append(rows, clusterSummaryRow(timeString, clusterNameMap[clusterUuid], clusterActionsMap[clusterUuid]))
+	}
+
+	sink, err := newRowSink(destination, clusterSummaryColumns)
+	if err != nil {
+		return err
+	}
+	if err := sink.writeRows("cluster summary", rows); err != nil {
+		sink.close()
+		return err
+	}
+	return sink.close()
+}
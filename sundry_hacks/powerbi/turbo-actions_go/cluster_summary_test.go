@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestClusterSummaryIncludesClustersWithoutActions(t *testing.T) {
+	fake, url := startFakePowerBi(t, "cluster_summary")
+	fake.strict = true
+
+	clusterNameMap := map[string]string{"101": "East", "102": "West"}
+	clusterActionsMap := map[string][]Action{
+		"101": {
+			{actionType: "PROVISION", severity: "CRITICAL"},
+			{actionType: "MOVE", severity: "MINOR"},
+			{actionType: "MOVE", severity: "MINOR"},
+			{actionType: "RECONFIGURE", severity: "MAJOR"},
+		},
+	}
+	if err := pushClusterSummary(clusterNameMap, clusterActionsMap, "2020-09-08T12:00:00Z", url); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 2)
+	fake.assertRowsWhere(t, map[string]interface{}{
+		"Cluster_Name":    "East",
+		"Action_Count":    4.0,
+		"Provision_Count": 1.0,
+		"Move_Count":      2.0,
+		"Suspend_Count":   0.0,
+		"Other_Count":     1.0,
+		"Critical_Count":  1.0,
+		"Major_Count":     1.0,
+		"Minor_Count":     2.0,
+		"Normal_Count":    0.0,
+	}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Cluster_Name": "West", "Action_Count": 0.0, "Resize_Count": 0.0, "Critical_Count": 0.0}, 1)
+}
@@ -0,0 +1,167 @@
+package main
+
+/*
+Builder for the body of the Turbo actions API calls (POST /markets/{uuid}/actions, /groups/{uuid}/actions, etc.),
+i.e. the ActionApiInputDTO.
+
+The JSON names are the API's own so the "actions" section of a -config file reads the same as an API call body, e.g.
+  {"actionTypeList": ["RESIZE"], "environmentType": "CLOUD", "riskSubCategoryList": ["Performance Assurance"]}
+
+Values are checked against the values the API accepts so a typo fails up front instead of quietly returning no actions.
+Related entity types are entity class names (e.g. VirtualMachine) and are passed through as given.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type actionQuery struct {
+	ActionTypes        []string `json:"actionTypeList,omitempty"`
+	EnvironmentType    string   `json:"environmentType,omitempty"`
+	RiskSeverities     []string `json:"riskSeverityList,omitempty"`
+	RiskSubCategories  []string `json:"riskSubCategoryList,omitempty"`
+	RelatedEntityTypes []string `json:"relatedEntityTypes,omitempty"`
+	CostType           string   `json:"costType,omitempty"`
+	ActionStates       []string `json:"actionStateList,omitempty"`
+	DetailLevel        string   `json:"detailLevel,omitempty"`
+	// For actions that have been executed (or failed): only those from this time window. RFC3339.
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty"`
+}
+
+var actionTypeValues = []string{"ACTIVATE", "ALLOCATE", "BUY_RI", "DEACTIVATE", "DELETE", "MOVE", "PROVISION", "RECONFIGURE", "RESIZE", "RIGHT_SIZE", "SCALE", "START", "SUSPEND"}
+var environmentTypeValues = []string{"CLOUD", "HYBRID", "ONPREM"}
+var riskSeverityValues = []string{"CRITICAL", "MAJOR", "MINOR", "NORMAL"}
+var riskSubCategoryValues = []string{"Compliance", "Efficiency Improvement", "Performance Assurance", "Prevention"}
+var costTypeValues = []string{"INVESTMENT", "SAVINGS"}
+var actionStateValues = []string{"ACCEPTED", "CLEARED", "DISABLED", "FAILED", "IN_PROGRESS", "QUEUED", "READY", "RECOMMEND", "REJECTED", "SUCCEEDED"}
+var detailLevelValues = []string{"COMPACT", "EXECUTION", "STANDARD"}
+
+// Returns a query for the given action types across all environments with enough detail to show the from and to of each action.
+func newActionQuery(actionTypes ...string) actionQuery {
+	return actionQuery{ActionTypes: actionTypes, EnvironmentType: "HYBRID", DetailLevel: "EXECUTION"}
+}
+
+// Returns a copy of the query with the fields set in overrides replacing the query's.
+func (query actionQuery) withOverrides(overrides actionQuery) actionQuery {
+	if len(overrides.ActionTypes) > 0 {
+		query.ActionTypes = overrides.ActionTypes
+	}
+	if overrides.EnvironmentType != "" {
+		query.EnvironmentType = overrides.EnvironmentType
+	}
+	if len(overrides.RiskSeverities) > 0 {
+		query.RiskSeverities = overrides.RiskSeverities
+	}
+	if len(overrides.RiskSubCategories) > 0 {
+		query.RiskSubCategories = overrides.RiskSubCategories
+	}
+	if len(overrides.RelatedEntityTypes) > 0 {
+		query.RelatedEntityTypes = overrides.RelatedEntityTypes
+	}
+	if overrides.CostType != "" {
+		query.CostType = overrides.CostType
+	}
+	if len(overrides.ActionStates) > 0 {
+		query.ActionStates = overrides.ActionStates
+	}
+	if overrides.DetailLevel != "" {
+		query.DetailLevel = overrides.DetailLevel
+	}
+	if overrides.StartTime != "" {
+		query.StartTime = overrides.StartTime
+	}
+	if overrides.EndTime != "" {
+		query.EndTime = overrides.EndTime
+	}
+	return query
+}
+
+// Puts the values in the case the API wants and checks them.
+func (query actionQuery) normalized() (actionQuery, error) {
+	var err error
+	if query.ActionTypes, err = checkQueryValues("action type", query.ActionTypes, actionTypeValues); err != nil {
+		return query, err
+	}
+	if query.EnvironmentType, err = checkQueryValue("environment type", query.EnvironmentType, environmentTypeValues); err != nil {
+		return query, err
+	}
+	if query.RiskSeverities, err = checkQueryValues("risk severity", query.RiskSeverities, riskSeverityValues); err != nil {
+		return query, err
+	}
+	if query.RiskSubCategories, err = checkQueryValues("risk sub-category", query.RiskSubCategories, riskSubCategoryValues); err != nil {
+		return query, err
+	}
+	if query.CostType, err = checkQueryValue("cost type", query.CostType, costTypeValues); err != nil {
+		return query, err
+	}
+	if query.ActionStates, err = checkQueryValues("action state", query.ActionStates, actionStateValues); err != nil {
+		return query, err
+	}
+	if query.DetailLevel, err = checkQueryValue("detail level", query.DetailLevel, detailLevelValues); err != nil {
+		return query, err
+	}
+	for _, entityType := range query.RelatedEntityTypes {
+		if strings.TrimSpace(entityType) == "" {
+			return query, fmt.Errorf("empty related entity type")
+		}
+	}
+	return query, nil
+}
+
+// Returns the JSON body for the actions API call.
+func (query actionQuery) payload() ([]byte, error) {
+	checked, err := query.normalized()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(checked)
+}
+
+func checkQueryValues(what string, values []string, allowed []string) ([]string, error) {
+	var checked []string
+	for _, value := range values {
+		value, err := checkQueryValue(what, value, allowed)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			checked = append(checked, value)
+		}
+	}
+	return checked, nil
+}
+
+// Matches the value to one of the allowed values ignoring case, spaces and underscores.
+func checkQueryValue(what string, value string, allowed []string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	for _, allowedValue := range allowed {
+		if queryValueKey(allowedValue) == queryValueKey(value) {
+			return allowedValue, nil
+		}
+	}
+	sorted := append([]string(nil), allowed...)
+	sort.Strings(sorted)
+	return "", fmt.Errorf("unknown %s %q (use one of: %s)", what, value, strings.Join(sorted, ", "))
+}
+
+func queryValueKey(value string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToUpper(value))
+}
+
+// Splits a comma separated flag value into a list. An empty value gives an empty list.
+func splitFlagList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
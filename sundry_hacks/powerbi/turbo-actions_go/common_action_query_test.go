@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestActionQueryDefaultPayload(t *testing.T) {
+	payload, err := newActionQuery("RESIZE", "RIGHT_SIZE", "SCALE").payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"actionTypeList":["RESIZE","RIGHT_SIZE","SCALE"],"environmentType":"HYBRID","detailLevel":"EXECUTION"}`
+	if string(payload) != want {
+		t.Errorf("payload = %s, want %s", payload, want)
+	}
+}
+
+func TestActionQueryOverridesAndNormalizedValues(t *testing.T) {
+	config := actionQuery{EnvironmentType: "CLOUD", RiskSeverities: []string{"CRITICAL"}}
+	flags := actionQuery{
+		ActionTypes:        splitFlagList("scale, right_size"),
+		RiskSeverities:     splitFlagList("major,Critical"),
+		RiskSubCategories:  splitFlagList("performance assurance,EFFICIENCY_IMPROVEMENT"),
+		RelatedEntityTypes: splitFlagList("VirtualMachine"),
+		CostType:           "savings",
+		ActionStates:       splitFlagList("ready"),
+	}
+	payload, err := newActionQuery("RESIZE").withOverrides(config).withOverrides(flags).payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"actionTypeList":["SCALE","RIGHT_SIZE"],"environmentType":"CLOUD","riskSeverityList":["MAJOR","CRITICAL"],` +
+		`"riskSubCategoryList":["Performance Assurance","Efficiency Improvement"],"relatedEntityTypes":["VirtualMachine"],` +
+		`"costType":"SAVINGS","actionStateList":["READY"],"detailLevel":"EXECUTION"}`
+	if string(payload) != want {
+		t.Errorf("payload = %s\nwant %s", payload, want)
+	}
+}
+
+func TestActionQueryRejectsUnknownValues(t *testing.T) {
+	_, err := newActionQuery("RESIZE").withOverrides(actionQuery{EnvironmentType: "ONPREMISES"}).payload()
+	if err == nil || !strings.Contains(err.Error(), "environment type") {
+		t.Errorf("err = %v, want an unknown environment type error", err)
+	}
+	if _, err := newActionQuery("RESIZ").payload(); err == nil {
+		t.Errorf("expected an error for an unknown action type")
+	}
+}
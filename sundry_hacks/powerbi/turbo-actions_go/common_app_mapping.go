@@ -0,0 +1,282 @@
+package main
+
+/*
+Reads the application (aka component) to server mapping CSV.
+
+The CSV needs a header line followed by one line per application/server pair. The columns are found by name:
+- Component_Id (required)
+- Component_Name (required)
+- Server_Name (required)
+- Server_UUID (optional)
+
+Two lines in one application with the same Server_Name and different Server_UUIDs are two servers. The second is listed
+as "<Server_Name> (<Server_UUID>)" so each server's actions are reported once.
+
+Header names are matched case-insensitively and other names for them can be given as aliases in the config file.
+A byte order mark (as added by Excel when saving as "CSV UTF-8") is ignored. The delimiter may be comma, semicolon or tab
+and is worked out from the header line unless set in the config file.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Column names as documented. These are what the header aliases in the config file map to.
+const (
+	componentIdColName   = "Component_Id"
+	componentNameColName = "Component_Name"
+	serverNameColName    = "Server_Name"
+	serverUuidColName    = "Server_UUID"
+)
+
+// CSV related settings from the config file, e.g.
+//
+//	"csv": {
+//	  "delimiter": "auto",
+//	  "header_aliases": {"Component_Id": ["App ID", "Application_Id"], "Server_Name": ["Hostname"]}
+//	}
+type csvMappingConfig struct {
+	// "auto" (or empty), ",", ";", "tab" or "\t"
+	Delimiter string `json:"delimiter"`
+	// Documented column name -> other names that may be used for it in the header
+	HeaderAliases map[string][]string `json:"header_aliases"`
+}
+
+// Application to server mapping, whether from the CSV or another mapping source
+type appMapping struct {
+	// App ID -> App Name
+	appId2Name map[string]string
+	// App ID -> Server Names in the order found in the CSV
+	appId2Servers map[string][]string
+	// App ID -> Server Name -> Server UUID. Only for rows that have a Server_UUID.
+	appServerUuids map[string]map[string]string
+	// Lines that could not be used, e.g. "line 12: missing Server_Name"
+	badLines []string
+}
+
+func newAppMapping() appMapping {
+	return appMapping{
+		appId2Name:     make(map[string]string),
+		appId2Servers:  make(map[string][]string),
+		appServerUuids: make(map[string]map[string]string),
+	}
+}
+
+// Adds a server whose UUID is known to the application, for mapping sources that get the servers from Turbo.
+// Another server with the same name in the application is listed as "<name> (<uuid>)" so both servers' actions are
+// reported. Returns the name the server was listed under, or "" if the server is already in the application.
+func (mapping appMapping) addServer(appId string, serverName string, serverUuid string) string {
+	if mapping.appServerUuids[appId] == nil {
+		mapping.appServerUuids[appId] = make(map[string]string)
+	}
+	listedName := serverName
+	if existing, ok := mapping.appServerUuids[appId][serverName]; ok {
+		if existing == serverUuid {
+			return ""
+		}
+		listedName = serverName + " (" + serverUuid + ")"
+		if _, ok := mapping.appServerUuids[appId][listedName]; ok {
+			return ""
+		}
+	}
+	mapping.appId2Servers[appId] = append(mapping.appId2Servers[appId], listedName)
+	mapping.appServerUuids[appId][listedName] = serverUuid
+	return listedName
+}
+
+// Adds a server from a CSV line to the application. A line repeating a server already in the application is ignored.
+// Lines with the same Server_Name but different Server_UUIDs are different servers and both are kept (see addServer).
+// A Server_UUID for a name an earlier line gave without one says which server that line meant.
+func (mapping appMapping) addCsvServer(appId string, serverName string, serverUuid string) {
+	listed := false
+	for _, existing := range mapping.appId2Servers[appId] {
+		if existing == serverName {
+			listed = true
+		}
+	}
+	_, hasUuid := mapping.appServerUuids[appId][serverName]
+	switch {
+	case serverUuid == "":
+		if !listed {
+			mapping.appId2Servers[appId] = append(mapping.appId2Servers[appId], serverName)
+		}
+	case listed && !hasUuid:
+		if mapping.appServerUuids[appId] == nil {
+			mapping.appServerUuids[appId] = make(map[string]string)
+		}
+		mapping.appServerUuids[appId][serverName] = serverUuid
+	default:
+		mapping.addServer(appId, serverName, serverUuid)
+	}
+}
+
+var utf8Bom = []byte("\ufeff")
+
+// Reads the mapping CSV in one pass.
+// An error is returned if the file can't be read or the header is missing a required column.
+// Lines that can't be used are skipped and listed in badLines.
+func readAppMappingCsv(csv_file string, config csvMappingConfig) (appMapping, error) {
+	mapping := newAppMapping()
+
+	appservercsv, err := os.Open(csv_file)
+	if err != nil {
+		return mapping, fmt.Errorf("error opening file %s: %v", csv_file, err)
+	}
+	defer appservercsv.Close()
+
+	buffered := bufio.NewReader(appservercsv)
+	if start, _ := buffered.Peek(len(utf8Bom)); bytes.Equal(start, utf8Bom) {
+		buffered.Discard(len(utf8Bom))
+	}
+
+	delimiter, err := csvDelimiter(config.Delimiter, buffered)
+	if err != nil {
+		return mapping, err
+	}
+
+	readfile := csv.NewReader(buffered)
+	readfile.Comma = delimiter
+	// Rows with the wrong number of fields are reported below rather than failing the read
+	readfile.FieldsPerRecord = -1
+	readfile.TrimLeadingSpace = true
+
+	header, err := readfile.Read()
+	if err != nil {
+		return mapping, fmt.Errorf("could not read the header line of %s: %v", csv_file, err)
+	}
+	columns, err := findCsvColumns(header, config.HeaderAliases)
+	if err != nil {
+		return mapping, err
+	}
+
+	for {
+		record, err := readfile.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// csv.ParseError already includes the line number
+			mapping.badLines = append(mapping.badLines, err.Error())
+			continue
+		}
+		line, _ := readfile.FieldPos(0)
+
+		if len(record) != len(header) {
+			mapping.badLines = append(mapping.badLines, fmt.Sprintf("line %d: expected %d fields, found %d", line, len(header), len(record)))
+			continue
+		}
+
+		appId := strings.TrimSpace(record[columns[componentIdColName]])
+		appName := strings.TrimSpace(record[columns[componentNameColName]])
+		serverName := strings.TrimSpace(record[columns[serverNameColName]])
+		if appId == "" || serverName == "" {
+			var missing []string
+			if appId == "" {
+				missing = append(missing, componentIdColName)
+			}
+			if serverName == "" {
+				missing = append(missing, serverNameColName)
+			}
+			mapping.badLines = append(mapping.badLines, fmt.Sprintf("line %d: missing %s", line, strings.Join(missing, " and ")))
+			continue
+		}
+
+		mapping.appId2Name[appId] = appName
+		serverUuid := ""
+		if uuidColumn, ok := columns[serverUuidColName]; ok {
+			serverUuid = strings.TrimSpace(record[uuidColumn])
+		}
+		mapping.addCsvServer(appId, serverName, serverUuid)
+	}
+
+	return mapping, nil
+}
+
+// Works out the delimiter from the config setting or, for "auto", from whichever of comma, semicolon or tab is most common in the header line.
+func csvDelimiter(setting string, buffered *bufio.Reader) (rune, error) {
+	switch setting {
+	case ",":
+		return ',', nil
+	case ";":
+		return ';', nil
+	case "tab", "\t", "\\t":
+		return '\t', nil
+	case "", "auto":
+	default:
+		return ',', fmt.Errorf("unsupported CSV delimiter %q (use auto, \",\", \";\" or tab)", setting)
+	}
+
+	// Peek far enough to see the whole header line without consuming it
+	peeked, _ := buffered.Peek(4096)
+	headerLine := string(peeked)
+	if end := strings.IndexAny(headerLine, "\r\n"); end >= 0 {
+		headerLine = headerLine[:end]
+	}
+	delimiter := ','
+	most := strings.Count(headerLine, ",")
+	for _, candidate := range []rune{';', '\t'} {
+		if count := strings.Count(headerLine, string(candidate)); count > most {
+			delimiter = candidate
+			most = count
+		}
+	}
+	return delimiter, nil
+}
+
+// Finds the index of each known column in the header line.
+// Returns a map of documented column name -> index. The optional Server_UUID column is only in the map if found.
+func findCsvColumns(header []string, headerAliases map[string][]string) (map[string]int, error) {
+	// lower-cased header name or alias -> documented column name
+	names := make(map[string]string)
+	for _, column := range []string{componentIdColName, componentNameColName, serverNameColName, serverUuidColName} {
+		names[strings.ToLower(column)] = column
+	}
+	for column, aliases := range headerAliases {
+		documented, ok := names[strings.ToLower(column)]
+		if !ok {
+			return nil, fmt.Errorf("header alias given for unknown column %s", column)
+		}
+		for _, alias := range aliases {
+			names[strings.ToLower(strings.TrimSpace(alias))] = documented
+		}
+	}
+
+	columns := make(map[string]int)
+	for index, content := range header {
+		// Excel sometimes leaves the BOM in the first cell when the file was re-encoded
+		content = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(content, "\ufeff")))
+		if column, ok := names[content]; ok {
+			if _, dupe := columns[column]; dupe {
+				return nil, fmt.Errorf("more than one column in the header line is %s", column)
+			}
+			columns[column] = index
+		}
+	}
+
+	var missing []string
+	for _, column := range []string{componentIdColName, componentNameColName, serverNameColName} {
+		if _, ok := columns[column]; !ok {
+			missing = append(missing, "\""+column+"\"")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no %s column found on the first line of the CSV (header line is: %s)", strings.Join(missing, ", "), strings.Join(header, ","))
+	}
+	return columns, nil
+}
+
+// Adds the value to the list unless it's already there
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
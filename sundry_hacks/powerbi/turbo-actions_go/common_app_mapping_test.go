@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadAppMappingCsvBomAndHeaderCase(t *testing.T) {
+	mapping, err := readAppMappingCsv(filepath.Join("testdata", "csv", "bom_lowercase_headers.csv"), csvMappingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping.badLines) != 0 {
+		t.Errorf("bad lines = %v, want none", mapping.badLines)
+	}
+	if !reflect.DeepEqual(mapping.appId2Servers["APP1"], []string{"pay01", "pay02"}) {
+		t.Errorf("APP1 servers = %v", mapping.appId2Servers["APP1"])
+	}
+	if mapping.appId2Name["APP2"] != "Web, Store" {
+		t.Errorf("APP2 name = %q", mapping.appId2Name["APP2"])
+	}
+}
+
+func TestReadAppMappingCsvSemicolonAliasesAndBadLines(t *testing.T) {
+	config := csvMappingConfig{
+		HeaderAliases: map[string][]string{
+			"component_id":   {"App ID"},
+			"Component_Name": {"application"},
+			"Server_Name":    {"Hostname"},
+		},
+	}
+	mapping, err := readAppMappingCsv(filepath.Join("testdata", "csv", "semicolon_aliases_bad_lines.csv"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantBad := []string{
+		"line 4: expected 4 fields, found 3",
+		"line 5: missing Component_Id",
+		"line 6: missing Server_Name",
+	}
+	if !reflect.DeepEqual(mapping.badLines, wantBad) {
+		t.Errorf("bad lines = %v, want %v", mapping.badLines, wantBad)
+	}
+	if !reflect.DeepEqual(mapping.appId2Servers["APP1"], []string{"pay01", "pay02"}) {
+		t.Errorf("APP1 servers = %v", mapping.appId2Servers["APP1"])
+	}
+	if !reflect.DeepEqual(mapping.appServerUuids["APP1"], map[string]string{"pay01": "4211-aaaa"}) {
+		t.Errorf("APP1 server UUIDs = %v", mapping.appServerUuids["APP1"])
+	}
+	if mapping.appServerUuids["APP3"]["batch01"] != "4211-bbbb" {
+		t.Errorf("APP3 server UUIDs = %v", mapping.appServerUuids["APP3"])
+	}
+	if _, ok := mapping.appId2Name["APP2"]; ok {
+		t.Errorf("APP2 should have been skipped, got %v", mapping.appId2Servers["APP2"])
+	}
+}
+
+func TestReadAppMappingCsvTabDelimitedParseError(t *testing.T) {
+	mapping, err := readAppMappingCsv(filepath.Join("testdata", "csv", "tab_delimited.csv"), csvMappingConfig{Delimiter: "tab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping.badLines) != 1 || !strings.Contains(mapping.badLines[0], "line 3") {
+		t.Errorf("bad lines = %v, want the bare quote on line 3", mapping.badLines)
+	}
+	if !reflect.DeepEqual(mapping.appId2Servers["APP2"], []string{"web02"}) {
+		t.Errorf("APP2 servers = %v", mapping.appId2Servers["APP2"])
+	}
+}
+
+func TestReadAppMappingCsvMissingHeaders(t *testing.T) {
+	_, err := readAppMappingCsv(filepath.Join("testdata", "csv", "missing_headers.csv"), csvMappingConfig{})
+	if err == nil || !strings.Contains(err.Error(), `"Component_Id", "Component_Name", "Server_Name"`) {
+		t.Errorf("err = %v, want all three required columns reported missing", err)
+	}
+}
+
+func TestReadAppMappingCsvDuplicateServerNames(t *testing.T) {
+	mapping, err := readAppMappingCsv(filepath.Join("testdata", "csv", "duplicate_server_names.csv"), csvMappingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second db01 is another server so is listed by its UUID as well. Repeated lines are only listed once.
+	if !reflect.DeepEqual(mapping.appId2Servers["APP1"], []string{"db01", "db01 (uuid-west)", "pay01"}) {
+		t.Errorf("APP1 servers = %v", mapping.appId2Servers["APP1"])
+	}
+	if !reflect.DeepEqual(mapping.appServerUuids["APP1"], map[string]string{"db01": "uuid-east", "db01 (uuid-west)": "uuid-west"}) {
+		t.Errorf("APP1 server UUIDs = %v", mapping.appServerUuids["APP1"])
+	}
+	// A later line with the UUID says which web01 the first line meant
+	if !reflect.DeepEqual(mapping.appId2Servers["APP2"], []string{"web01"}) || mapping.appServerUuids["APP2"]["web01"] != "uuid-web" {
+		t.Errorf("APP2 servers = %v, UUIDs = %v", mapping.appId2Servers["APP2"], mapping.appServerUuids["APP2"])
+	}
+}
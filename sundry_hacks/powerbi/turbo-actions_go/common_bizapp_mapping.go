@@ -0,0 +1,106 @@
+package main
+
+/*
+Builds the application to server mapping from the Business Applications defined in Turbo instead of from a CSV.
+Same idea as js_console_hacks/Create_Business_Application_VMandDB_Groups_XL.js: the VMs and database servers in each
+Business Application's supply chain are the application's servers.
+
+The Business Application's UUID is used as the Component_Id and its name as the Component_Name.
+Since the server UUIDs are known, they are always used to find the servers' actions. A second server with the same name in a
+Business Application is listed as "<name> (<uuid>)".
+*/
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Entity types that count as an application's servers
+var bizAppServerClasses = []string{"VirtualMachine", "DatabaseServer", "Database"}
+
+// Builds the mapping for all the Business Applications in Turbo or, if bizapp_group is given, the ones in that group.
+func getBizAppMapping(turbo_instance string, auth string, bizapp_group string) (appMapping, error) {
+	mapping := newAppMapping()
+
+	var bizApps []map[string]interface{}
+	var err error
+	if bizapp_group == "" {
+		bizApps, err = turboApiGetAll(turbo_instance, auth, "GET", "/search?types=BusinessApplication", nil)
+		if err != nil {
+			return mapping, fmt.Errorf("getting Business Applications: %v", err)
+		}
+	} else {
+		bizApps, err = getBizAppGroupMembers(turbo_instance, auth, bizapp_group)
+		if err != nil {
+			return mapping, err
+		}
+	}
+
+	// Sorted so the output is the same from run to run
+	sort.Slice(bizApps, func(i, j int) bool {
+		return jsonString(bizApps[i], "displayName") < jsonString(bizApps[j], "displayName")
+	})
+
+	for _, bizApp := range bizApps {
+		appId := jsonString(bizApp, "uuid")
+		appName := jsonString(bizApp, "displayName")
+		if appId == "" {
+			continue
+		}
+		mapping.appId2Name[appId] = appName
+
+		serverCount := 0
+		for _, className := range bizAppServerClasses {
+			servers, err := turboScopedSearch(turbo_instance, auth, className, appId)
+			if err != nil {
+				return mapping, fmt.Errorf("getting %s entities for Business Application %s: %v", className, appName, err)
+			}
+			for _, server := range servers {
+				serverName := jsonString(server, "displayName")
+				serverUuid := jsonString(server, "uuid")
+				if serverName == "" || serverUuid == "" {
+					continue
+				}
+				listedName := mapping.addServer(appId, serverName, serverUuid)
+				if listedName == "" {
+					continue
+				}
+				if listedName != serverName {
+					fmt.Printf("### Business Application %s has more than one server named %s. UUID %s is listed as %s.\n", appName, serverName, serverUuid, listedName)
+				}
+				serverCount++
+			}
+		}
+		fmt.Printf("... found %d server(s) for Business Application %s\n", serverCount, appName)
+	}
+
+	return mapping, nil
+}
+
+// Returns the Business Applications in the named group
+func getBizAppGroupMembers(turbo_instance string, auth string, bizapp_group string) ([]map[string]interface{}, error) {
+	groups, err := turboSearchByName(turbo_instance, auth, "Group", "groupsByName", bizapp_group, true)
+	if err != nil {
+		return nil, fmt.Errorf("finding group %s: %v", bizapp_group, err)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no group named %s found", bizapp_group)
+	}
+	if len(groups) > 1 {
+		return nil, fmt.Errorf("%d groups named %s found", len(groups), bizapp_group)
+	}
+
+	members, err := turboApiGetAll(turbo_instance, auth, "GET", "/groups/"+jsonString(groups[0], "uuid")+"/members", nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting members of group %s: %v", bizapp_group, err)
+	}
+	var bizApps []map[string]interface{}
+	for _, member := range members {
+		if jsonString(member, "className") == "BusinessApplication" {
+			bizApps = append(bizApps, member)
+		} else {
+			fmt.Printf("### Skipping %s in group %s since it is a %s, not a BusinessApplication\n", jsonString(member, "displayName"), bizapp_group, jsonString(member, "className"))
+		}
+	}
+	return bizApps, nil
+}
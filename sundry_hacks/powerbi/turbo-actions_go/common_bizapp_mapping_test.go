@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Stands in for the Turbo API with two Business Applications and a group with one of them and a VM in it.
+// Scoped searches for a class the application has none of get Turbo's 400.
+func startFakeTurboBizApps(t *testing.T) string {
+	t.Helper()
+	// Business Application UUID -> class -> its entities of that class
+	supplyChains := map[string]map[string][]map[string]interface{}{
+		"ba1": {
+			"VirtualMachine": {
+				{"uuid": "v1", "displayName": "pay-web01"},
+				// Another VM with the same name, e.g. in another vCenter
+				{"uuid": "v2", "displayName": "pay-web01"},
+				{"uuid": "v3", "displayName": ""},
+			},
+			"DatabaseServer": {{"uuid": "d1", "displayName": "pay-db01"}},
+		},
+		"ba2": {
+			"VirtualMachine": {{"uuid": "v4", "displayName": "hr-web01"}, {"uuid": "v4", "displayName": "hr-web01"}},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`[{"uuid": "ba2", "displayName": "HR", "className": "BusinessApplication"},
+				{"uuid": "ba1", "displayName": "Payroll", "className": "BusinessApplication"}]`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var search struct {
+			ClassName string   `json:"className"`
+			Scope     []string `json:"scope"`
+		}
+		json.Unmarshal(body, &search)
+		if len(search.Scope) == 0 {
+			// The search for the group by name
+			w.Write([]byte(`[{"uuid": "g1", "displayName": "Finance Apps", "className": "Group"}]`))
+			return
+		}
+		entities, ok := supplyChains[search.Scope[0]][search.ClassName]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "Error", "exception": "java.lang.IllegalArgumentException", "message": "Invalid scope: ` + search.Scope[0] + `"}`))
+			return
+		}
+		data, _ := json.Marshal(entities)
+		w.Write(data)
+	})
+	mux.HandleFunc("/vmturbo/rest/groups/g1/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"uuid": "ba1", "displayName": "Payroll", "className": "BusinessApplication"},
+			{"uuid": "v9", "displayName": "stray-vm", "className": "VirtualMachine"}]`))
+	})
+	return startFakeTurbo(t, mux)
+}
+
+func TestGetBizAppMapping(t *testing.T) {
+	mapping, err := getBizAppMapping(startFakeTurboBizApps(t), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(mapping.appId2Name, map[string]string{"ba1": "Payroll", "ba2": "HR"}) {
+		t.Errorf("apps = %v", mapping.appId2Name)
+	}
+	// Servers without a name are skipped, the same server is only listed once and a second server with the same name is kept
+	wantServers := map[string][]string{"ba1": {"pay-web01", "pay-web01 (v2)", "pay-db01"}, "ba2": {"hr-web01"}}
+	if !reflect.DeepEqual(mapping.appId2Servers, wantServers) {
+		t.Errorf("servers = %v, want %v", mapping.appId2Servers, wantServers)
+	}
+	wantUuids := map[string]map[string]string{"ba1": {"pay-web01": "v1", "pay-web01 (v2)": "v2", "pay-db01": "d1"}, "ba2": {"hr-web01": "v4"}}
+	if !reflect.DeepEqual(mapping.appServerUuids, wantUuids) {
+		t.Errorf("UUIDs = %v, want %v", mapping.appServerUuids, wantUuids)
+	}
+}
+
+func TestGetBizAppMappingGroup(t *testing.T) {
+	mapping, err := getBizAppMapping(startFakeTurboBizApps(t), "", "Finance Apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the group's Business Application, and not the VM that is also in the group
+	if !reflect.DeepEqual(mapping.appId2Name, map[string]string{"ba1": "Payroll"}) {
+		t.Errorf("apps = %v", mapping.appId2Name)
+	}
+}
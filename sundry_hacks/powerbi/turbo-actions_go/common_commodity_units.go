@@ -0,0 +1,124 @@
+package main
+
+/*
+Registry of the units Turbo gives commodity values in and the units people want to read them in.
+
+A resize action's currentValue and resizeToValue are in the action's valueUnits (e.g. KB for VMem, MB for VStorage).
+If the action doesn't say, the unit is looked up from the commodity. The values are then converted to a human unit
+(e.g. GB) and rounded to the number of decimals for that unit.
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type unitConversion struct {
+	// Unit the value is shown in
+	unit string
+	// Turbo value / divisor = value in unit
+	divisor float64
+}
+
+// Turbo unit -> human unit
+var unitConversions = map[string]unitConversion{
+	"Bytes":    {"GB", 1024 * 1024 * 1024},
+	"KB":       {"GB", 1024 * 1024},
+	"MB":       {"GB", 1024},
+	"GB":       {"GB", 1},
+	"MHz":      {"GHz", 1000},
+	"mCores":   {"Cores", 1000},
+	"vCPU":     {"vCPU", 1},
+	"IOPS":     {"IOPS", 1},
+	"Kbit/sec": {"MB/s", 8 * 1024},
+	"ms":       {"ms", 1},
+	"%":        {"%", 1},
+}
+
+// Commodity -> Turbo unit, for actions that don't give valueUnits
+var commodityUnits = map[string]string{
+	"VCPU":           "vCPU",
+	"VMem":           "KB",
+	"VStorage":       "MB",
+	"StorageAmount":  "MB",
+	"StorageAccess":  "IOPS",
+	"StorageLatency": "ms",
+	"IOThroughput":   "Kbit/sec",
+	"Heap":           "KB",
+	"DBMem":          "KB",
+	"TransactionLog": "MB",
+	"VCPURequest":    "mCores",
+	"VMemRequest":    "KB",
+	"VCPULimitQuota": "mCores",
+	"VMemLimitQuota": "KB",
+	"Mem":            "KB",
+	"CPU":            "MHz",
+}
+
+// Decimals to round converted values to, by human unit. Units not listed use defaultUnitDecimals.
+var unitDecimals = map[string]int{"vCPU": 0, "IOPS": 0}
+var defaultUnitDecimals = 2
+
+// Rounding and extra commodities as given in the config file
+type unitConfig struct {
+	// Decimals for units not in DecimalsByUnit
+	Decimals       *int              `json:"decimals"`
+	DecimalsByUnit map[string]int    `json:"decimals_by_unit"`
+	CommodityUnits map[string]string `json:"commodity_units"`
+}
+
+// Applies the config file's unit settings to the registry.
+func applyUnitConfig(config unitConfig) error {
+	if config.Decimals != nil {
+		if *config.Decimals < 0 {
+			return fmt.Errorf("decimals must not be negative")
+		}
+		defaultUnitDecimals = *config.Decimals
+	}
+	for unit, decimals := range config.DecimalsByUnit {
+		if decimals < 0 {
+			return fmt.Errorf("decimals for %s must not be negative", unit)
+		}
+		unitDecimals[unit] = decimals
+	}
+	for commodity, unit := range config.CommodityUnits {
+		if _, ok := unitConversions[unit]; !ok {
+			return fmt.Errorf("unknown unit %s for commodity %s", unit, commodity)
+		}
+		commodityUnits[commodity] = unit
+	}
+	return nil
+}
+
+// Converts a commodity value from Turbo to its human unit.
+// valueUnits is the unit given in the action, if any. Returns false if the unit isn't known or the value isn't a number.
+func convertCommodityValue(commodity string, valueUnits string, value string) (float64, string, bool) {
+	turboUnit := valueUnits
+	if turboUnit == "" {
+		turboUnit = commodityUnits[commodity]
+	}
+	conversion, ok := unitConversions[turboUnit]
+	if !ok {
+		return 0, "", false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return roundUnitValue(number/conversion.divisor, conversion.unit), conversion.unit, true
+}
+
+func roundUnitValue(value float64, unit string) float64 {
+	decimals, ok := unitDecimals[unit]
+	if !ok {
+		decimals = defaultUnitDecimals
+	}
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// Formats a converted value without trailing zeros, e.g. 150 or 20.5
+func formatUnitValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
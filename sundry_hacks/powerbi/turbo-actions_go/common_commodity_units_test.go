@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestConvertCommodityValueRounding(t *testing.T) {
+	savedDefault := defaultUnitDecimals
+	savedGb, hadGb := unitDecimals["GB"]
+	t.Cleanup(func() {
+		defaultUnitDecimals = savedDefault
+		delete(unitDecimals, "GB")
+		if hadGb {
+			unitDecimals["GB"] = savedGb
+		}
+		delete(commodityUnits, "MyCommodity")
+	})
+
+	one := 1
+	if err := applyUnitConfig(unitConfig{Decimals: &one, DecimalsByUnit: map[string]int{"GB": 0}, CommodityUnits: map[string]string{"MyCommodity": "MHz"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		commodity, valueUnits, value string
+		want                         float64
+		unit                         string
+	}{
+		{"VMem", "KB", "21495808.0", 21, "GB"},
+		{"VStorage", "", "153600", 150, "GB"},
+		{"MyCommodity", "", "2450", 2.5, "GHz"},
+		{"StorageAccess", "", "1234.6", 1235, "IOPS"},
+	}
+	for _, c := range cases {
+		got, unit, ok := convertCommodityValue(c.commodity, c.valueUnits, c.value)
+		if !ok || got != c.want || unit != c.unit {
+			t.Errorf("convertCommodityValue(%s, %q, %s) = %v %s %v, want %v %s", c.commodity, c.valueUnits, c.value, got, unit, ok, c.want, c.unit)
+		}
+	}
+
+	if _, _, ok := convertCommodityValue("Unheard", "", "12"); ok {
+		t.Errorf("expected no conversion for an unknown commodity")
+	}
+	if err := applyUnitConfig(unitConfig{CommodityUnits: map[string]string{"X": "furlongs"}}); err == nil {
+		t.Errorf("expected an error for an unknown unit")
+	}
+}
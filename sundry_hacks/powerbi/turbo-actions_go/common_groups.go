@@ -0,0 +1,182 @@
+package main
+
+/*
+Looking up Turbo groups by UUID or name and getting their members, for the tools in this directory.
+
+A group can be given by its UUID or by its name. Names are matched exactly by default since the group name is often
+something like "Prod Clusters (East)" that would otherwise be read as a regular expression.
+If more than one group matches, the error lists them so the UUID of the one to use can be given.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type turboGroup struct {
+	uuid string
+	name string
+	// Cluster for a cluster, Group for a group of other things
+	className string
+	// The type of the members, e.g. PhysicalMachine for a cluster or Cluster for a group of clusters
+	groupType string
+}
+
+func (group turboGroup) String() string {
+	if group.groupType != "" {
+		return fmt.Sprintf("%s (uuid %s, type %s)", group.name, group.uuid, group.groupType)
+	}
+	return fmt.Sprintf("%s (uuid %s)", group.name, group.uuid)
+}
+
+// Turbo UUIDs are either long numbers (XL) or standard UUIDs (classic).
+var turboUuidPattern = regexp.MustCompile(`^([0-9]{6,}|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// Finds the group given by UUID or name.
+// match is how a name is matched: exact (default), ignore_case, or regex to use the name as a regular expression as given.
+// An error lists the candidates if more than one group matches, or says so if none does.
+func resolveGroup(turbo_instance string, auth string, group string, match string) (turboGroup, error) {
+	candidates, err := findGroups(turbo_instance, auth, group, match)
+	if err != nil {
+		return turboGroup{}, err
+	}
+	if len(candidates) > 1 {
+		var lines []string
+		for _, candidate := range candidates {
+			lines = append(lines, "  "+candidate.String())
+		}
+		return turboGroup{}, fmt.Errorf("%d groups match %q, give the UUID of the one to use:\n%s", len(candidates), group, strings.Join(lines, "\n"))
+	}
+	return candidates[0], nil
+}
+
+// Returns the groups that match the UUID or name, sorted by name. An error if there are none.
+func findGroups(turbo_instance string, auth string, group string, match string) ([]turboGroup, error) {
+	group = strings.TrimSpace(group)
+	if group == "" {
+		return nil, fmt.Errorf("no group given")
+	}
+
+	if turboUuidPattern.MatchString(group) {
+		body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/groups/"+group, nil)
+		if err == nil {
+			found, err := decodeTurboGroup(body)
+			if err != nil {
+				return nil, err
+			}
+			return []turboGroup{found}, nil
+		}
+		// Not a UUID Turbo knows, so it may just be a group with a numeric name
+		if _, ok := err.(*turboApiError); !ok {
+			return nil, err
+		}
+	}
+
+	var results []map[string]interface{}
+	var err error
+	switch match {
+	case "", "exact":
+		results, err = turboSearchByName(turbo_instance, auth, "Group", "groupsByName", group, true)
+	case "ignore_case":
+		results, err = turboSearchByName(turbo_instance, auth, "Group", "groupsByName", group, false)
+	case "regex":
+		if _, compileErr := regexp.Compile(group); compileErr != nil {
+			return nil, fmt.Errorf("bad regular expression %s: %v", group, compileErr)
+		}
+		results, err = turboSearchByRegex(turbo_instance, auth, "Group", "groupsByName", group, false)
+	default:
+		return nil, fmt.Errorf("unknown group match %s (use exact, ignore_case or regex)", match)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("searching for group %s: %v", group, err)
+	}
+
+	var candidates []turboGroup
+	for _, result := range results {
+		candidate := turboGroupFromJson(result)
+		// Turbo's search is a regex search under the covers so double check the names for the exact matches
+		if (match == "" || match == "exact") && candidate.name != group {
+			continue
+		}
+		if match == "ignore_case" && !strings.EqualFold(candidate.name, group) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no group found matching %q (group match %s)", group, matchName(match))
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].name+candidates[i].uuid < candidates[j].name+candidates[j].uuid
+	})
+	return candidates, nil
+}
+
+func decodeTurboGroup(body []byte) (turboGroup, error) {
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return turboGroup{}, fmt.Errorf("decoding group: %v", err)
+	}
+	return turboGroupFromJson(result), nil
+}
+
+func turboGroupFromJson(object map[string]interface{}) turboGroup {
+	return turboGroup{uuid: jsonString(object, "uuid"), name: jsonString(object, "displayName"), className: jsonString(object, "className"), groupType: jsonString(object, "groupType")}
+}
+
+func matchName(match string) string {
+	if match == "" {
+		return "exact"
+	}
+	return match
+}
+
+// A member of a group as returned by /groups/{uuid}/members
+type groupMember struct {
+	uuid            string
+	name            string
+	className       string
+	environmentType string
+}
+
+func (member groupMember) String() string {
+	return fmt.Sprintf("%s (uuid %s, type %s)", member.name, member.uuid, member.className)
+}
+
+// Gets all the members of the group, following x-next-cursor for large groups.
+// Only members whose className is one of expectedTypes are returned, the rest (including members with no uuid) are
+// returned separately so the caller can warn about them.
+func getTypedGroupMembers(turbo_instance string, auth string, groupUuid string, expectedTypes ...string) ([]groupMember, []groupMember, error) {
+	results, err := turboApiGetAll(turbo_instance, auth, "GET", "/groups/"+groupUuid+"/members", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var members, unexpected []groupMember
+	for _, result := range results {
+		member := groupMember{
+			uuid:            jsonString(result, "uuid"),
+			name:            jsonString(result, "displayName"),
+			className:       jsonString(result, "className"),
+			environmentType: jsonString(result, "environmentType"),
+		}
+		if member.name == "" {
+			member.name = member.uuid
+		}
+		expected := false
+		for _, expectedType := range expectedTypes {
+			if member.className == expectedType {
+				expected = true
+			}
+		}
+		if expected && member.uuid != "" {
+			members = append(members, member)
+		} else {
+			unexpected = append(unexpected, member)
+		}
+	}
+	return members, unexpected, nil
+}
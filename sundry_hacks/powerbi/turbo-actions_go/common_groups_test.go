@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Stands in for the Turbo group search and GET /groups/{uuid} with the given groups.
+// The search applies the request's expression to the names much like Turbo does.
+func startFakeTurboGroups(t *testing.T, groups []map[string]interface{}) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var search struct {
+			CriteriaList []struct {
+				ExpVal        string `json:"expVal"`
+				CaseSensitive bool   `json:"caseSensitive"`
+			} `json:"criteriaList"`
+		}
+		json.Unmarshal(body, &search)
+		expression := search.CriteriaList[0].ExpVal
+		if !search.CriteriaList[0].CaseSensitive {
+			expression = "(?i)" + expression
+		}
+		re := regexp.MustCompile(expression)
+		var found []map[string]interface{}
+		for _, group := range groups {
+			if re.MatchString(group["displayName"].(string)) {
+				found = append(found, group)
+			}
+		}
+		data, _ := json.Marshal(found)
+		w.Write(data)
+	})
+	mux.HandleFunc("/vmturbo/rest/groups/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/groups/")
+		if strings.HasSuffix(uuid, "/members") {
+			uuid = strings.TrimSuffix(uuid, "/members")
+			for _, group := range groups {
+				if group["uuid"] == uuid {
+					data, _ := json.Marshal(group["members"])
+					w.Write(data)
+					return
+				}
+			}
+			http.NotFound(w, r)
+			return
+		}
+		for _, group := range groups {
+			if group["uuid"] == uuid {
+				data, _ := json.Marshal(group)
+				w.Write(data)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	// A host's groups are the groups that list it as a member
+	mux.HandleFunc("/vmturbo/rest/entities/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/entities/"), "/groups")
+		found := []map[string]interface{}{}
+		for _, group := range groups {
+			members, _ := group["members"].([]map[string]interface{})
+			for _, member := range members {
+				if member["uuid"] == uuid {
+					found = append(found, map[string]interface{}{"uuid": group["uuid"], "displayName": group["displayName"], "className": group["className"], "groupType": group["groupType"]})
+				}
+			}
+		}
+		data, _ := json.Marshal(found)
+		w.Write(data)
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+var testGroups = []map[string]interface{}{
+	{"uuid": "284551234567001", "displayName": "Prod Clusters (East)", "groupType": "Cluster"},
+	{"uuid": "284551234567002", "displayName": "Prod Clusters xEastx", "groupType": "Cluster"},
+	{"uuid": "284551234567003", "displayName": "prod clusters (east)", "groupType": "Cluster"},
+	{"uuid": "284551234567004", "displayName": "123456789", "groupType": "Cluster"},
+}
+
+func TestResolveGroupExactNameIsEscaped(t *testing.T) {
+	turbo_instance := startFakeTurboGroups(t, testGroups)
+	group, err := resolveGroup(turbo_instance, "", "Prod Clusters (East)", "exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.uuid != "284551234567001" {
+		t.Errorf("got %s, want Prod Clusters (East)", group)
+	}
+}
+
+func TestResolveGroupByUuid(t *testing.T) {
+	turbo_instance := startFakeTurboGroups(t, testGroups)
+	group, err := resolveGroup(turbo_instance, "", "284551234567002", "exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.name != "Prod Clusters xEastx" {
+		t.Errorf("got %s", group)
+	}
+
+	// A numeric group name that isn't a UUID is still found by name
+	group, err = resolveGroup(turbo_instance, "", "123456789", "exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.uuid != "284551234567004" {
+		t.Errorf("got %s", group)
+	}
+}
+
+func TestResolveGroupAmbiguousListsCandidates(t *testing.T) {
+	turbo_instance := startFakeTurboGroups(t, testGroups)
+	_, err := resolveGroup(turbo_instance, "", "prod clusters (east)", "ignore_case")
+	if err == nil {
+		t.Fatal("expected an error for more than one matching group")
+	}
+	for _, uuid := range []string{"284551234567001", "284551234567003"} {
+		if !strings.Contains(err.Error(), uuid) {
+			t.Errorf("error doesn't list candidate %s: %v", uuid, err)
+		}
+	}
+	if strings.Contains(err.Error(), "284551234567002") {
+		t.Errorf("error lists a group that doesn't match: %v", err)
+	}
+}
+
+func TestResolveGroupNotFound(t *testing.T) {
+	turbo_instance := startFakeTurboGroups(t, testGroups)
+	_, err := resolveGroup(turbo_instance, "", "Dev Clusters", "exact")
+	if err == nil || !strings.Contains(err.Error(), "no group found") {
+		t.Errorf("err = %v, want a not found error", err)
+	}
+	if _, err := resolveGroup(turbo_instance, "", "Prod (", "regex"); err == nil {
+		t.Errorf("expected an error for a bad regular expression")
+	}
+}
+
+func TestGetTypedGroupMembersPagesAndSkipsUnexpected(t *testing.T) {
+	pages := map[string]string{
+		"":  `[{"uuid":"1","displayName":"esx01","className":"PhysicalMachine","environmentType":"ONPREM"},{"uuid":"9","displayName":"vm01","className":"VirtualMachine"}]`,
+		"2": `[{"uuid":"2","className":"PhysicalMachine"},{"displayName":"no uuid","className":"PhysicalMachine"},{"uuid":42}]`,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/groups/101/members", func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		if cursor == "" {
+			w.Header().Set("x-next-cursor", "2")
+		}
+		w.Write([]byte(pages[cursor]))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	members, unexpected, err := getTypedGroupMembers(strings.TrimPrefix(server.URL, "https://"), "", "101", "PhysicalMachine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].environmentType != "ONPREM" || members[1].name != "2" {
+		t.Errorf("members = %v, want esx01 and 2", members)
+	}
+	if len(unexpected) != 3 {
+		t.Errorf("unexpected = %v, want the VM and the two members without a uuid", unexpected)
+	}
+}
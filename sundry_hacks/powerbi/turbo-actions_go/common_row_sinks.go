@@ -0,0 +1,157 @@
+package main
+
+/*
+Places to send a table of rows to: a Power BI streaming dataset or a CSV file.
+
+Tools pick the sink from the destination they are given: an http(s) URL is taken to be a Power BI streaming dataset
+push URL and anything else is a CSV file path. Rows are maps of column name -> value where the value is a string,
+a number (float64 or int) or a bool.
+*/
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PowerBI allows 120 POSTs per minute so after every powerBiThrottleCalls POSTs we pause for powerBiThrottleSleep.
+// powerBiSleep is a variable so tests can exercise the throttling without actually waiting.
+var powerBiThrottleCalls = 110
+var powerBiThrottleSleep = 70 * time.Second
+var powerBiSleep = time.Sleep
+
+// Most rows PowerBI accepts in a single POST
+var powerBiMaxRows = 10000
+
+type rowSink interface {
+	// Sends a set of rows. label is only used in progress messages (e.g. "application Payroll").
+	writeRows(label string, rows []map[string]interface{}) error
+	close() error
+}
+
+// Opens a sink for the given destination. columns gives the order of the columns in a CSV file.
+func newRowSink(destination string, columns []string) (rowSink, error) {
+	if strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://") {
+		return &powerBiSink{url: destination}, nil
+	}
+	return newCsvSink(destination, columns)
+}
+
+type powerBiSink struct {
+	url      string
+	apiCount int
+}
+
+func (sink *powerBiSink) writeRows(label string, rows []map[string]interface{}) error {
+	var failed []string
+	for start := 0; start < len(rows); start += powerBiMaxRows {
+		end := start + powerBiMaxRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := sink.post(rows[start:end]); err != nil {
+			fmt.Printf("### ERROR ### sending %d records for %s:\n", end-start, label)
+			fmt.Println("### " + err.Error())
+			failed = append(failed, err.Error())
+		} else {
+			fmt.Printf("... sent %d record(s) for %s\n", end-start, label)
+		}
+
+		sink.apiCount++
+		if (sink.apiCount % powerBiThrottleCalls) == 0 {
+			fmt.Printf("... made %d API calls. SLEEPING for %d seconds to avoid overloading PowerBI API limits ...", sink.apiCount, int(powerBiThrottleSleep.Seconds()))
+			powerBiSleep(powerBiThrottleSleep)
+			fmt.Printf(" continuing ...\n")
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of the POSTs for %s failed: %s", len(failed), label, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (sink *powerBiSink) post(rows []map[string]interface{}) error {
+	payload, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	res, err := http.Post(sink.url, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("HTML ERROR %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return nil
+}
+
+func (sink *powerBiSink) close() error {
+	return nil
+}
+
+type csvSink struct {
+	file    *os.File
+	writer  *csv.Writer
+	columns []string
+}
+
+func newCsvSink(csv_file string, columns []string) (*csvSink, error) {
+	file, err := os.Create(csv_file)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %s: %v", csv_file, err)
+	}
+	sink := &csvSink{file: file, writer: csv.NewWriter(file), columns: columns}
+	if err := sink.writer.Write(columns); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *csvSink) writeRows(label string, rows []map[string]interface{}) error {
+	for _, row := range rows {
+		record := make([]string, len(sink.columns))
+		for index, column := range sink.columns {
+			record[index] = csvValue(row[column])
+		}
+		if err := sink.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	sink.writer.Flush()
+	fmt.Printf("... wrote %d record(s) for %s to %s\n", len(rows), label, sink.file.Name())
+	return sink.writer.Error()
+}
+
+func (sink *csvSink) close() error {
+	sink.writer.Flush()
+	if err := sink.writer.Error(); err != nil {
+		sink.file.Close()
+		return err
+	}
+	return sink.file.Close()
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCsvSinkWritesColumnsInOrder(t *testing.T) {
+	csv_file := filepath.Join(t.TempDir(), "rows.csv")
+	sink, err := newRowSink(csv_file, []string{"Name", "Count", "Ratio", "Flag", "Missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.writeRows("first", []map[string]interface{}{{"Name": "a, b", "Count": 3, "Ratio": 0.25, "Flag": true}}); err != nil {
+		t.Fatal(err)
+	}
+	// Each set of rows is on disk before the next is written
+	data, _ := ioutil.ReadFile(csv_file)
+	if string(data) != "Name,Count,Ratio,Flag,Missing\n\"a, b\",3,0.25,true,\n" {
+		t.Errorf("after the first rows the file has %q", data)
+	}
+	if err := sink.writeRows("second", []map[string]interface{}{{"Name": "c", "Missing": nil}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(csv_file)
+	if !strings.HasSuffix(string(data), "\nc,,,,\n") {
+		t.Errorf("file has %q", data)
+	}
+}
+
+func TestCsvSinkBadPath(t *testing.T) {
+	if _, err := newRowSink(filepath.Join(t.TempDir(), "missing", "rows.csv"), []string{"Name"}); err == nil {
+		t.Error("expected an error for a directory that doesn't exist")
+	}
+}
+
+func TestPowerBiSinkSplitsThrottlesAndReportsErrors(t *testing.T) {
+	savedMax, savedCalls, savedSleep := powerBiMaxRows, powerBiThrottleCalls, powerBiSleep
+	defer func() { powerBiMaxRows, powerBiThrottleCalls, powerBiSleep = savedMax, savedCalls, savedSleep }()
+	powerBiMaxRows = 2
+	powerBiThrottleCalls = 2
+	sleeps := 0
+	powerBiSleep = func(time.Duration) { sleeps++ }
+
+	fake, url := startFakePowerBi(t, "Name:Text,Count:Number")
+	fake.strict = true
+	sink, err := newRowSink(url, []string{"Name", "Count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]interface{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		rows = append(rows, map[string]interface{}{"Name": name, "Count": 1})
+	}
+	// The third of the three POSTs fails
+	fake.injectStatus(0, 0, http.StatusInternalServerError)
+	err = sink.writeRows("test", rows)
+	if err == nil || !strings.Contains(err.Error(), "1 of the POSTs for test failed") {
+		t.Errorf("got %v, want the failed POST reported", err)
+	}
+	fake.assertPostCount(t, 3)
+	fake.assertRowCount(t, 4)
+	fake.assertNoSchemaErrors(t)
+	if sleeps != 1 {
+		t.Errorf("slept %d times, want once after 2 POSTs", sleeps)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+/*
+Server name normalization so the mapping's names and Turbo's names can be joined even when they are written differently,
+e.g. a short hostname in the CSV and an FQDN or upper case name in Turbo.
+
+The same rules are applied to both sides of the join, in this order:
+- rewrites: regular expression replacements, in the order given (e.g. {"match": "^(.*)-vm$", "replace": "$1"})
+- domain_suffixes: the first of these domain suffixes the name ends with is removed (not case sensitive)
+- strip_domain: everything from the first "." is removed. IP addresses are left alone.
+- case_fold: the name is lower cased
+
+Normalizing can make different names the same (e.g. pay01.corp.example.com and pay01.dev.example.com with strip_domain),
+so the collisions are returned for reporting.
+*/
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Normalization rules as given in the config file
+type serverNameRules struct {
+	CaseFold       bool                `json:"case_fold"`
+	StripDomain    bool                `json:"strip_domain"`
+	DomainSuffixes []string            `json:"domain_suffixes"`
+	Rewrites       []serverNameRewrite `json:"rewrites"`
+}
+
+type serverNameRewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+type serverNameNormalizer struct {
+	rules    serverNameRules
+	rewrites []*regexp.Regexp
+}
+
+func newServerNameNormalizer(rules serverNameRules) (*serverNameNormalizer, error) {
+	normalizer := &serverNameNormalizer{rules: rules}
+	for _, rewrite := range rules.Rewrites {
+		re, err := regexp.Compile(rewrite.Match)
+		if err != nil {
+			return nil, fmt.Errorf("bad rewrite expression %s: %v", rewrite.Match, err)
+		}
+		normalizer.rewrites = append(normalizer.rewrites, re)
+	}
+	return normalizer, nil
+}
+
+// Returns false if there are no rules, i.e. names are used as is.
+func (normalizer *serverNameNormalizer) active() bool {
+	rules := normalizer.rules
+	return rules.CaseFold || rules.StripDomain || len(rules.DomainSuffixes) > 0 || len(rules.Rewrites) > 0
+}
+
+func (normalizer *serverNameNormalizer) normalize(serverName string) string {
+	name := strings.TrimSpace(serverName)
+	for index, re := range normalizer.rewrites {
+		name = re.ReplaceAllString(name, normalizer.rules.Rewrites[index].Replace)
+	}
+	for _, suffix := range normalizer.rules.DomainSuffixes {
+		suffix = "." + strings.TrimPrefix(suffix, ".")
+		if len(name) > len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+			name = name[:len(name)-len(suffix)]
+			break
+		}
+	}
+	if normalizer.rules.StripDomain && net.ParseIP(name) == nil {
+		if dot := strings.Index(name, "."); dot > 0 {
+			name = name[:dot]
+		}
+	}
+	if normalizer.rules.CaseFold {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// Normalizes a set of names.
+// Returns:
+// - map: name -> normalized name
+// - map: normalized name -> the names that normalized to it. Only for normalized names that more than one name normalized to.
+func (normalizer *serverNameNormalizer) normalizeNames(serverNames []string) (map[string]string, map[string][]string) {
+	normalized := make(map[string]string)
+	sources := make(map[string][]string)
+	for _, serverName := range serverNames {
+		if _, done := normalized[serverName]; done {
+			continue
+		}
+		name := normalizer.normalize(serverName)
+		normalized[serverName] = name
+		sources[name] = append(sources[name], serverName)
+	}
+
+	collisions := make(map[string][]string)
+	for name, names := range sources {
+		if len(names) > 1 {
+			sort.Strings(names)
+			collisions[name] = names
+		}
+	}
+	return normalized, collisions
+}
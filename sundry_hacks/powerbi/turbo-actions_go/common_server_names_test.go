@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServerNameNormalizer(t *testing.T) {
+	normalizer, err := newServerNameNormalizer(serverNameRules{
+		CaseFold:       true,
+		DomainSuffixes: []string{"corp.example.com", ".dev.example.com"},
+		Rewrites:       []serverNameRewrite{{Match: "^(.*)-vm$", Replace: "$1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"PAY01":                    "pay01",
+		"pay01.CORP.example.com":   "pay01",
+		"pay02-vm.dev.example.com": "pay02-vm",
+		"pay03-vm":                 "pay03",
+		"pay04.other.example.com":  "pay04.other.example.com",
+		" pay05 ":                  "pay05",
+	}
+	for name, want := range cases {
+		if got := normalizer.normalize(name); got != want {
+			t.Errorf("normalize(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestServerNameNormalizerStripDomain(t *testing.T) {
+	normalizer, err := newServerNameNormalizer(serverNameRules{StripDomain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := normalizer.normalize("pay01.corp.example.com"); got != "pay01" {
+		t.Errorf("normalize = %q, want pay01", got)
+	}
+	if got := normalizer.normalize("10.1.2.3"); got != "10.1.2.3" {
+		t.Errorf("IP address was changed to %q", got)
+	}
+}
+
+func TestServerNameNormalizerCollisions(t *testing.T) {
+	normalizer, _ := newServerNameNormalizer(serverNameRules{CaseFold: true, StripDomain: true})
+	normalized, collisions := normalizer.normalizeNames([]string{"pay01.corp.example.com", "PAY01.dev.example.com", "pay02", "pay01.corp.example.com"})
+
+	if normalized["PAY01.dev.example.com"] != "pay01" || normalized["pay02"] != "pay02" {
+		t.Errorf("normalized = %v", normalized)
+	}
+	want := map[string][]string{"pay01": {"PAY01.dev.example.com", "pay01.corp.example.com"}}
+	if !reflect.DeepEqual(collisions, want) {
+		t.Errorf("collisions = %v, want %v", collisions, want)
+	}
+}
+
+func TestServerNameNormalizerBadRewrite(t *testing.T) {
+	if _, err := newServerNameNormalizer(serverNameRules{Rewrites: []serverNameRewrite{{Match: "pay(01"}}}); err == nil {
+		t.Fatal("expected an error for a bad rewrite expression")
+	}
+}
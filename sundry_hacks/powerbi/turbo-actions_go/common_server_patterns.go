@@ -0,0 +1,189 @@
+package main
+
+/*
+Server_Name entries in the mapping that describe servers by naming pattern instead of by name.
+
+- Glob: any entry with * (any characters) or ? (one character), e.g. payweb-prd-*. It must match the whole server name.
+- Regex: an entry starting with re: or ^, e.g. re:^payweb-(prd|stg)-\d+$ or the ^name$|^name2$ style expressions
+  made by csv_processors/make_group_regexp_from_csv.ps1. Use ^ and $ to match the whole name.
+
+Patterns are resolved against the distinct server names once, rather than against every action. To keep that quick
+with a lot of patterns, each pattern is filed under the literal text every match must start with (e.g. "payweb-prd-")
+so a server name is only tested against the patterns whose literal start it shares.
+*/
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type serverPattern struct {
+	// As given in the mapping
+	text string
+	re   *regexp.Regexp
+	// Literal text any matching name must start with. May be "".
+	prefix string
+}
+
+// Returns true if the Server_Name entry is a pattern rather than a server name
+func isServerPattern(serverName string) bool {
+	return strings.HasPrefix(serverName, "re:") || strings.HasPrefix(serverName, "^") || strings.ContainsAny(serverName, "*?")
+}
+
+func compileServerPattern(text string) (serverPattern, error) {
+	pattern := serverPattern{text: text}
+
+	if strings.HasPrefix(text, "re:") || strings.HasPrefix(text, "^") {
+		expression := strings.TrimPrefix(text, "re:")
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return pattern, fmt.Errorf("bad regular expression in %s: %v", text, err)
+		}
+		pattern.re = re
+		// Only an expression anchored at the start (and without alternatives) gives a literal start for the name
+		if strings.HasPrefix(expression, "^") && !strings.Contains(expression, "|") {
+			if unanchored, err := regexp.Compile(expression[1:]); err == nil {
+				pattern.prefix, _ = unanchored.LiteralPrefix()
+			}
+		}
+		return pattern, nil
+	}
+
+	var expression strings.Builder
+	expression.WriteString("^")
+	for _, char := range text {
+		switch char {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	expression.WriteString("$")
+	pattern.re = regexp.MustCompile(expression.String())
+	pattern.prefix = text[:strings.IndexAny(text, "*?")]
+	return pattern, nil
+}
+
+type serverPatternMatcher struct {
+	// literal prefix -> patterns with that prefix
+	byPrefix map[string][]serverPattern
+	// distinct prefix lengths, shortest first
+	prefixLengths []int
+}
+
+func newServerPatternMatcher(patterns []serverPattern) *serverPatternMatcher {
+	matcher := &serverPatternMatcher{byPrefix: make(map[string][]serverPattern)}
+	for _, pattern := range patterns {
+		if _, ok := matcher.byPrefix[pattern.prefix]; !ok {
+			matcher.prefixLengths = append(matcher.prefixLengths, len(pattern.prefix))
+		}
+		matcher.byPrefix[pattern.prefix] = append(matcher.byPrefix[pattern.prefix], pattern)
+	}
+	sort.Ints(matcher.prefixLengths)
+	// Different prefixes can have the same length
+	var lengths []int
+	for _, length := range matcher.prefixLengths {
+		if len(lengths) == 0 || lengths[len(lengths)-1] != length {
+			lengths = append(lengths, length)
+		}
+	}
+	matcher.prefixLengths = lengths
+	return matcher
+}
+
+// Returns the text of every pattern that matches the server name
+func (matcher *serverPatternMatcher) match(serverName string) []string {
+	var matched []string
+	for _, length := range matcher.prefixLengths {
+		if length > len(serverName) {
+			break
+		}
+		for _, pattern := range matcher.byPrefix[serverName[:length]] {
+			if pattern.re.MatchString(serverName) {
+				matched = append(matched, pattern.text)
+			}
+		}
+	}
+	return matched
+}
+
+// Replaces the patterns in the mapping's Server_Name entries with the server names they match.
+// serverNames are the names to match against (e.g. the servers with actions).
+// Returns:
+// - map: App ID -> array of Server Names with the patterns replaced by the names they matched.
+// - map: App ID -> Server Name -> the pattern it matched. Only for names that came from a pattern.
+// - map: App ID -> patterns that didn't match any server.
+// An error is returned if a pattern can't be compiled.
+func expandServerPatterns(appId2Servers map[string][]string, serverNames []string) (map[string][]string, map[string]map[string]string, map[string][]string, error) {
+	expanded := make(map[string][]string)
+	appServerPatterns := make(map[string]map[string]string)
+	unmatched := make(map[string][]string)
+	// App ID -> server names already in the expanded app
+	inApp := make(map[string]map[string]bool)
+
+	// pattern text -> apps using it
+	patternApps := make(map[string][]string)
+	var patterns []serverPattern
+	for appId, servers := range appId2Servers {
+		for _, serverName := range servers {
+			if !isServerPattern(serverName) {
+				expanded[appId] = append(expanded[appId], serverName)
+				if inApp[appId] == nil {
+					inApp[appId] = make(map[string]bool)
+				}
+				inApp[appId][serverName] = true
+				continue
+			}
+			if _, seen := patternApps[serverName]; !seen {
+				pattern, err := compileServerPattern(serverName)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				patterns = append(patterns, pattern)
+			}
+			patternApps[serverName] = append(patternApps[serverName], appId)
+		}
+	}
+	if len(patterns) == 0 {
+		return appId2Servers, appServerPatterns, unmatched, nil
+	}
+
+	matcher := newServerPatternMatcher(patterns)
+	matchedPatterns := make(map[string]bool)
+	sortedNames := append([]string(nil), serverNames...)
+	sort.Strings(sortedNames)
+	for _, serverName := range sortedNames {
+		for _, patternText := range matcher.match(serverName) {
+			matchedPatterns[patternText] = true
+			for _, appId := range patternApps[patternText] {
+				// The server may already be in the app by name or by an earlier pattern
+				if inApp[appId][serverName] {
+					continue
+				}
+				if inApp[appId] == nil {
+					inApp[appId] = make(map[string]bool)
+				}
+				if appServerPatterns[appId] == nil {
+					appServerPatterns[appId] = make(map[string]string)
+				}
+				inApp[appId][serverName] = true
+				appServerPatterns[appId][serverName] = patternText
+				expanded[appId] = append(expanded[appId], serverName)
+			}
+		}
+	}
+
+	for patternText, appIds := range patternApps {
+		if !matchedPatterns[patternText] {
+			for _, appId := range appIds {
+				unmatched[appId] = append(unmatched[appId], patternText)
+			}
+		}
+	}
+	return expanded, appServerPatterns, unmatched, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExpandServerPatterns(t *testing.T) {
+	appId2Servers := map[string][]string{
+		"APP1": {"pay01", "payweb-prd-*"},
+		"APP2": {"re:^payweb-(prd|stg)-\\d+$", "^db\\d$|^db10$"},
+		"APP3": {"nothing-*"},
+	}
+	serverNames := []string{"pay01", "payweb-prd-1", "payweb-prd-x", "payweb-stg-2", "db1", "db10", "db100"}
+
+	expanded, appServerPatterns, unmatched, err := expandServerPatterns(appId2Servers, serverNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"APP1": {"pay01", "payweb-prd-1", "payweb-prd-x"},
+		"APP2": {"db1", "db10", "payweb-prd-1", "payweb-stg-2"},
+	}
+	for appId, servers := range want {
+		got := append([]string(nil), expanded[appId]...)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, servers) {
+			t.Errorf("%s servers = %v, want %v", appId, got, servers)
+		}
+	}
+
+	if _, ok := appServerPatterns["APP1"]["pay01"]; ok {
+		t.Errorf("pay01 is listed by name but was reported as coming from a pattern")
+	}
+	if got := appServerPatterns["APP1"]["payweb-prd-x"]; got != "payweb-prd-*" {
+		t.Errorf("payweb-prd-x matched %q, want payweb-prd-*", got)
+	}
+	if got := appServerPatterns["APP2"]["db10"]; got != "^db\\d$|^db10$" {
+		t.Errorf("db10 matched %q", got)
+	}
+	if !reflect.DeepEqual(unmatched, map[string][]string{"APP3": {"nothing-*"}}) {
+		t.Errorf("unmatched = %v", unmatched)
+	}
+}
+
+func TestExpandServerPatternsBadRegex(t *testing.T) {
+	_, _, _, err := expandServerPatterns(map[string][]string{"APP1": {"re:pay(01"}}, []string{"pay01"})
+	if err == nil {
+		t.Fatal("expected an error for a bad regular expression")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+/*
+Builds the application to server mapping from the tags Turbo has discovered on the servers (e.g. an "Application" or
+"CostCenter" tag on the VMs), much like js_console_hacks/get_vm_account_tag_value.js reads them.
+
+The tag keys are tried in order and the first one the server has decides its application. Keys are not case sensitive
+since cloud accounts are rarely consistent about it. Servers with none of the keys go in the untagged bucket.
+The application's Component_Id is "<tag key>:<tag value>" and its Component_Name is the tag value.
+Servers whose tags can't be read are left out of the mapping with a warning.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Builds the mapping for the given servers (map of server UUID -> server name) using their tags.
+// If a server has more than one value for the tag key, the first one is used.
+// An error is only returned if none of the servers' tags could be read.
+func getTagMapping(turbo_instance string, auth string, servers map[string]string, tagKeys []string, untaggedBucket string) (appMapping, error) {
+	mapping := newAppMapping()
+
+	// Sorted so the output is the same from run to run
+	var serverUuids []string
+	for serverUuid := range servers {
+		serverUuids = append(serverUuids, serverUuid)
+	}
+	sort.Strings(serverUuids)
+
+	untagged := 0
+	failed := 0
+	var lastErr error
+	for count, serverUuid := range serverUuids {
+		serverName := servers[serverUuid]
+		if (count+1)%100 == 0 {
+			fmt.Printf("... got tags for %d of %d servers ...\n", count+1, len(serverUuids))
+		}
+		tags, err := getEntityTags(turbo_instance, auth, serverUuid)
+		if err != nil {
+			fmt.Printf("### ERROR ### getting tags for %s (%s), so it is left out: %v\n", serverName, serverUuid, err)
+			failed++
+			lastErr = err
+			continue
+		}
+
+		appId, appName := tagApplication(tags, tagKeys)
+		if appId == "" {
+			appId = untaggedBucket
+			appName = untaggedBucket
+			untagged++
+		}
+
+		mapping.appId2Name[appId] = appName
+		if listedName := mapping.addServer(appId, serverName, serverUuid); listedName != "" && listedName != serverName {
+			fmt.Printf("### Application %s has more than one server named %s. UUID %s is listed as %s.\n", appName, serverName, serverUuid, listedName)
+		}
+	}
+	if untagged > 0 {
+		fmt.Printf("... %d server(s) have none of the tags %s and are in %s\n", untagged, strings.Join(tagKeys, ", "), untaggedBucket)
+	}
+	if failed > 0 {
+		if failed == len(serverUuids) {
+			return mapping, fmt.Errorf("couldn't get the tags for any of the %d servers: %v", failed, lastErr)
+		}
+		fmt.Printf("### Couldn't get the tags for %d of %d server(s). Their actions aren't in any application.\n", failed, len(serverUuids))
+	}
+
+	return mapping, nil
+}
+
+// Returns the application ID and name for the first of the tag keys found in the tags. Both are "" if none are found.
+func tagApplication(tags map[string][]string, tagKeys []string) (string, string) {
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, tagKey := range tagKeys {
+		// An exact match wins over one that only differs by case
+		matches := []string{tagKey}
+		for _, key := range keys {
+			if key != tagKey && strings.EqualFold(key, tagKey) {
+				matches = append(matches, key)
+			}
+		}
+		for _, key := range matches {
+			if values := tags[key]; len(values) > 0 && values[0] != "" {
+				return tagKey + ":" + values[0], values[0]
+			}
+		}
+	}
+	return "", ""
+}
+
+// Gets an entity's tags as a map of tag key -> tag values
+func getEntityTags(turbo_instance string, auth string, uuid string) (map[string][]string, error) {
+	body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/entities/"+uuid+"/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagList []struct {
+		Key    string   `json:"key"`
+		Values []string `json:"values"`
+	}
+	if err := json.Unmarshal(body, &tagList); err != nil {
+		return nil, err
+	}
+	tags := make(map[string][]string)
+	for _, tag := range tagList {
+		tags[tag.Key] = append(tags[tag.Key], tag.Values...)
+	}
+	return tags, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Stands in for the Turbo API's /entities/{uuid}/tags. Entities not in tags get a 500.
+func startFakeTurboTags(t *testing.T, tags map[string]string) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/entities/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/entities/"), "/tags")
+		body, ok := tags[uuid]
+		if !ok {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(body))
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestGetTagMapping(t *testing.T) {
+	turbo_instance := startFakeTurboTags(t, map[string]string{
+		"u1": `[{"key": "Application", "values": ["Payroll"]}, {"key": "CostCenter", "values": ["CC1"]}]`,
+		// Same name as u1 (e.g. in another vCenter) and the key in another case
+		"u2": `[{"key": "application", "values": ["Payroll"]}]`,
+		"u4": `[{"key": "CostCenter", "values": ["CC2"]}]`,
+		"u5": `[]`,
+	})
+	servers := map[string]string{"u1": "web01", "u2": "web01", "u3": "db01", "u4": "batch01", "u5": "test01"}
+
+	mapping, err := getTagMapping(turbo_instance, "", servers, []string{"Application", "CostCenter"}, "UNTAGGED")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNames := map[string]string{"Application:Payroll": "Payroll", "CostCenter:CC2": "CC2", "UNTAGGED": "UNTAGGED"}
+	if !reflect.DeepEqual(mapping.appId2Name, wantNames) {
+		t.Errorf("apps = %v, want %v", mapping.appId2Name, wantNames)
+	}
+	// Both web01s are kept and db01, whose tags couldn't be read, is left out
+	wantServers := map[string][]string{"Application:Payroll": {"web01", "web01 (u2)"}, "CostCenter:CC2": {"batch01"}, "UNTAGGED": {"test01"}}
+	if !reflect.DeepEqual(mapping.appId2Servers, wantServers) {
+		t.Errorf("servers = %v, want %v", mapping.appId2Servers, wantServers)
+	}
+	if uuids := mapping.appServerUuids["Application:Payroll"]; uuids["web01"] != "u1" || uuids["web01 (u2)"] != "u2" {
+		t.Errorf("Payroll UUIDs = %v", uuids)
+	}
+}
+
+func TestGetTagMappingAllFail(t *testing.T) {
+	turbo_instance := startFakeTurboTags(t, nil)
+	if _, err := getTagMapping(turbo_instance, "", map[string]string{"u1": "web01", "u2": "db01"}, []string{"Application"}, "UNTAGGED"); err == nil {
+		t.Error("expected an error when no tags can be read")
+	}
+}
+
+func TestTagApplication(t *testing.T) {
+	tags := map[string][]string{"application": {"Payroll"}, "Application": {""}, "Owner": {"alice", "bob"}}
+	cases := []struct {
+		keys  []string
+		appId string
+		name  string
+	}{
+		// The exact key has no value so the one that only differs by case is used
+		{[]string{"Application"}, "Application:Payroll", "Payroll"},
+		{[]string{"Owner", "Application"}, "Owner:alice", "alice"},
+		{[]string{"CostCenter"}, "", ""},
+	}
+	for _, c := range cases {
+		appId, name := tagApplication(tags, c.keys)
+		if appId != c.appId || name != c.name {
+			t.Errorf("tagApplication(%v) = %q, %q, want %q, %q", c.keys, appId, name, c.appId, c.name)
+		}
+	}
+}
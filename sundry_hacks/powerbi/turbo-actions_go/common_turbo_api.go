@@ -0,0 +1,182 @@
+package main
+
+/*
+Helpers for calling the Turbo REST API that are shared by the tools in this directory.
+All calls expect the session cookie returned by the tool's turboLogin.
+*/
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Client that ignores the self-signed cert Turbo usually has
+func newTurboClient() *http.Client {
+	customTransport := http.DefaultTransport.(*http.Transport).Clone()
+	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Transport: customTransport}
+}
+
+// Makes a single call to the Turbo API.
+// path is relative to /vmturbo/rest (e.g. "/search?types=BusinessApplication"). body may be nil.
+// Returns the response body and headers. Any non-2xx status is returned as an error along with the body.
+func turboApiRequest(turbo_instance string, auth string, method string, path string, body []byte) ([]byte, http.Header, error) {
+	url := "https://" + turbo_instance + "/vmturbo/rest" + path
+
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Cookie", auth)
+
+	res, err := newTurboClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	responseBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, res.Header, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseBody, res.Header, &turboApiError{status: res.StatusCode, method: method, path: path, body: responseBody}
+	}
+	return responseBody, res.Header, nil
+}
+
+// Non-2xx response from the Turbo API
+type turboApiError struct {
+	status int
+	method string
+	path   string
+	// The response body, which usually has Turbo's error message
+	body []byte
+}
+
+func (e *turboApiError) Error() string {
+	return fmt.Sprintf("%s %s returned %d %s", e.method, e.path, e.status, http.StatusText(e.status))
+}
+
+// Calls a Turbo API that returns a JSON array and follows x-next-cursor until all the results have been gathered.
+func turboApiGetAll(turbo_instance string, auth string, method string, path string, body []byte) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	url := path
+	for {
+		responseBody, header, err := turboApiRequest(turbo_instance, auth, method, url, body)
+		if err != nil {
+			return results, err
+		}
+
+		var page []map[string]interface{}
+		if err := json.Unmarshal(responseBody, &page); err != nil {
+			return results, fmt.Errorf("decoding response from %s: %v", path, err)
+		}
+		results = append(results, page...)
+
+		cursor := header.Get("x-next-cursor")
+		if len(cursor) == 0 {
+			return results, nil
+		}
+		url = path + separator + "cursor=" + cursor
+	}
+}
+
+// Finds entities (or groups) of the given class whose name is exactly the given name.
+// filterType is the search filter for the class's name, e.g. groupsByName or busAppsByName.
+// The name is escaped so that characters like parentheses and dots in the name are matched literally.
+func turboSearchByName(turbo_instance string, auth string, className string, filterType string, name string, caseSensitive bool) ([]map[string]interface{}, error) {
+	return turboSearchByRegex(turbo_instance, auth, className, filterType, "^"+regexp.QuoteMeta(name)+"$", caseSensitive)
+}
+
+// Finds entities (or groups) of the given class whose name matches the regular expression.
+func turboSearchByRegex(turbo_instance string, auth string, className string, filterType string, expression string, caseSensitive bool) ([]map[string]interface{}, error) {
+	search := map[string]interface{}{
+		"className": className,
+		"criteriaList": []map[string]interface{}{
+			{
+				"expType":       "RXEQ",
+				"expVal":        expression,
+				"filterType":    filterType,
+				"caseSensitive": caseSensitive,
+			},
+		},
+		"logicalOperator": "AND",
+	}
+	body, _ := json.Marshal(search)
+	return turboApiGetAll(turbo_instance, auth, "POST", "/search", body)
+}
+
+// Finds the entities of the given class in the supply chain of the given scope (e.g. a business application's UUID).
+// Turbo returns a 400 if there are none of that class in the scope (see js_console_hacks/Create_Business_Application_VMandDB_Groups_XL.js)
+// so a 400 whose error message is about the scope is treated as no entities. Any other 400, e.g. for a bad class name, is an error.
+func turboScopedSearch(turbo_instance string, auth string, className string, scopeUuid string) ([]map[string]interface{}, error) {
+	search := map[string]interface{}{
+		"className":       className,
+		"criteriaList":    []interface{}{},
+		"logicalOperator": "AND",
+		"environmentType": "HYBRID",
+		"scope":           []string{scopeUuid},
+	}
+	body, _ := json.Marshal(search)
+	entities, err := turboApiGetAll(turbo_instance, auth, "POST", "/search", body)
+	if apiErr, ok := err.(*turboApiError); ok && apiErr.status == http.StatusBadRequest && isEmptyScopeError(apiErr.body, scopeUuid) {
+		return nil, nil
+	}
+	return entities, err
+}
+
+// Whether the body of a 400 from a scoped search is Turbo's error for a scope without entities of the class,
+// i.e. its message mentions the scope. Turbo's errors look like {"type": "Error", "exception": "...", "message": "..."}.
+func isEmptyScopeError(body []byte, scopeUuid string) bool {
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiError); err != nil {
+		return false
+	}
+	message := strings.ToLower(apiError.Message)
+	return strings.Contains(message, "scope") || strings.Contains(message, strings.ToLower(scopeUuid))
+}
+
+// Returns the string value of a field in a decoded API response, or "" if it isn't there or isn't a string
+func jsonString(object map[string]interface{}, field string) string {
+	value, _ := object[field].(string)
+	return value
+}
+
+// The value of a stat from /stats, or -1 if it doesn't have one
+func statValue(stat map[string]interface{}) float64 {
+	if value, ok := stat["value"].(float64); ok {
+		return value
+	}
+	return -1
+}
+
+// A value from one of the stat's value objects, e.g. capacity.total, or -1 if it isn't there
+func statNumber(stat map[string]interface{}, object string, field string) float64 {
+	values, ok := stat[object].(map[string]interface{})
+	if !ok {
+		return -1
+	}
+	if value, ok := values[field].(float64); ok {
+		return value
+	}
+	return -1
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func startFakeTurbo(t *testing.T, mux *http.ServeMux) string {
+	t.Helper()
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestTurboApiGetAllFollowsCursor(t *testing.T) {
+	// Cursor -> the page of results and the next cursor
+	pages := map[string]struct {
+		uuids []string
+		next  string
+	}{
+		"":  {[]string{"a", "b"}, "2"},
+		"2": {[]string{"c", "d"}, "4"},
+		"4": {[]string{"e"}, ""},
+	}
+	var queries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		page := pages[r.URL.Query().Get("cursor")]
+		var results []map[string]string
+		for _, uuid := range page.uuids {
+			results = append(results, map[string]string{"uuid": uuid})
+		}
+		if page.next != "" {
+			w.Header().Set("x-next-cursor", page.next)
+		}
+		data, _ := json.Marshal(results)
+		w.Write(data)
+	})
+
+	results, err := turboApiGetAll(startFakeTurbo(t, mux), "", "GET", "/search?types=VirtualMachine", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuids []string
+	for _, result := range results {
+		uuids = append(uuids, jsonString(result, "uuid"))
+	}
+	if strings.Join(uuids, ",") != "a,b,c,d,e" {
+		t.Errorf("got %v, want all 5 results in order", uuids)
+	}
+	// The cursor is added to the path's own query
+	want := []string{"types=VirtualMachine", "types=VirtualMachine&cursor=2", "types=VirtualMachine&cursor=4"}
+	if !reflect.DeepEqual(queries, want) {
+		t.Errorf("queries = %v, want %v", queries, want)
+	}
+}
+
+func TestTurboApiGetAllStopsOnError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/groups/g1/members", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") != "" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("x-next-cursor", "1")
+		w.Write([]byte(`[{"uuid": "a"}]`))
+	})
+
+	results, err := turboApiGetAll(startFakeTurbo(t, mux), "", "GET", "/groups/g1/members", nil)
+	if apiErr, ok := err.(*turboApiError); !ok || apiErr.status != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want the 500", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results, want the first page", len(results))
+	}
+}
+
+func TestTurboScopedSearch(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{"entities", http.StatusOK, `[{"uuid": "v1"}, {"uuid": "v2"}]`, 2, false},
+		{"empty scope", http.StatusBadRequest, `{"type": "Error", "exception": "java.lang.IllegalArgumentException", "message": "Invalid scope: app1"}`, 0, false},
+		{"empty scope by uuid", http.StatusBadRequest, `{"type": "Error", "message": "No VirtualMachine found for APP1"}`, 0, false},
+		{"other bad request", http.StatusBadRequest, `{"type": "Error", "message": "Unknown class name: VirtualMachin"}`, 0, true},
+		{"bad request without a message", http.StatusBadRequest, `Bad Request`, 0, true},
+		{"server error", http.StatusInternalServerError, `{"type": "Error", "message": "Invalid scope: app1"}`, 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var search map[string]interface{}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				json.Unmarshal(body, &search)
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			})
+
+			entities, err := turboScopedSearch(startFakeTurbo(t, mux), "", "VirtualMachine", "app1")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, want error %v", err, c.wantErr)
+			}
+			if len(entities) != c.want {
+				t.Errorf("got %d entities, want %d", len(entities), c.want)
+			}
+			if search["className"] != "VirtualMachine" || !reflect.DeepEqual(search["scope"], []interface{}{"app1"}) {
+				t.Errorf("searched for %v", search)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+/*
+Local stand-in for a Power BI streaming/push dataset endpoint.
+
+It records the rows it receives, validates them against a declared dataset schema and can be told to
+return 400/429/500 responses or to add latency. It is used two ways:
+- by the tests (see startFakePowerBi and the assert* methods in fake_powerbi_test.go) for exercising pushPowerBiData
+  and its throttling logic.
+- as the engine behind the fake_powerbi_server.go standalone binary for rehearsing runs on a laptop with no network.
+It isn't named common_*.go so it isn't built into the tools themselves, only into fake_powerbi_server and the tests.
+
+It is deliberately forgiving about what it accepts as a body: either a JSON array of rows (what a streaming dataset
+push URL takes) or {"rows": [...]} (what the push dataset REST API takes).
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Column of a Power BI dataset as declared when creating the dataset (e.g. Timestamp (DateTime))
+type powerBiColumn struct {
+	name       string
+	columnType string
+}
+
+// Datasets the tools in this directory push to, keyed by a short name that can be given to fake_powerbi_server -dataset.
+// These must be kept in sync with the field lists printed by each tool's usage output.
+var powerBiDatasets = map[string]string{
+	"resize": "Timestamp:DateTime,Component_ID:Text,Component_Name:Text,Server_Name:Text,Action_Details:Text,Action_Type:Text,Action_From:Text,Action_To:Text,Reason:Text,Severity:Text,Category:Text,Savings_Per_Month:Number,Investment_Per_Month:Number,Action_From_Value:Number,Action_To_Value:Number,Action_Unit:Text",
+	// The resize dataset for mapping CSVs with Server_Name patterns
+	"resize_patterns":  "Timestamp:DateTime,Component_ID:Text,Component_Name:Text,Server_Name:Text,Action_Details:Text,Action_Type:Text,Action_From:Text,Action_To:Text,Reason:Text,Severity:Text,Category:Text,Savings_Per_Month:Number,Investment_Per_Month:Number,Action_From_Value:Number,Action_To_Value:Number,Action_Unit:Text,Server_Pattern:Text",
+	"stats":            "Timestamp:DateTime,Entity_Name:Text,Entity_UUID:Text,Entity_Type:Text,Component_Name:Text,Stat_Name:Text,Measure:Text,Value:Number,Threshold:Number,Days:Number",
+	"history":          "Timestamp:DateTime,Component_ID:Text,Component_Name:Text,Server_Name:Text,Action_UUID:Text,Action_Type:Text,Action_Details:Text,Action_From:Text,Action_To:Text,Outcome:Text,Created_Time:DateTime,Executed_Time:DateTime,Savings_Per_Month:Number,Realized_Savings_Per_Month:Number,Realized_Investment_Per_Month:Number",
+	"reconcile":        "Timestamp:DateTime,Status:Text,Component_ID:Text,Component_Name:Text,Server_Name:Text,Server_UUID:Text,Action_Count:Number",
+	"ri":               "Timestamp:DateTime,Server_Name:Text,Server_UUID:Text,Account_Name:Text,Instance_Family:Text,Action_Type:Text,Action_From:Text,Action_To:Text,RI_Coverage_Before:Number,RI_Coverage_After:Number,RI_Utilization_Before:Number,RI_Utilization_After:Number,RI_Improving:Boolean,Savings_Per_Month:Number,Investment_Per_Month:Number,Action_Details:Text,Reason:Text",
+	"accounts":         "Timestamp:DateTime,Account_ID:Text,Account_Name:Text,Cloud_Type:Text,Server_Name:Text,Server_UUID:Text,Action_Details:Text,Action_Type:Text,Action_From:Text,Action_To:Text,Reason:Text,Severity:Text,Category:Text,Savings_Per_Month:Number,Investment_Per_Month:Number",
+	"cluster_capacity": "Timestamp:DateTime,Cluster_Name:Text,CPU_Utilization:Number,Mem_Utilization:Number,Storage_Utilization:Number,CPU_Headroom:Number,Mem_Headroom:Number,Storage_Headroom:Number,VM_Headroom:Number,Host_Count:Number,VM_Count:Number",
+	"cluster_summary":  "Timestamp:DateTime,Cluster_Name:Text,Action_Count:Number,Provision_Count:Number,Suspend_Count:Number,Move_Count:Number,Resize_Count:Number,Other_Count:Number,Critical_Count:Number,Major_Count:Number,Minor_Count:Number,Normal_Count:Number",
+	"cluster":          "Timestamp:DateTime,Cluster_Name:Text,Entity_Name:Text,Entity_Type:Text,Action_Type:Text,Action_Details:Text,Reason:Text,Severity:Text,Category:Text,Action_From:Text,Action_From_Type:Text,Action_To:Text,Action_To_Type:Text,Action_To_Cluster:Text",
+	// The cluster dataset when -csv_file is given
+	"cluster_impact": "Timestamp:DateTime,Cluster_Name:Text,Entity_Name:Text,Entity_Type:Text,Action_Type:Text,Action_Details:Text,Reason:Text,Severity:Text,Category:Text,Action_From:Text,Action_From_Type:Text,Action_To:Text,Action_To_Type:Text,Action_To_Cluster:Text,Impacted_Applications:Text",
+}
+
+// Parses a schema of the form "Name:Type,Name:Type,..." where Type is one of Text, DateTime, Number or Boolean.
+// A column without a type is taken to be Text.
+func parsePowerBiSchema(spec string) ([]powerBiColumn, error) {
+	var schema []powerBiColumn
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		column := powerBiColumn{name: strings.TrimSpace(parts[0]), columnType: "Text"}
+		if len(parts) == 2 {
+			column.columnType = strings.TrimSpace(parts[1])
+		}
+		switch column.columnType {
+		case "Text", "DateTime", "Number", "Boolean":
+		default:
+			return nil, fmt.Errorf("column %s has unsupported type %s", column.name, column.columnType)
+		}
+		schema = append(schema, column)
+	}
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("no columns found in schema %q", spec)
+	}
+	return schema, nil
+}
+
+// One POST as seen by the fake endpoint
+type fakePowerBiPost struct {
+	received time.Time
+	status   int
+	rows     []map[string]interface{}
+}
+
+type fakePowerBi struct {
+	mu sync.Mutex
+
+	schema []powerBiColumn
+	// When strict, a row missing any of the schema's columns is a schema error.
+	strict bool
+
+	// Status codes to return, in order, for the next POSTs (0 means behave normally)
+	injectedStatus []int
+	latency        time.Duration
+
+	// Emulates Power BI's requests-per-window limit by returning 429 once exceeded. 0 disables it.
+	rateLimit   int
+	rateWindow  time.Duration
+	windowStart time.Time
+	windowCount int
+
+	posts        []fakePowerBiPost
+	rows         []map[string]interface{}
+	schemaErrors []string
+}
+
+func newFakePowerBi(schema []powerBiColumn) *fakePowerBi {
+	return &fakePowerBi{schema: schema}
+}
+
+// Makes the next POSTs return the given status codes, one per POST, before going back to normal.
+func (fake *fakePowerBi) injectStatus(codes ...int) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.injectedStatus = append(fake.injectedStatus, codes...)
+}
+
+// Adds a delay before every response.
+func (fake *fakePowerBi) setLatency(latency time.Duration) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.latency = latency
+}
+
+// Returns 429 for any POST beyond the given number within the window. Power BI allows 120 POSTs per minute.
+func (fake *fakePowerBi) setRateLimit(posts int, window time.Duration) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.rateLimit = posts
+	fake.rateWindow = window
+	fake.windowStart = time.Time{}
+	fake.windowCount = 0
+}
+
+func (fake *fakePowerBi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	latency := fake.latency
+	fake.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	post := fakePowerBiPost{received: time.Now()}
+	status := fake.nextStatus(post.received)
+	if status == 0 {
+		rows, errs := fake.decodeRows(body)
+		post.rows = rows
+		if len(errs) > 0 {
+			fake.schemaErrors = append(fake.schemaErrors, errs...)
+			status = http.StatusBadRequest
+		} else {
+			fake.rows = append(fake.rows, rows...)
+			status = http.StatusOK
+		}
+	}
+	post.status = status
+	fake.posts = append(fake.posts, post)
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(int(fake.rateWindow.Seconds())))
+	}
+	w.WriteHeader(status)
+}
+
+// Works out if this POST gets an injected or rate limited status. Returns 0 if it should be processed normally.
+// Must be called with the lock held.
+func (fake *fakePowerBi) nextStatus(now time.Time) int {
+	if len(fake.injectedStatus) > 0 {
+		status := fake.injectedStatus[0]
+		fake.injectedStatus = fake.injectedStatus[1:]
+		if status != 0 {
+			return status
+		}
+	}
+	if fake.rateLimit > 0 {
+		if fake.windowStart.IsZero() || now.Sub(fake.windowStart) >= fake.rateWindow {
+			fake.windowStart = now
+			fake.windowCount = 0
+		}
+		fake.windowCount++
+		if fake.windowCount > fake.rateLimit {
+			return http.StatusTooManyRequests
+		}
+	}
+	return 0
+}
+
+// Decodes a POST body into rows and checks each row against the schema.
+func (fake *fakePowerBi) decodeRows(body []byte) ([]map[string]interface{}, []string) {
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		var wrapped struct {
+			Rows []map[string]interface{} `json:"rows"`
+		}
+		if err2 := json.Unmarshal(body, &wrapped); err2 != nil {
+			return nil, []string{fmt.Sprintf("post %d: body is not a JSON array of rows: %v", len(fake.posts)+1, err)}
+		}
+		rows = wrapped.Rows
+	}
+
+	var errs []string
+	for i, row := range rows {
+		for _, problem := range fake.checkRow(row) {
+			errs = append(errs, fmt.Sprintf("post %d row %d: %s", len(fake.posts)+1, i+1, problem))
+		}
+	}
+	return rows, errs
+}
+
+func (fake *fakePowerBi) checkRow(row map[string]interface{}) []string {
+	var problems []string
+	declared := make(map[string]string)
+	for _, column := range fake.schema {
+		declared[column.name] = column.columnType
+	}
+
+	var names []string
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		columnType, ok := declared[name]
+		if !ok {
+			problems = append(problems, "unknown column "+name)
+			continue
+		}
+		if problem := checkPowerBiValue(columnType, row[name]); problem != "" {
+			problems = append(problems, name+": "+problem)
+		}
+	}
+
+	if fake.strict {
+		for _, column := range fake.schema {
+			if _, ok := row[column.name]; !ok {
+				problems = append(problems, "missing column "+column.name)
+			}
+		}
+	}
+	return problems
+}
+
+func checkPowerBiValue(columnType string, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch columnType {
+	case "Text":
+		if _, ok := value.(string); !ok {
+			return fmt.Sprintf("expected Text, got %v", value)
+		}
+	case "Number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Sprintf("expected Number, got %v", value)
+		}
+	case "Boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Sprintf("expected Boolean, got %v", value)
+		}
+	case "DateTime":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Sprintf("expected DateTime, got %v", value)
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Sprintf("expected RFC3339 DateTime, got %q", s)
+		}
+	}
+	return ""
+}
+
+// Rows accepted so far (rows from rejected POSTs are not included)
+func (fake *fakePowerBi) receivedRows() []map[string]interface{} {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]map[string]interface{}(nil), fake.rows...)
+}
+
+// Number of POSTs received, including rejected ones
+func (fake *fakePowerBi) postCount() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return len(fake.posts)
+}
+
+// Status code returned for each POST, in order
+func (fake *fakePowerBi) postStatuses() []int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var statuses []int
+	for _, post := range fake.posts {
+		statuses = append(statuses, post.status)
+	}
+	return statuses
+}
+
+func (fake *fakePowerBi) schemaProblems() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]string(nil), fake.schemaErrors...)
+}
+
+// Returns the accepted rows where each given column has the given value.
+func (fake *fakePowerBi) rowsWhere(match map[string]interface{}) []map[string]interface{} {
+	var found []map[string]interface{}
+	for _, row := range fake.receivedRows() {
+		matched := true
+		for name, want := range match {
+			if row[name] != want {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, row)
+		}
+	}
+	return found
+}
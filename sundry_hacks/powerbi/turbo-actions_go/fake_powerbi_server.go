@@ -0,0 +1,146 @@
+package main
+
+/*
+.SYNOPSIS
+
+.DESCRIPTION
+Runs a local stand-in for a Power BI streaming dataset push URL so the push_turbo_* tools can be rehearsed without network access.
+Received rows are validated against the dataset schema and logged. Errors and latency can be injected.
+
+.EXAMPLE
+fake_powerbi_server -dataset resize -port 8089
+Then run push_turbo_resize_actions with -powerbi_stream_url http://localhost:8089/rows
+
+fake_powerbi_server -dataset cluster -fail 429,500 -latency 2s -rate_limit 120
+The first POST gets a 429, the second a 500, every POST is delayed 2 seconds and more than 120 POSTs a minute get a 429.
+
+.PARAMETER port
+Port to listen on. Default is 8089.
+
+.PARAMETER dataset
+Name of a known dataset schema: resize, resize_patterns, ri, accounts, stats, history, reconcile, cluster, cluster_impact, cluster_summary or cluster_capacity.
+
+.PARAMETER schema
+Schema given as "Name:Type,Name:Type,...". Type is Text, DateTime, Number or Boolean. Overrides -dataset.
+
+.PARAMETER strict
+Treat rows that are missing a schema column as schema errors.
+
+.PARAMETER fail
+Comma separated list of status codes to return for the first POSTs received (e.g. 400,429,500). Use 0 to let a POST through.
+
+.PARAMETER latency
+Delay added to every response (e.g. 500ms, 2s).
+
+.PARAMETER rate_limit
+Number of POSTs allowed per -rate_window before returning 429. 0 disables the limit.
+
+.PARAMETER rows_file
+If set, accepted rows are written to this file as a JSON array when the server is stopped.
+
+CROSS-COMPLIATION NOTES
+go build ./fake_powerbi_server.go ./fake_powerbi.go
+
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wraps the fake to log each POST as it comes in
+type loggingPowerBi struct {
+	fake *fakePowerBi
+}
+
+func (logger loggingPowerBi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	before := len(logger.fake.schemaProblems())
+	logger.fake.ServeHTTP(w, r)
+
+	statuses := logger.fake.postStatuses()
+	status := statuses[len(statuses)-1]
+	fmt.Printf("%s POST %d -> %d %s\n", time.Now().Format(time.RFC3339), len(statuses), status, http.StatusText(status))
+	for _, problem := range logger.fake.schemaProblems()[before:] {
+		fmt.Println("### SCHEMA ERROR ### " + problem)
+	}
+}
+
+func main() {
+
+	version := "1.0"
+	fmt.Println("fake_powerbi_server version " + version)
+
+	port := flag.Int("port", 8089, "Port to listen on")
+	dataset := flag.String("dataset", "resize", "Known dataset schema to validate against (resize, resize_patterns, ri, accounts, stats, history, reconcile, cluster, cluster_impact, cluster_summary, cluster_capacity)")
+	schema_spec := flag.String("schema", "", "Schema as \"Name:Type,...\" - overrides -dataset")
+	strict := flag.Bool("strict", false, "Rows missing a schema column are errors")
+	fail := flag.String("fail", "", "Comma separated status codes to return for the first POSTs (e.g. 429,500)")
+	latency := flag.Duration("latency", 0, "Delay added to every response")
+	rate_limit := flag.Int("rate_limit", 0, "POSTs allowed per rate window before returning 429 (0 = no limit)")
+	rate_window := flag.Duration("rate_window", time.Minute, "Rate limit window")
+	rows_file := flag.String("rows_file", "", "File to write accepted rows to on exit")
+
+	flag.Parse()
+
+	spec := *schema_spec
+	if spec == "" {
+		var ok bool
+		spec, ok = powerBiDatasets[*dataset]
+		if !ok {
+			fmt.Println("*** Unknown dataset: " + *dataset)
+			os.Exit(1)
+		}
+	}
+	schema, err := parsePowerBiSchema(spec)
+	if err != nil {
+		fmt.Println("*** Bad schema: " + err.Error())
+		os.Exit(1)
+	}
+
+	fake := newFakePowerBi(schema)
+	fake.strict = *strict
+	fake.setLatency(*latency)
+	if *rate_limit > 0 {
+		fake.setRateLimit(*rate_limit, *rate_window)
+	}
+	if *fail != "" {
+		for _, code := range strings.Split(*fail, ",") {
+			status, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				fmt.Println("*** Bad -fail status code: " + code)
+				os.Exit(1)
+			}
+			fake.injectStatus(status)
+		}
+	}
+
+	// Print a summary (and save the rows) when stopped with Ctrl-C
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		fmt.Printf("\nReceived %d POSTs, accepted %d rows, %d schema errors.\n", fake.postCount(), len(fake.receivedRows()), len(fake.schemaProblems()))
+		if *rows_file != "" {
+			data, _ := json.MarshalIndent(fake.receivedRows(), "", "  ")
+			if err := ioutil.WriteFile(*rows_file, data, 0644); err != nil {
+				fmt.Println("*** Error writing file: " + *rows_file)
+			}
+		}
+		os.Exit(0)
+	}()
+
+	addr := ":" + strconv.Itoa(*port)
+	fmt.Println("Listening on http://localhost" + addr + " - use any path as the -powerbi_stream_url")
+	if err := http.ListenAndServe(addr, loggingPowerBi{fake: fake}); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+// Test helpers for the fake Power BI endpoint in fake_powerbi.go. They are kept out of that file so the testing
+// package isn't built into fake_powerbi_server.
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// Starts a fake endpoint for the duration of a test and returns it along with the URL to push to.
+func startFakePowerBi(t testing.TB, schemaSpec string) (*fakePowerBi, string) {
+	t.Helper()
+	if spec, ok := powerBiDatasets[schemaSpec]; ok {
+		schemaSpec = spec
+	}
+	schema, err := parsePowerBiSchema(schemaSpec)
+	if err != nil {
+		t.Fatalf("fake Power BI: %v", err)
+	}
+	fake := newFakePowerBi(schema)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL + "/beta/fake-dataset/rows?key=fake"
+}
+
+func (fake *fakePowerBi) assertRowCount(t testing.TB, want int) {
+	t.Helper()
+	if got := len(fake.receivedRows()); got != want {
+		t.Errorf("fake Power BI received %d rows, want %d", got, want)
+	}
+}
+
+func (fake *fakePowerBi) assertPostCount(t testing.TB, want int) {
+	t.Helper()
+	if got := fake.postCount(); got != want {
+		t.Errorf("fake Power BI received %d POSTs, want %d", got, want)
+	}
+}
+
+func (fake *fakePowerBi) assertNoSchemaErrors(t testing.TB) {
+	t.Helper()
+	for _, problem := range fake.schemaProblems() {
+		t.Errorf("fake Power BI schema error: %s", problem)
+	}
+}
+
+func (fake *fakePowerBi) assertRowsWhere(t testing.TB, match map[string]interface{}, want int) {
+	t.Helper()
+	if got := len(fake.rowsWhere(match)); got != want {
+		t.Errorf("fake Power BI has %d rows matching %v, want %d", got, match, want)
+	}
+}
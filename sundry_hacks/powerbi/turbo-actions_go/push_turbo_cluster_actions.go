@@ -15,6 +15,13 @@ Requires a Power BI streaming dataset defined with the following fields:
 - Reason (Text)
 - Severity (Text)
 - Category (Text)
+- Action_From (Text) (MOVE: current host/datastore, PROVISION: host to clone, SUSPEND: host to suspend)
+- Action_From_Type (Text) (e.g. PhysicalMachine, Storage)
+- Action_To (Text) (MOVE: destination host/datastore, PROVISION: the new host if Turbo names it)
+- Action_To_Type (Text)
+- Action_To_Cluster (Text) (MOVE: cluster of the destination host if it is in one of the group's clusters)
+If -csv_file is given, the dataset also needs:
+- Impacted_Applications (Text) (applications of the VM being moved, or of the VMs on the host or datastore, separated by "; ")
 
 .EXAMPLE
 push_turbo-cluster-host_actions -turbo_instance turbonomic.mycompany.com -turbo_user USERNAME - turbo_password PASSWORD -cluster_group CLUSTER_GROUP_NAME -powerbi_stream_url POWERBI_DATASET_URL -csv_file APPSERVER.csv
@@ -31,14 +38,65 @@ Specify the username for accessing Turbo.
 Specify the password for accessing Turbo. 
 
 .PARAMETER cluster_group
-Specify the name of the cluster group defined in Turbo for which to get the host actions.
+Specify the name or UUID of the cluster group defined in Turbo for which to get the host actions.
+By default the name must match exactly (see -group_match). If more than one group matches, the matching groups are listed
+so the UUID of the right one can be given instead.
+Give -cluster_group more than once to report on several groups, e.g. -cluster_group "Prod Clusters" -cluster_group "DR Clusters".
+The group may be a group of clusters, a group of groups (expanded all the way down) or a group of hosts (the hosts' clusters are used).
+A cluster reached through more than one group is only reported once.
+
+.PARAMETER group_match
+How -cluster_group is matched to group names:
+- exact (default): the name exactly as given, including case. Characters like ( ) . are not treated specially.
+- ignore_case: the name as given but not case sensitive.
+- regex: -cluster_group is a regular expression, e.g. "^Prod.*Clusters$". All the groups it matches are used.
+
+.PARAMETER csv_file
+Optional. The application to server mapping CSV used by push_turbo_resize_actions ("Component_Id", "Component_Name" and "Server_Name" columns,
+optionally "Server_UUID"). Each action row then says which applications it affects in Impacted_Applications.
 
 .PARAMETER powerbi_stream_url
 Currently, this is the URL with the key that one gets when creating a Streaming DataSet set in PowerBI.
 (Eventually, this may be replaced with a PowerBI API credentials as configured via registering an app from dev.powerbi.com or a service prinicipal creds.)
 
+.PARAMETER capacity_output
+Optional. A second PowerBI Stream Dataset URL (or a CSV file) for the capacity and headroom of each cluster.
+Each run sends one row per cluster with the same Timestamp as the action rows so the two can be shown side by side.
+The dataset needs the following fields:
+- Timestamp (DateTime)
+- Cluster_Name (Text)
+- CPU_Utilization (Number) (percent)
+- Mem_Utilization (Number) (percent)
+- Storage_Utilization (Number) (percent)
+- CPU_Headroom (Number) (VMs that still fit by CPU)
+- Mem_Headroom (Number) (VMs that still fit by memory)
+- Storage_Headroom (Number) (VMs that still fit by storage)
+- VM_Headroom (Number) (the smallest of the three)
+- Host_Count (Number)
+- VM_Count (Number)
+Stats Turbo doesn't give for a cluster are left blank.
+
+.PARAMETER summary_output
+Optional. A PowerBI Stream Dataset URL (or a CSV file) for a summary row per cluster per run, including clusters with no actions.
+The dataset needs the following fields:
+- Timestamp (DateTime)
+- Cluster_Name (Text)
+- Action_Count (Number)
+- Provision_Count (Number)
+- Suspend_Count (Number)
+- Move_Count (Number)
+- Resize_Count (Number) (RESIZE, RIGHT_SIZE and SCALE)
+- Other_Count (Number)
+- Critical_Count (Number)
+- Major_Count (Number)
+- Minor_Count (Number)
+- Normal_Count (Number)
+
 CROSS-COMPLIATION NOTES
-env GOOS=windows GOARCH=amd64 go build ./push_turbo_cluster_actions.go
+env GOOS=windows GOARCH=amd64 go build ./push_turbo_cluster_actions.go ./cluster_*.go ./common_*.go
+
+TESTING NOTES
+go test ./push_turbo_cluster_actions.go ./cluster_*.go ./common_*.go ./fake_powerbi.go ./fake_powerbi_test.go
 
 */
 
@@ -54,6 +112,7 @@ import (
     "crypto/tls"
     "flag"
     "os"
+    "sort"
     "time"
     //"reflect"
 )
@@ -65,7 +124,12 @@ type Action struct {
 	entityType string
 	entityName string
 	actionFrom string
+	actionFromType string
 	actionTo string
+	actionToType string
+	actionToCluster string
+	entityUuid string
+	impactedApps string
 	reason string
 	severity string
 	category string
@@ -74,25 +138,42 @@ type Action struct {
 func main() {
 
 	// 1.0 version: Initial version
-	version := "1.0"
+	// 1.1 MINOR VERSION NOTE: Added Action_From/Action_To (and their types) for MOVE, PROVISION and SUSPEND actions, and the destination cluster for MOVEs.
+	//                        No longer crashes if the PowerBI POST fails outright.
+	// 1.2 MINOR VERSION NOTE: -cluster_group may be a UUID and names are matched exactly (see -group_match). Several matching groups or none is an error.
+	// 1.3 MINOR VERSION NOTE: -cluster_group can be given more than once and may be a group of groups or of hosts. Regex matches use all matching groups.
+	// 1.4 MINOR VERSION NOTE: Group members are paged through so large groups aren't cut short. Members of an unexpected type are skipped with a warning.
+	// 1.5 MINOR VERSION NOTE: Added -capacity_output for a table of cluster utilization, VM headroom and host/VM counts.
+	// 1.6 MINOR VERSION NOTE: Added -summary_output for a row per cluster with action counts by type and severity, so clusters without actions show up too.
+	// 1.7 MINOR VERSION NOTE: Added -csv_file to add the applications affected by each action (Impacted_Applications).
+	// 1.8 MINOR VERSION NOTE: A host or datastore whose VMs can't be found leaves its actions' Impacted_Applications blank instead of stopping the run.
+	// 1.9 MINOR VERSION NOTE: Action rows are sent through the shared row sink, so names with quotes in them no longer break the POST
+	//                        and the throttling is the same as the resize tool's.
+	// 1.10 MINOR VERSION NOTE: The -capacity_output headroom columns are the VMs that still fit (capacity less the VMs placed) rather than the VMs placed.
+	version := "1.10"
 	fmt.Println("push_turbo-cluster-host_actions version "+version)
 
 	// Process command line arguments
 	turbo_user := flag.String("turbo_user", "", "Turbo Username")
 	turbo_password:= flag.String("turbo_password", "", "Turbo Password")
 	turbo_instance := flag.String("turbo_instance", "", "Turbo IP or FQDN")
-	cluster_group := flag.String("cluster_group", "", "Turbo Cluster Group Name")
+	var cluster_groups clusterGroupList
+	flag.Var(&cluster_groups, "cluster_group", "Turbo Cluster Group Name or UUID (may be given more than once)")
+	group_match := flag.String("group_match", "exact", "How to match -cluster_group to group names: exact, ignore_case or regex")
 	powerbi_stream_url := flag.String("powerbi_stream_url", "", "URL for the PowerBI Stream Dataset")
+	csv_file := flag.String("csv_file", "", "CSV File containing App to Server mapping, to add the impacted applications to each action (optional)")
+	summary_output := flag.String("summary_output", "", "PowerBI Stream Dataset URL or CSV file for the per-cluster action count summary (optional)")
+	capacity_output := flag.String("capacity_output", "", "PowerBI Stream Dataset URL or CSV file for the cluster capacity and headroom table (optional)")
 
 	flag.Parse()
 	
-	if ((*turbo_user == "") || (*turbo_password == "") || (*turbo_instance == "") || (*cluster_group == "") || (*powerbi_stream_url == "")) {
+	if ((*turbo_user == "") || (*turbo_password == "") || (*turbo_instance == "") || (len(cluster_groups) == 0) || (*powerbi_stream_url == "")) {
 		fmt.Println("*************")
 		fmt.Println("Missing command line argument ...")
 		fmt.Println("Run \""+os.Args[0]+" -h\" for more information.")
 		fmt.Println("*************")
 		
-		fmt.Println("\n")
+		fmt.Print("\n\n")
 		fmt.Println("The PowerBI Streaming Dataset you are using must have the following fields set up with the types given in parentheses:")
 		fmt.Println()
 		fmt.Println("- Timestamp (DateTime)")
@@ -104,101 +185,144 @@ func main() {
 		fmt.Println("- Reason (Text)")
 		fmt.Println("- Severity (Text)")
 		fmt.Println("- Category (Text)")
+		fmt.Println("- Action_From (Text)")
+		fmt.Println("- Action_From_Type (Text)")
+		fmt.Println("- Action_To (Text)")
+		fmt.Println("- Action_To_Type (Text)")
+		fmt.Println("- Action_To_Cluster (Text)")
+		fmt.Println("- Impacted_Applications (Text) (only if -csv_file is given)")
 
 		os.Exit(1)
 	}
 	// end command line arguments
 	
 	time_start := time.Now()
+	// All the rows from the run get the same timestamp so the action and capacity tables line up
+	timeString := time_start.Format(time.RFC3339)
+	
+	// get auth token
+	auth := turboLogin(*turbo_instance, *turbo_user, *turbo_password) 
 	
 	// Call Turbo to get any host-level actions for the servers assigned to each application
-	fmt.Printf("*** Getting host actions from Turbo for clusters in group, %s ...\n",*cluster_group)
-	clusterActionsMap, clusterNameMap := getHostActions(*turbo_instance, *turbo_user, *turbo_password, *cluster_group) 
+	fmt.Printf("*** Getting host actions from Turbo for clusters in group(s), %s ...\n",cluster_groups.String())
+	clusterActionsMap, clusterNameMap := getHostActions(*turbo_instance, auth, cluster_groups, *group_match) 
 
 	time_now := time.Now()
 	time_elapsed := int(time_now.Sub(time_start).Seconds())
 	fmt.Printf("took %d seconds.\n\n", time_elapsed)
 	time_start = time_now
 
+	if (*csv_file != "") {
+		fmt.Println("*** Finding the applications affected by the actions ...")
+		mapping, err := readAppMappingCsv(*csv_file, csvMappingConfig{})
+		if (err != nil) {
+			fmt.Println("*** Error processing CSV file: " + err.Error())
+			os.Exit(10)
+		}
+		for _,badLine := range mapping.badLines {
+			fmt.Println("### Skipped CSV " + badLine)
+		}
+		failed := setImpactedApplications(*turbo_instance, auth, newAppImpactIndex(mapping), clusterActionsMap)
+		if (failed > 0) {
+			fmt.Printf("### Couldn't find the VMs on %d host(s) or datastore(s). Their actions have no Impacted_Applications.\n", failed)
+		}
+
+		time_now := time.Now()
+		time_elapsed := int(time_now.Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+		time_start = time_now
+	}
+
 	// Call PowerBI API to push data to the stream dataset
 	fmt.Println("*** Sending records to PowerBI ...")
-	pushPowerBiData(clusterNameMap, clusterActionsMap, *powerbi_stream_url)
+	pushPowerBiData(clusterNameMap, clusterActionsMap, timeString, *csv_file != "", *powerbi_stream_url)
 
 	time_now = time.Now()
 	time_elapsed = int(time_now.Sub(time_start).Seconds())
 	fmt.Printf("took %d seconds.\n\n", time_elapsed)
 	time_start = time_now
 	
+	if (*summary_output != "") {
+		fmt.Println("*** Sending cluster summary ...")
+		err := pushClusterSummary(clusterNameMap, clusterActionsMap, timeString, *summary_output)
+		if (err != nil) {
+			fmt.Println("### ERROR ### sending cluster summary: " + err.Error())
+		}
+	}
+
+	if (*capacity_output != "") {
+		fmt.Println("*** Getting cluster capacity from Turbo ...")
+		err := pushClusterCapacity(*turbo_instance, auth, clusterNameMap, timeString, *capacity_output)
+		if (err != nil) {
+			fmt.Println("### ERROR ### sending cluster capacity: " + err.Error())
+		}
+
+		time_now = time.Now()
+		time_elapsed = int(time_now.Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+	}
+	
 	fmt.Println("Done.")
 }
 
 
+// Columns of the action rows. Impacted_Applications is only added when -csv_file is given.
+var clusterActionColumns = []string{"Timestamp", "Cluster_Name", "Entity_Name", "Entity_Type", "Action_Type", "Action_Details", "Reason", "Severity", "Category", "Action_From", "Action_From_Type", "Action_To", "Action_To_Type", "Action_To_Cluster"}
+
 // Using the data found in the various maps, assemble API calls to push PowerBi to push the data stream
-func pushPowerBiData(clusterNameMap map[string]string, clusterActionsMap map[string][]Action, powerbi_url string) {
+// Sends one POST per cluster with actions through a rowSink, which throttles the POSTs (see powerBiThrottleCalls).
+// withImpact adds the Impacted_Applications column.
+func pushPowerBiData(clusterNameMap map[string]string, clusterActionsMap map[string][]Action, timeString string, withImpact bool, powerbi_url string) {
 
-	t := time.Now()
-	timeString := t.Format(time.RFC3339)
-  	method := "POST"
-	
-	apiCount := 0
-	for clusterUuid,clusterName := range clusterNameMap {
-		var payload string
-		action_count := 0
-		apiCount++
+	columns := clusterActionColumns
+	if (withImpact) {
+		columns = append(append([]string{}, clusterActionColumns...), "Impacted_Applications")
+	}
+	sink, err := newRowSink(powerbi_url, columns)
+	if (err != nil) {
+		fmt.Println("### ERROR ### " + err.Error())
+		return
+	}
+	defer sink.close()
+
+	// Send the clusters in name order so the output is the same from run to run
+	var clusterUuids []string
+	for clusterUuid := range clusterNameMap {
+		clusterUuids = append(clusterUuids, clusterUuid)
+	}
+	sort.Slice(clusterUuids, func(i, j int) bool {
+		return clusterNameMap[clusterUuids[i]] < clusterNameMap[clusterUuids[j]]
+	})
+
+	for _,clusterUuid := range clusterUuids {
+		clusterName := clusterNameMap[clusterUuid]
+		var rows []map[string]interface{}
 		for _,action := range clusterActionsMap[clusterUuid] {
-			timestamp_part := "\"Timestamp\": \""+timeString+"\""
-			clustername_part := "\"Cluster_Name\": \""+clusterName+"\""
-			entityname_part := "\"Entity_Name\": \""+action.entityName+"\""
-			entitytype_part := "\"Entity_Type\": \""+action.entityType+"\""
-			actiontype_part := "\"Action_Type\": \""+action.actionType+"\""
-			actiondetails_part := "\"Action_Details\": \""+action.actionDetails+"\""
-			//actionfrom_part := "\"Action_From\": \""+action.actionFrom+"\""
-			//actionto_part := "\"Action_To\": \""+action.actionTo+"\""
-			reason_part := "\"Reason\": \""+action.reason+"\""
-			severity_part := "\"Severity\": \""+action.severity+"\""
-			category_part := "\"Category\": \""+action.category+"\""
-				
-			//action_payload := "{"+timestamp_part+","+clustername_part+","+entityname_part+","+entitytype_part+","+actiondetails_part+","+actiontype_part+","+actionfrom_part+","+actionto_part+","+reason_part+","+severity_part+","+category_part+"}"
-			action_payload := "{"+timestamp_part+","+clustername_part+","+entityname_part+","+entitytype_part+","+actiondetails_part+","+actiontype_part+","+reason_part+","+severity_part+","+category_part+"}"
-			action_count++ 
-			if (payload == "") {
-				payload =  "[" + action_payload
-			} else {
-				payload = payload + "," + action_payload
-			}
-	  	}
-	  	payload = payload + "]"
-	  	
-	  	if (action_count > 0) {
-			client := &http.Client {}
-			req, err := http.NewRequest(method, powerbi_url, strings.NewReader(payload))
-			if err != nil {
-				fmt.Println(err)
+			row := map[string]interface{}{
+				"Timestamp": timeString,
+				"Cluster_Name": clusterName,
+				"Entity_Name": action.entityName,
+				"Entity_Type": action.entityType,
+				"Action_Type": action.actionType,
+				"Action_Details": action.actionDetails,
+				"Reason": action.reason,
+				"Severity": action.severity,
+				"Category": action.category,
+				"Action_From": action.actionFrom,
+				"Action_From_Type": action.actionFromType,
+				"Action_To": action.actionTo,
+				"Action_To_Type": action.actionToType,
+				"Action_To_Cluster": action.actionToCluster,
 			}
-			req.Header.Add("Content-Type", "application/json")
-		
-// 		// For debugging HTTP Call
-// 		requestDump, err := httputil.DumpRequest(req, true)
-// 		if err != nil {
-// 				fmt.Println(err)
-// 		}
-// 		fmt.Println(string(requestDump))
-// 		// END DEBUGGING
-	
-			res, _:= client.Do(req)
-			defer res.Body.Close()
-			
-			if (res.StatusCode != 200) {
-				fmt.Printf("### ERROR ### sending %d records for cluster %s\n", action_count, clusterName) 
-				fmt.Println("### HTML ERROR ### ", res.StatusCode, http.StatusText(res.StatusCode))
-			} else {
-				fmt.Printf("... sent %d records(s) for cluster %s\n", action_count, clusterName)
-			}
-			
-			if ((apiCount % 110) == 0) {
-				fmt.Printf(" ... made %d API calls. Sleeping for 1 minute to avoid overloading PowerBI API limits ...", apiCount)
-				time.Sleep(1 * time.Minute)
+			if (withImpact) {
+				row["Impacted_Applications"] = action.impactedApps
 			}
+			rows = append(rows, row)
+	  	}
+
+	  	if (len(rows) > 0) {
+	  		// Errors are reported by the sink and the other clusters are still sent
+			sink.writeRows("cluster "+clusterName, rows)
 		}
 	}
 }
@@ -207,16 +331,19 @@ func pushPowerBiData(clusterNameMap map[string]string, clusterActionsMap map[str
 // Returns:
 // - map: Cluster UUID -> Cluster Name
 // - map: Cluster UUID -> actions
-func getHostActions (turbo_instance string, turbo_user string, turbo_password string, cluster_group_name string) (map[string][]Action, map[string]string) {
+func getHostActions (turbo_instance string, auth string, cluster_groups []string, group_match string) (map[string][]Action, map[string]string) {
 
-	// get auth token
-	auth := turboLogin(turbo_instance, turbo_user, turbo_password) 
+	fmt.Printf("... getting cluster list for group(s), %s ...\n", strings.Join(cluster_groups, ", "))
+	// Find the groups and the clusters in them
+	clusterNameMap := getClusters(turbo_instance, cluster_groups, group_match, auth)
 	
-	fmt.Printf("... getting cluster list for group, %s ...\n", cluster_group_name)
-	// Find the UUID for the group
-	group_uuid := getGroupId(turbo_instance, cluster_group_name, auth)
-	// Use the Group UUID to get the cluster members of the group
-	clusterNameMap := getGroupMembers(turbo_instance, auth, group_uuid)
+	// Host UUID -> Cluster Name so we can tell which cluster a MOVE is going to
+	hostClusterMap := make(map[string]string)
+	for clusterUuid,clusterName := range clusterNameMap {
+		for hostUuid := range getGroupMembers(turbo_instance, auth, clusterUuid) {
+			hostClusterMap[hostUuid] = clusterName
+		}
+	}
 	
 	// Get the host actions for each cluster and build a map of cluster UUID to actions
 	var clusterActionsMap map[string][]Action
@@ -285,6 +412,8 @@ func getHostActions (turbo_instance string, turbo_user string, turbo_password st
 				action.actionDetails = responseAction["details"].(string)
 				action.entityType = responseAction["target"].(map[string]interface{})["className"].(string)
 				action.entityName = responseAction["target"].(map[string]interface{})["displayName"].(string)
+				action.entityUuid = jsonString(responseAction["target"].(map[string]interface{}), "uuid")
+				setActionFromTo(&action, responseAction, hostClusterMap)
 	
 				allActions = append(clusterActionsMap[clusterUuid], action)
 				clusterActionsMap[clusterUuid] = allActions
@@ -305,112 +434,128 @@ func getHostActions (turbo_instance string, turbo_user string, turbo_password st
 	return clusterActionsMap, clusterNameMap
 }
 
-// Get Group Members
-func getGroupMembers(turbo_instance string, auth string, group_uuid string) map[string]string {
+// Fills in where the action takes things from and to:
+// - MOVE: the current and new host and/or datastore. A move of both host and storage comes as compound actions so they are listed together.
+// - PROVISION: the host that will be cloned, and the new host if Turbo gives it.
+// - SUSPEND: the host being suspended.
+func setActionFromTo(action *Action, responseAction map[string]interface{}, hostClusterMap map[string]string) {
+	target, _ := responseAction["target"].(map[string]interface{})
 	
-	var clusterNameMap map[string]string
-	clusterNameMap = make(map[string]string)
-
+	switch (action.actionType) {
+	case "MOVE":
+		moves := []map[string]interface{}{responseAction}
+		if compoundActions, ok := responseAction["compoundActions"].([]interface{}); ok && (len(compoundActions) > 0) {
+			moves = nil
+			for _,compoundAction := range compoundActions {
+				if move, ok := compoundAction.(map[string]interface{}); ok {
+					moves = append(moves, move)
+				}
+			}
+		}
+		var from, fromTypes, to, toTypes []string
+		for _,move := range moves {
+			currentEntity, _ := move["currentEntity"].(map[string]interface{})
+			newEntity, _ := move["newEntity"].(map[string]interface{})
+			from = appendEntityName(from, currentEntity)
+			fromTypes = appendEntityType(fromTypes, currentEntity)
+			to = appendEntityName(to, newEntity)
+			toTypes = appendEntityType(toTypes, newEntity)
+			if newEntityUuid, ok := newEntity["uuid"].(string); ok && (hostClusterMap[newEntityUuid] != "") {
+				action.actionToCluster = hostClusterMap[newEntityUuid]
+			}
+		}
+		action.actionFrom = strings.Join(from, ", ")
+		action.actionFromType = strings.Join(fromTypes, ", ")
+		action.actionTo = strings.Join(to, ", ")
+		action.actionToType = strings.Join(toTypes, ", ")
+	case "PROVISION":
+		// Turbo provisions a copy of an existing host. Older versions only give it as the target.
+		template, _ := responseAction["currentEntity"].(map[string]interface{})
+		if (template["displayName"] == nil) {
+			template = target
+		}
+		newEntity, _ := responseAction["newEntity"].(map[string]interface{})
+		action.actionFrom = jsonString(template, "displayName")
+		action.actionFromType = jsonString(template, "className")
+		action.actionTo = jsonString(newEntity, "displayName")
+		action.actionToType = jsonString(newEntity, "className")
+	case "SUSPEND":
+		action.actionFrom = jsonString(target, "displayName")
+		action.actionFromType = jsonString(target, "className")
+	}
+}
 
-	url := "https://"+ turbo_instance +"/vmturbo/rest/groups/"+group_uuid+"/members"
-	method := "GET"
-	
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	client := &http.Client{Transport: customTransport}	
+func appendEntityName(names []string, entity map[string]interface{}) []string {
+	if name := jsonString(entity, "displayName"); (name != "") {
+		return append(names, name)
+	}
+	return names
+}
 
-	// create and make the request
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		fmt.Println(err)
+// Adds the entity's type to the list unless it's already there
+func appendEntityType(types []string, entity map[string]interface{}) []string {
+	className := jsonString(entity, "className")
+	if (className == "") {
+		return types
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Cookie", auth)
-	res, err := client.Do(req)
-	if err != nil {
-    	fmt.Println(err)
-    	os.Exit(3)
-  	}
+	for _,existing := range types {
+		if (existing == className) {
+			return types
+		}
+	}
+	return append(types, className)
+}
 
-	defer res.Body.Close()
-	// essentially creates a stringified version of the body's json
-	body, _ := ioutil.ReadAll(res.Body)
-	
-	// Since the results is an array of json,
-	// Create an array of one of these interface things to unmarshal the stringified json into
-	var jsonBody []map[string]interface{}
-	err = json.Unmarshal([]byte(body), &jsonBody)
-	
- 	if err != nil {
- 		fmt.Println(err)
-   		fmt.Printf("#### ERROR decoding response: %v\n", err)
-    	if e, ok := err.(*json.SyntaxError); ok {
-       		fmt.Printf("#### ERROR syntax error at byte offset %d\n", e.Offset)
-    	}
-    	fmt.Printf("#### ERROR response: %q\n", body)
- 	}
- 	
- 	for _, groupMember := range jsonBody {
- 		clusterUuid := groupMember["uuid"].(string)
- 		clusterNameMap[clusterUuid] = groupMember["displayName"].(string)
- 	}
- 	
- 	return clusterNameMap
- }
-
-// get Group UUID
-func getGroupId(turbo_instance string, cluster_group_name string, auth string) string {
-
-	url := "https://"+ turbo_instance +"/vmturbo/rest/search?q="
-	method := "POST"
-	
-	// VM search payload
-	payload := strings.NewReader("{\n  \"className\": \"Group\",\n  \"criteriaList\": [\n    {\n      \"expVal\": \"^"+cluster_group_name+"$\",\n      \"caseSensitive\": \"false\",\n      \"filterType\": \"groupsByName\",\n      \"expType\": \"RXEQ\"\n    }\n  ],\n  \"logicalOperator\": \"AND\"\n}")
+// Gets the hosts in a cluster. Returns:
+// - map: Host UUID -> Host Name
+func getGroupMembers(turbo_instance string, auth string, group_uuid string) map[string]string {
 	
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	client := &http.Client{Transport: customTransport}	
+	hostNameMap := make(map[string]string)
 
-	// create and make the request
-	req, err := http.NewRequest(method, url, payload)
-	if err != nil {
-		fmt.Println(err)
+	members, unexpected, err := getTypedGroupMembers(turbo_instance, auth, group_uuid, "PhysicalMachine")
+	if (err != nil) {
+		fmt.Println("### ERROR ### getting members of group " + group_uuid + ": " + err.Error())
+		os.Exit(3)
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Cookie", auth)
-	res, err := client.Do(req)
-	if err != nil {
-    	fmt.Println(err)
-    	os.Exit(3)
-  	}
-
-	defer res.Body.Close()
-	// essentially creates a stringified version of the body's json
-	body, _ := ioutil.ReadAll(res.Body)
-	//fmt.Println(string(body))
-	
-	// Since the search results is an array of json,
-	// Create an array of one of these interface things to unmarshal the stringified json into
-	var searchResults []map[string]interface{}
-	err = json.Unmarshal([]byte(body), &searchResults)
-	if err != nil {
-		fmt.Println(err)
-    	os.Exit(4)
+	for _, member := range unexpected {
+		fmt.Printf("### WARNING ### skipping %s in cluster %s, expected only hosts\n", member, group_uuid)
 	}
-	// now searchResults is an array of structures that we can index.
-	// There's only one result so we're hardcoding the array index and we only care about the uuid
-	//fmt.Println("searchResults")
-	//fmt.Println(searchResults)
-	
-	if (len(searchResults) > 0) {
-		return searchResults[0]["uuid"].(string)
-	} else {
-		return "NOTFOUND"
+	for _, member := range members {
+		hostNameMap[member.uuid] = member.name
 	}
-}	
-	
+	return hostNameMap
+}
 
+// Finds the groups given by name or UUID and the clusters in them. Exits if a group can't be found.
+// Returns:
+// - map: Cluster UUID -> Cluster Name
+func getClusters(turbo_instance string, cluster_groups []string, group_match string, auth string) map[string]string {
+	groups, err := resolveGroups(turbo_instance, auth, cluster_groups, group_match)
+	if (err != nil) {
+		fmt.Println("*** Error finding cluster group: " + err.Error())
+		os.Exit(4)
+	}
+	for _, group := range groups {
+		fmt.Printf("... using group %s\n", group)
+	}
 
+	expansion, err := expandClusterGroups(turbo_instance, auth, groups)
+	if (err != nil) {
+		fmt.Println("*** Error getting the clusters in the group(s): " + err.Error())
+		os.Exit(4)
+	}
+	for _, warning := range expansion.warnings {
+		fmt.Println("### WARNING ### " + warning)
+	}
+	clusterNameMap := expansion.clusterNameMap
+	for clusterUuid, paths := range expansion.clusterPaths {
+		if (len(paths) > 1) {
+			fmt.Printf("... cluster %s is in more than one group, reporting it once: %s\n", clusterNameMap[clusterUuid], strings.Join(paths, "; "))
+		}
+	}
+	fmt.Printf("... found %d cluster(s)\n", len(clusterNameMap))
+	return clusterNameMap
+}
 
 // Login to turbo
 func turboLogin(turbo_instance string, turbo_user string, turbo_password string) string {
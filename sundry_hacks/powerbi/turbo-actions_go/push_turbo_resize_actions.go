@@ -17,12 +17,25 @@ Requires a Power BI streaming dataset defined with the following fields:
 - Reason (Text)
 - Severity (Text)
 - Category (Text)
+- Savings_Per_Month (Number): Cost savings of the action in $ per month (0 if none)
+- Investment_Per_Month (Number): Cost increase of the action in $ per month (0 if none)
+- Action_From_Value (Number): Action_From as a number in Action_Unit, blank if it isn't a number (e.g. cloud instance types)
+- Action_To_Value (Number): Action_To as a number in Action_Unit
+- Action_Unit (Text): e.g. GB, vCPU, IOPS
+If the mapping CSV uses Server_Name patterns (see -csv_file), the dataset also needs:
+- Server_Pattern (Text)
 
 .EXAMPLE
 push_turbo-vm_resize_actions -turbo_instance turbonomic.mycompany.com -turbo_user USERNAME -turbo_password PASSWORD -powerbi_stream_url POWERBI_DATASET_URL -csv_file APPSERVER.csv
 For the servers associated with each applicatin found in the provided CSV, this script will push a separate row of data to the given Power BI stream 
 where each row provides the application, the server and action data.
 
+push_turbo-vm_resize_actions -turbo_instance turbonomic.mycompany.com -turbo_user USERNAME -turbo_password PASSWORD -powerbi_stream_url POWERBI_DATASET_URL -mapping_source bizapps -bizapp_group "Prod Apps"
+Same as above but the applications and their servers come from the Business Applications in the "Prod Apps" group in Turbo.
+
+push_turbo-vm_resize_actions -turbo_instance turbonomic.mycompany.com -turbo_user USERNAME -turbo_password PASSWORD -powerbi_stream_url POWERBI_DATASET_URL -mapping_source tags -tag_keys Application,CostCenter
+Same as above but the actions are grouped into applications by each server's Application tag, or its CostCenter tag if it has no Application tag.
+
 .PARAMETER turbo_instance
 Specify the Turbonomic server hostname, FQDN, or IP address where you are adding the targets.
 
@@ -37,18 +50,247 @@ Currently, this is the URL with the key that one gets when creating a Streaming
 (Eventually, this may be replaced with a PowerBI API credentials as configured via registering an app from dev.powerbi.com or a service prinicipal creds.)
 
 .PARAMETER csv_file
-Specify the path to a CSV that contains at least two columns: 
+Specify the path to a CSV that contains at least these columns (the header line must be the first line of the file): 
 - Component_Id: This is the Application identifier
 - Component_Name: This is the Appliation name
 - Server_Name: This is the server associated with the given component_id.
+Server_Name may also be a naming pattern instead of a server name:
+- a glob using * and ?, e.g. payweb-prd-*
+- a regular expression starting with re: or ^, e.g. re:^payweb-(prd|stg)-\d+$ or ^payweb01$|^payweb02$
+The pattern is matched against the names of the servers with actions. The pattern each server matched is shown in the output
+and sent in the Server_Pattern field (see above).
+Optionally, it may also have:
+- Server_UUID: The Turbo UUID of the server. When given, it is used instead of Server_Name to find the server's actions.
+  Use this to pick the right server when the same server name is found in more than one vCenter or cloud account.
+  If an application has both, give a line for each with its Server_UUID. The second is shown as "<Server_Name> (<Server_UUID>)".
 Note this parameter may become vestigial or replaced once there is an API to get this information.
+Not needed if -mapping_source is bizapps or tags.
+
+.PARAMETER mode
+- actions (default): the actions for each application's servers as described above.
+- ri: a Reserved Instance report instead. Gets the cloud SCALE and BUY_RI actions (the action filter parameters below still apply)
+  and works out if each one improves the instance's RI coverage or the RI's utilization. No application mapping is needed.
+  The details of each SCALE action are fetched for its RI coverage, which takes an API call per action.
+  -powerbi_stream_url is a CSV file path or the URL for a PowerBI Streaming Dataset with these fields:
+  - Timestamp (DateTime)
+  - Server_Name (Text)
+  - Server_UUID (Text)
+  - Account_Name (Text)
+  - Instance_Family (Text): e.g. m5 for m5.large
+  - Action_Type (Text)
+  - Action_From (Text)
+  - Action_To (Text)
+  - RI_Coverage_Before (Number): percent, blank if Turbo doesn't give it
+  - RI_Coverage_After (Number): percent, blank if Turbo doesn't give it
+  - RI_Utilization_Before (Number): percent of the RI's coupons used, blank if Turbo doesn't give it
+  - RI_Utilization_After (Number): percent of the RI's coupons used, blank if Turbo doesn't give it
+  - RI_Improving (Boolean): BUY_RI actions and actions where the coverage or utilization goes up
+  - Savings_Per_Month (Number)
+  - Investment_Per_Month (Number)
+  - Action_Details (Text)
+  - Reason (Text)
+- accounts: the cloud actions grouped by cloud account (or business unit, see -group_by) instead of by application,
+  like tbutil_scripts/get_actions_by_cloud_account.js. No application mapping is needed and all action types are included
+  unless -action_type is given. -powerbi_stream_url is a CSV file path or the URL for a PowerBI Streaming Dataset with these fields:
+  - Timestamp (DateTime)
+  - Account_ID (Text): Turbo's UUID for the account
+  - Account_Name (Text)
+  - Cloud_Type (Text): AWS, AZURE, etc.
+  - Server_Name (Text)
+  - Server_UUID (Text)
+  - Action_Details (Text)
+  - Action_Type (Text)
+  - Action_From (Text)
+  - Action_To (Text)
+  - Reason (Text)
+  - Severity (Text)
+  - Category (Text)
+  - Savings_Per_Month (Number)
+  - Investment_Per_Month (Number)
+- stats: a utilization report like js_console_hacks/Find_High_RdyQ_VMs.js instead. Gets the stats of the -stats_group members
+  (or of the mapping's servers) over the last few days and reports the entities whose utilization is over the thresholds.
+  The stats, how they are measured (max, avg or a percentile such as p95) and the thresholds are set in the "stats" section
+  of the -config file, e.g.
+    "stats": {"days": 7, "stats": [{"name": "ReadyQueue", "measure": "max", "threshold": 4},
+                                   {"name": "VCPU", "measure": "p95", "threshold": 90}]}
+  The default is CPU ready queue (max over 4, per vCPU), VCPU and VMem (p95 over 90%) over 7 days.
+  -powerbi_stream_url is a CSV file path or the URL for a PowerBI Streaming Dataset with these fields:
+  - Timestamp (DateTime)
+  - Entity_Name (Text)
+  - Entity_UUID (Text)
+  - Entity_Type (Text)
+  - Component_Name (Text): the applications the server is in, blank with -stats_group
+  - Stat_Name (Text)
+  - Measure (Text)
+  - Value (Number): utilization percent (per vCPU for ReadyQueue)
+  - Threshold (Number)
+  - Days (Number)
+- history: what was actually done instead of what is pending. Gets the actions that SUCCEEDED or FAILED in the last -history_days
+  (all action types unless -action_type is given) and groups them by application with the same mapping as actions mode.
+  Realized savings and investment are those of the actions that succeeded (a failed action realized nothing).
+  -powerbi_stream_url is a CSV file path or the URL for a PowerBI Streaming Dataset with these fields:
+  - Timestamp (DateTime)
+  - Component_ID (Text)
+  - Component_Name (Text)
+  - Server_Name (Text)
+  - Action_UUID (Text)
+  - Action_Type (Text)
+  - Action_Details (Text)
+  - Action_From (Text)
+  - Action_To (Text)
+  - Outcome (Text): SUCCEEDED or FAILED
+  - Created_Time (DateTime): when Turbo recommended the action
+  - Executed_Time (DateTime): when the action last changed state, i.e. when it finished
+  - Savings_Per_Month (Number): what the action was expected to save
+  - Realized_Savings_Per_Month (Number): Savings_Per_Month if the action succeeded, otherwise 0
+  - Realized_Investment_Per_Month (Number): Investment_Per_Month if the action succeeded, otherwise 0
+
+.PARAMETER stats_group
+Only used with -mode stats. UUID or exact name of the group whose members' stats are checked. Groups in the group (e.g. the
+clusters in a group of clusters) are expanded into their members. By default the servers in the application mapping
+(see -mapping_source, csv or bizapps) are checked.
+
+.PARAMETER history_days
+Only used with -mode history. How many days back to get executed actions for. Default is 30.
+The window can also be given as "startTime" and "endTime" (RFC3339) in the "actions" section of the -config file.
+
+.PARAMETER group_by
+Only used with -mode accounts. account (default) for the discovered cloud accounts or business_unit for all business units,
+including billing families. Member accounts that were found through a master account's target are included too. If Turbo
+only gives their account ID they are named "<master account's target name> / <account ID>".
+
+.PARAMETER per_account
+Only used with -mode accounts and a CSV file. Writes a file per account. {account} in the file name is replaced with the account
+name, otherwise the account name is added before the extension, e.g. actions.csv -> actions_AWS-Prod.csv.
+If two accounts would get the same file, the account UUID is added to both names, e.g. actions_AWS-Prod_111111111111.csv.
+
+.PARAMETER mapping_source
+Where to get the application to server mapping from:
+- csv (default): the -csv_file.
+- bizapps: the Business Applications defined in Turbo. Each Business Application is an application (its UUID is the Component_ID)
+  and the VMs, database servers and databases in its supply chain are its servers. A second server with the same name in a
+  Business Application is listed as "<name> (<uuid>)".
+- tags: the tags Turbo discovered on the servers with actions. See -tag_keys.
+
+.PARAMETER bizapp_group
+Only used with -mapping_source bizapps. Name of a group of Business Applications to limit the mapping to. By default all Business Applications are used.
+
+.PARAMETER tag_keys
+Only used with -mapping_source tags. Comma separated list of tag keys to group servers into applications by, in order of preference.
+E.g. "Application,CostCenter" uses the Application tag if the server has one, otherwise the CostCenter tag. Tag keys are not case sensitive.
+The application's Component_ID is "<tag key>:<tag value>" and its Component_Name is the tag value.
+Servers whose tags can't be read are left out with a warning. A second server with the same name in an application is listed
+as "<name> (<uuid>)".
+
+.PARAMETER untagged_app
+Only used with -mapping_source tags. Component_ID and Component_Name for servers that have none of the -tag_keys. Default is UNTAGGED.
+
+.PARAMETER reconcile_output
+Optional. Where to write a reconciliation of the application to server mapping against Turbo. Either a CSV file path or the URL for a
+second PowerBI Streaming Dataset with these fields:
+- Timestamp (DateTime)
+- Status (Text): NOT_IN_TURBO (mapping server Turbo doesn't know), NO_ACTIONS (mapping server without actions),
+  NOT_IN_MAPPING (server with actions that isn't in any application) or DUPLICATE_NAME (server with actions whose name is
+  in the mapping but is used by more than one server in Turbo) or LOOKUP_ERROR (mapping server without actions that couldn't be
+  looked up in Turbo, e.g. because of a permissions or server error)
+- Component_ID (Text)
+- Component_Name (Text)
+- Server_Name (Text)
+- Server_UUID (Text)
+- Action_Count (Number)
+
+.PARAMETER config
+Optional JSON file with settings that are too fiddly for the command line. For example:
+{
+  "csv": {
+    "delimiter": "auto",
+    "header_aliases": {"Component_Id": ["App ID"], "Component_Name": ["Application"], "Server_Name": ["Hostname"]}
+  },
+  "units": {"decimals": 1, "decimals_by_unit": {"GB": 0}},
+  "server_names": {
+    "case_fold": true,
+    "domain_suffixes": ["corp.example.com"],
+    "strip_domain": false,
+    "rewrites": [{"match": "^(.*)-vm$", "replace": "$1"}]
+  }
+}
+- csv.delimiter: "auto" (the default, works it out from the header line), ",", ";" or "tab".
+- csv.header_aliases: other names the CSV may use for the documented column names. Header names are not case sensitive.
+- server_names: rules applied to the server names in both the mapping and Turbo's actions before they are matched up,
+  so that, for example, a short hostname in the CSV matches an FQDN or upper case name in Turbo.
+  The rewrites (regular expression replacements) are done first, then domain_suffixes (the first matching suffix is removed),
+  then strip_domain (everything from the first "." is removed, IP addresses are left alone), then case_fold (lower case).
+  The normalized names are the ones sent in Server_Name. Names that normalizing makes the same are reported.
+  Server_Name patterns are not normalized but are matched against the normalized Turbo names.
+- units: how resize values are shown. Values are converted from Turbo's units to GB (from KB, MB), GHz (from MHz), MB/s, etc.
+  "decimals" is the number of decimals to round to (default 2) and "decimals_by_unit" sets it for a given unit
+  (vCPU and IOPS default to 0). "commodity_units" gives the Turbo unit of commodities that aren't known,
+  e.g. {"MyCommodity": "MB"}. Units are only looked up this way if the action doesn't give them.
+
+.PARAMETER allow_duplicate_names
+By default, actions for a server name that Turbo has on more than one server (i.e. with different UUIDs) are not sent
+unless the CSV gives the Server_UUID for it, since there is no way to know which server the CSV means.
+Set this flag to send the actions for all the servers with that name, as was done prior to version 2.12.
+Either way, the duplicate names are reported.
 
 .PARAMETER action_type
-Flag which action_type(s) to include in the output. 
-Options: TBD
+Optional. Comma separated list of the action types to get from Turbo. Default is RESIZE,RIGHT_SIZE,SCALE.
+Options: ACTIVATE, ALLOCATE, BUY_RI, DEACTIVATE, DELETE, MOVE, PROVISION, RECONFIGURE, RESIZE, RIGHT_SIZE, SCALE, START, SUSPEND
+Only the resize type actions have Action_From and Action_To values, the others are sent with NA.
+
+.PARAMETER environment_type
+Optional. CLOUD, ONPREM or HYBRID (the default, i.e. both).
+
+.PARAMETER severity
+Optional. Comma separated list of the action severities to get: CRITICAL, MAJOR, MINOR, NORMAL. Default is all.
+
+.PARAMETER risk_category
+Optional. Comma separated list of the action categories to get: "Performance Assurance", "Efficiency Improvement", "Prevention", "Compliance".
+Default is all.
+
+.PARAMETER related_entity_type
+Optional. Comma separated list of entity types (e.g. VirtualMachine,Database) to limit the actions to. Default is all.
+
+.PARAMETER cost_type
+Optional. SAVINGS or INVESTMENT to only get the actions that save or cost money. Default is all.
+
+.PARAMETER action_state
+Optional. Comma separated list of action states to get, e.g. READY,ACCEPTED. Default is whatever Turbo returns for current actions,
+or SUCCEEDED,FAILED with -mode history.
+
+The above can also be given in the "actions" section of the -config file using the Turbo API's names, e.g.
+  "actions": {"actionTypeList": ["SCALE"], "environmentType": "CLOUD", "riskSeverityList": ["CRITICAL", "MAJOR"],
+              "riskSubCategoryList": ["Performance Assurance"], "relatedEntityTypes": ["VirtualMachine"],
+              "costType": "SAVINGS", "actionStateList": ["READY"]}
+Command line values take precedence over the config file.
+
+.EXAMPLE
+push_turbo-vm_resize_actions execute -turbo_instance turbonomic.mycompany.com -turbo_user USERNAME -turbo_password PASSWORD -approval_file APPROVED.csv
+Accepts the actions allowed by APPROVED.csv instead of reporting actions. Only actions on the approval CSV are touched:
+- a line with Action_UUID allows that action. It must also have the Action_From and Action_To the action had when it was approved.
+- a line with Server_Name allows the READY actions on that server with the line's Action_From and Action_To.
+- a line with Component_Id or Component_Name allows the READY actions on the application's servers in the -csv_file mapping
+  with the line's Action_From and Action_To.
+Server names are matched as for reporting: with the server_names rules (names are always matched ignoring case), Server_Name
+patterns and the mapping's Server_UUIDs. A server name that more than one server has isn't approved by a server or
+application line unless the mapping gives its Server_UUID. Approve those actions by Action_UUID instead.
+Action_From and Action_To are required on every line. With -allow_blanket_approval, server and application lines may leave them
+out to allow whatever READY actions are on those servers at run time.
+Approved_By is optional and is copied to the audit log.
+Each action is fetched again just before it is accepted and is skipped unless it is still READY with the approved from/to.
+The accepted actions are polled until they succeed or fail (or -timeout), and every action considered is written to the -audit_file
+with its result: SUCCEEDED, FAILED, TIMED_OUT, SKIPPED_NOT_READY, SKIPPED_CHANGED, SKIPPED_NOT_FOUND, ACCEPT_FAILED or DRY_RUN.
+Rows are written as they happen and each accepted action also gets an ACCEPTED row when it is accepted, so the log shows what
+Turbo was told to do even if the run is stopped. If the audit log can't be written, no more actions are accepted.
+The execute subcommand takes -turbo_instance, -turbo_user, -turbo_password, -approval_file, -csv_file, -config (its "csv", "actions" and "server_names" sections),
+-audit_file (default execute_audit_<time>.csv), -dry_run, -allow_blanket_approval, -poll_interval (default 30s) and -timeout (default 30m).
 
 CROSS-COMPLIATION NOTES
-env GOOS=windows GOARCH=amd64 go build ./push_turbo_resize_actions.go
+env GOOS=windows GOARCH=amd64 go build ./push_turbo_resize_actions.go ./resize_*.go ./common_*.go
+
+TESTING NOTES
+go test ./push_turbo_resize_actions.go ./push_turbo_resize_actions_test.go ./resize_*.go ./common_*.go ./fake_powerbi.go ./fake_powerbi_test.go
+fake_powerbi_server.go can be used as a stand-in for the -powerbi_stream_url to rehearse a run without PowerBI.
 
 */
 
@@ -65,14 +307,15 @@ import (
      "crypto/tls"
      "flag"
      "os"
-     "encoding/csv"
-     "io"
      "time"
+     "sort"
     //"reflect"
 )
 
 type Action struct {
 	actionUuid string
+	serverUuid string
+	discoveredBy string
 	actionDetails string
 	actionType string
 	actionFrom string
@@ -80,6 +323,25 @@ type Action struct {
 	reason string
 	severity string
 	category string
+	// Action_From and Action_To as numbers in valueUnit (e.g. GB). valueUnit is "" if the values couldn't be converted.
+	fromValue float64
+	toValue float64
+	valueUnit string
+	// $ per month. Turbo gives these per hour in the action's stats.
+	savingsPerMonth float64
+	investmentPerMonth float64
+}
+
+// Hours in an average month (24 * 365 / 12), which is what Turbo uses to show monthly costs
+const hoursPerMonth = 730.0
+
+// Settings from the -config file
+type resizeConfig struct {
+	CSV csvMappingConfig `json:"csv"`
+	ServerNames serverNameRules `json:"server_names"`
+	Actions actionQuery `json:"actions"`
+	Units unitConfig `json:"units"`
+	Stats statsConfig `json:"stats"`
 }
 
 type ServerAction struct {
@@ -106,25 +368,77 @@ func main() {
 	// 2.7 MINOR VERSION NOTE: Added check for nil target name in action.
 	// 2.8 MINOR VERSION NOTE: Added more error checking
 	// 2.9 MINOR VERSION NOTE: Slight modification to how PowerBI API throttling is handled.
-	version := "2.9.1"
+	// 2.10 MINOR VERSION NOTE: No longer crashes if the PowerBI POST fails outright. Throttling settings pulled out so they can be tested against fake_powerbi_server.
+	// 2.11 MINOR VERSION NOTE: Action parsing pulled out into parseAction for golden-file testing. Actions missing target, risk, template or resize values are counted as bad instead of crashing.
+	// 2.12 MINOR VERSION NOTE: Reports server names found on more than one server (UUID) and uses the optional Server_UUID CSV column to match actions.
+	// 2.13 MINOR VERSION NOTE: CSV is read once, BOMs are ignored, headers are matched case-insensitively or by aliases from the new -config file,
+	//                         semicolon and tab delimiters are supported and unusable lines are reported with their line numbers.
+	// 2.14 MINOR VERSION NOTE: Added -mapping_source bizapps to get the application to server mapping from Turbo's Business Applications instead of a CSV.
+	// 2.15 MINOR VERSION NOTE: Added -mapping_source tags to group the actions into applications by the servers' tags.
+	// 2.16 MINOR VERSION NOTE: Added -reconcile_output for a report of mapping servers without actions or unknown to Turbo and servers with actions that aren't mapped.
+	// 2.17 MINOR VERSION NOTE: Server_Name in the CSV may be a glob or regex pattern.
+	// 2.18 MINOR VERSION NOTE: Added server_names normalization rules to the -config file.
+	// 2.19 MINOR VERSION NOTE: Implemented -action_type and added flags and config for the other action filters Turbo supports.
+	// 2.20 MINOR VERSION NOTE: Added Savings_Per_Month and Investment_Per_Month to each action and per-application totals to the output.
+	// 2.21 MINOR VERSION NOTE: Added -mode ri for a report of the cloud actions that improve RI coverage.
+	// 2.22 MINOR VERSION NOTE: Added -mode accounts to group the cloud actions by cloud account or business unit.
+	// 2.23 MINOR VERSION NOTE: Resize values of all known commodities are converted to human units and sent as numbers with a unit.
+	// 2.24 MINOR VERSION NOTE: Added -mode stats for a report of the servers whose CPU ready queue, VCPU, VMem (or other stats) are over thresholds.
+	// 2.25 MINOR VERSION NOTE: Added the execute subcommand to accept the actions allowed by an approval CSV and write an audit log.
+	// 2.26 MINOR VERSION NOTE: Added -mode history for the actions that succeeded or failed, grouped by application, with realized savings.
+	// 2.27 MINOR VERSION NOTE: Action_From/Action_To for VCPU and VMem resizes are no longer truncated to whole numbers (e.g. 20.5 GB was sent as 20).
+	// 2.28 MINOR VERSION NOTE: -mode accounts includes member accounts without a target of their own and -per_account files no longer overwrite each other.
+	// 2.29 MINOR VERSION NOTE: -mode ri also reports RI utilization and counts actions that improve it as RI-improving.
+	// 2.30 MINOR VERSION NOTE: -mapping_source tags skips servers whose tags can't be read and keeps same-named servers in an application.
+	// 2.31 MINOR VERSION NOTE: -mapping_source bizapps keeps same-named servers and only Turbo's 400 for a scope without servers of a type is ignored.
+	// 2.32 MINOR VERSION NOTE: -stats_group may be a UUID and groups in it are expanded into their members.
+	// 2.33 MINOR VERSION NOTE: Mapping CSV lines with the same Server_Name and different Server_UUIDs in one application are kept as two servers.
+	// 2.34 MINOR VERSION NOTE: -mode ri gets the RI coverage from each SCALE action's details since the actions list doesn't have it.
+	// 2.35 MINOR VERSION NOTE: execute matches server and application approvals to servers like -mode actions does and refuses
+	//                         them for server names more than one server has.
+	version := "2.35"
 	fmt.Println("push_turbo-vm_resize_actions version "+version)
+	
+	if ((len(os.Args) > 1) && (os.Args[1] == "execute")) {
+		executeCommand(os.Args[2:])
+		return
+	}
 
 	// Process command line arguments
 	turbo_user := flag.String("turbo_user", "", "Turbo Username")
 	turbo_password:= flag.String("turbo_password", "", "Turbo Password")
 	turbo_instance := flag.String("turbo_instance", "", "Turbo IP or FQDN")
-	csv_file := flag.String("csv_file", "", "CSV File containing App to Server mapping - \"Component_id\" and \"Server_Name\" columns required")
+	csv_file := flag.String("csv_file", "", "CSV File containing App to Server mapping - \"Component_Id\", \"Component_Name\" and \"Server_Name\" columns required")
 	powerbi_stream_url := flag.String("powerbi_stream_url", "", "URL for the PowerBI Stream Dataset")
+	mode := flag.String("mode", "actions", "actions (per application), ri (Reserved Instance report), accounts (per cloud account), stats (utilization over thresholds) or history (executed actions per application)")
+	stats_group := flag.String("stats_group", "", "With -mode stats: UUID or exact name of the group whose members to check, nested groups included (default is the mapping's servers)")
+	history_days := flag.Int("history_days", 30, "With -mode history: days back to get executed actions for")
+	group_by := flag.String("group_by", "account", "With -mode accounts: account or business_unit")
+	per_account := flag.Bool("per_account", false, "With -mode accounts: write a CSV file per account")
+	mapping_source := flag.String("mapping_source", "csv", "Where to get the App to Server mapping from: csv, bizapps or tags")
+	bizapp_group := flag.String("bizapp_group", "", "Group of Business Applications to use with -mapping_source bizapps (default is all)")
+	tag_keys := flag.String("tag_keys", "Application", "Comma separated tag keys, in order of preference, to use with -mapping_source tags")
+	untagged_app := flag.String("untagged_app", "UNTAGGED", "Application for servers without any of the -tag_keys with -mapping_source tags")
+	reconcile_output := flag.String("reconcile_output", "", "CSV file or PowerBI Stream Dataset URL for the mapping reconciliation report (optional)")
+	config_file := flag.String("config", "", "JSON config file (optional)")
+	action_type := flag.String("action_type", "", "Comma separated action types to get (default RESIZE,RIGHT_SIZE,SCALE)")
+	environment_type := flag.String("environment_type", "", "CLOUD, ONPREM or HYBRID (default HYBRID)")
+	severity := flag.String("severity", "", "Comma separated action severities to get (default all)")
+	risk_category := flag.String("risk_category", "", "Comma separated action categories to get, e.g. \"Performance Assurance\" (default all)")
+	related_entity_type := flag.String("related_entity_type", "", "Comma separated entity types to limit the actions to (default all)")
+	cost_type := flag.String("cost_type", "", "SAVINGS or INVESTMENT (default all)")
+	action_state := flag.String("action_state", "", "Comma separated action states to get (default all)")
+	allow_duplicate_names := flag.Bool("allow_duplicate_names", false, "Send actions for server names found on more than one server even if the CSV has no Server_UUID for them")
 
 	flag.Parse()
 	
-	if ((*turbo_user == "") || (*turbo_password == "") || (*turbo_instance == "") || (*csv_file == "") || (*powerbi_stream_url == "")) {
+	if ((*turbo_user == "") || (*turbo_password == "") || (*turbo_instance == "") || ((*csv_file == "") && (*mapping_source == "csv") && ((*mode == "actions") || (*mode == "history") || ((*mode == "stats") && (*stats_group == "")))) || (*powerbi_stream_url == "")) {
 		fmt.Println("*************")
 		fmt.Println("Missing command line argument ...")
 		fmt.Println("Run \""+os.Args[0]+" -h\" for more information.")
 		fmt.Println("*************")
 		
-		fmt.Println("\n")
+		fmt.Print("\n\n")
 		fmt.Println("The PowerBI Streaming Dataset you are using must have the following fields set up with the types given in parentheses:")
 		fmt.Println()
 		fmt.Println("- Timestamp (DateTime)")
@@ -138,16 +452,116 @@ func main() {
 		fmt.Println("- Reason (Text)")
 		fmt.Println("- Severity (Text)")
 		fmt.Println("- Category (Text)")
+		fmt.Println("- Savings_Per_Month (Number)")
+		fmt.Println("- Investment_Per_Month (Number)")
+		fmt.Println("- Action_From_Value (Number)")
+		fmt.Println("- Action_To_Value (Number)")
+		fmt.Println("- Action_Unit (Text)")
+		fmt.Println("If the CSV uses Server_Name patterns, also:")
+		fmt.Println("- Server_Pattern (Text)")
 
 		os.Exit(1)
 	}
+	if ((*mode != "actions") && (*mode != "ri") && (*mode != "accounts") && (*mode != "stats") && (*mode != "history")) {
+		fmt.Println("*** Unknown -mode: " + *mode + " (use actions, ri, accounts, stats or history)")
+		os.Exit(1)
+	}
+	if (*history_days < 1) {
+		fmt.Println("*** -history_days must be at least 1")
+		os.Exit(1)
+	}
+	if ((*group_by != "account") && (*group_by != "business_unit")) {
+		fmt.Println("*** Unknown -group_by: " + *group_by + " (use account or business_unit)")
+		os.Exit(1)
+	}
+	if ((*mapping_source != "csv") && (*mapping_source != "bizapps") && (*mapping_source != "tags")) {
+		fmt.Println("*** Unknown -mapping_source: " + *mapping_source + " (use csv, bizapps or tags)")
+		os.Exit(1)
+	}
+	if ((*mode == "stats") && (*stats_group == "") && (*mapping_source == "tags")) {
+		fmt.Println("*** -mode stats needs -stats_group or -mapping_source csv or bizapps")
+		os.Exit(1)
+	}
 	// end command line arguments
 	
+	config := loadConfig(*config_file)
+	if err := applyUnitConfig(config.Units); (err != nil) {
+		fmt.Println("*** Error in units config: " + err.Error())
+		os.Exit(5)
+	}
+	
+	// Defaults, then the config file, then the command line
+	query := newActionQuery("RESIZE","RIGHT_SIZE","SCALE")
+	if (*mode == "ri") {
+		query = newActionQuery("SCALE","BUY_RI")
+		query.EnvironmentType = "CLOUD"
+	} else if (*mode == "accounts") {
+		query = newActionQuery()
+		query.EnvironmentType = "CLOUD"
+	} else if (*mode == "history") {
+		query = newActionQuery()
+		query.ActionStates = historyActionStates
+		query.StartTime, query.EndTime = historyWindow(time.Now(), *history_days)
+	}
+	query = query.withOverrides(config.Actions).withOverrides(actionQuery{
+		ActionTypes: splitFlagList(*action_type),
+		EnvironmentType: *environment_type,
+		RiskSeverities: splitFlagList(*severity),
+		RiskSubCategories: splitFlagList(*risk_category),
+		RelatedEntityTypes: splitFlagList(*related_entity_type),
+		CostType: *cost_type,
+		ActionStates: splitFlagList(*action_state),
+	})
+	action_payload, err := query.payload()
+	if (err != nil) {
+		fmt.Println("*** Bad action filter: " + err.Error())
+		os.Exit(1)
+	}
+	
 	time_start := time.Now()
 	
-	// Process the CSV file to extract the Application to Server Mapping
-	fmt.Println("*** Processing CSV file for application to server mapping ...")
-	appId2Name,appId2Servers := getAppServerMapping(*csv_file)
+	auth := turboLogin(*turbo_instance, *turbo_user, *turbo_password) 
+	
+	if (*mode == "ri") {
+		fmt.Println("*** Getting RI related actions from Turbo ...")
+		riReport(*turbo_instance, auth, action_payload, *powerbi_stream_url)
+		
+		time_elapsed := int(time.Now().Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+		fmt.Println("Done.")
+		return
+	}
+	if (*mode == "accounts") {
+		fmt.Println("*** Getting actions by cloud account from Turbo ...")
+		accountsReport(*turbo_instance, auth, action_payload, *group_by, *powerbi_stream_url, *per_account)
+		
+		time_elapsed := int(time.Now().Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+		fmt.Println("Done.")
+		return
+	}
+	
+	if (*mode == "stats") {
+		statsMode(*turbo_instance, auth, *stats_group, *mapping_source, *csv_file, *bizapp_group, config, *powerbi_stream_url)
+		
+		time_elapsed := int(time.Now().Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+		fmt.Println("Done.")
+		return
+	}
+	
+	// Get the Application to Server Mapping from the CSV file or from Turbo.
+	// Tag mapping is done once the actions are known since it's the actions' servers' tags that are needed.
+	var appId2Name map[string]string
+	var appId2Servers map[string][]string
+	var appServerUuids map[string]map[string]string
+	if (*mapping_source == "bizapps") {
+		fmt.Println("*** Getting Business Applications from Turbo for application to server mapping ...")
+		appId2Name,appId2Servers,appServerUuids = getBizAppServerMapping(*turbo_instance, auth, *bizapp_group)
+	} else if (*mapping_source == "csv") {
+		fmt.Println("*** Processing CSV file for application to server mapping ...")
+		appId2Name,appId2Servers,appServerUuids = getAppServerMapping(*csv_file, config.CSV)
+	}
 	
 	time_now := time.Now()
 	time_elapsed := int(time_now.Sub(time_start).Seconds())
@@ -155,8 +569,43 @@ func main() {
 	time_start = time_now
 	
 	// Call Turbo to get any actions for the servers assigned to each application
-	fmt.Println("*** Getting actions from Turbo ...")
-	allServerActions,serverUuids := getAllActions(*turbo_instance, *turbo_user, *turbo_password) 
+	var allServerActions map[string][]Action
+	var serverUuids map[string][]string
+	var actionOutcomes map[string]actionOutcome
+	if (*mode == "history") {
+		fmt.Println("*** Getting executed actions from Turbo (" + query.StartTime + " to " + query.EndTime + ") ...")
+		var badActions int
+		allServerActions,serverUuids,actionOutcomes,badActions,err = getActionHistory(*turbo_instance, auth, action_payload)
+		if (err != nil) {
+			fmt.Println("*** Error getting executed actions: " + err.Error())
+			os.Exit(3)
+		}
+		if (badActions > 0) {
+			fmt.Printf("\n#####\n#### Found a total of %d actions with missing data. #####\n#####\n",badActions)
+		}
+	} else {
+		fmt.Println("*** Getting actions from Turbo ...")
+		allServerActions,serverUuids = getAllActions(*turbo_instance, auth, action_payload)
+	}
+
+	if (*mapping_source == "tags") {
+		fmt.Println("*** Getting tags from Turbo for application to server mapping ...")
+		appId2Name,appId2Servers,appServerUuids = getTagServerMapping(*turbo_instance, auth, serverUuids, strings.Split(*tag_keys, ","), *untagged_app)
+	}
+
+	// Make the mapping's server names and Turbo's server names comparable.
+	normalizer := newNormalizer(config.ServerNames)
+	appId2Servers,appServerUuids,allServerActions,serverUuids = normalizeServerNames(normalizer, appId2Servers, appServerUuids, allServerActions, serverUuids)
+
+	// Swap any Server_Name patterns in the mapping for the names of the servers with actions that they match.
+	appId2Servers,appServerPatterns := resolveServerPatterns(appId2Servers, allServerActions)
+
+	// Server names can repeat across vCenters and cloud accounts so see if any of the actioned servers share a name.
+	duplicateNames := findDuplicateServerNames(serverUuids)
+	reportDuplicateServerNames(duplicateNames, allServerActions, appId2Servers, appServerUuids, *allow_duplicate_names)
+	if (*allow_duplicate_names) {
+		duplicateNames = nil
+	}
 
 	time_now = time.Now()
 	time_elapsed = int(time_now.Sub(time_start).Seconds())
@@ -165,66 +614,252 @@ func main() {
 
 	// Call PowerBI API to push data to the stream dataset
 	fmt.Println("*** Sending records to PowerBI ...")
-	pushPowerBiData(appId2Name,appId2Servers,allServerActions,serverUuids, *powerbi_stream_url)
+	if (*mode == "history") {
+		if err := pushHistoryData(appId2Name,appId2Servers,appServerUuids,allServerActions,actionOutcomes,duplicateNames, *powerbi_stream_url); (err != nil) {
+			fmt.Println("### ERROR ### " + err.Error())
+		}
+	} else {
+		pushPowerBiData(appId2Name,appId2Servers,appServerUuids,appServerPatterns,allServerActions,duplicateNames, *powerbi_stream_url)
+	}
 
 	time_now = time.Now()
 	time_elapsed = int(time_now.Sub(time_start).Seconds())
 	fmt.Printf("took %d seconds.\n\n", time_elapsed)
 	time_start = time_now
 	
+	if (*reconcile_output != "") {
+		fmt.Println("*** Reconciling application to server mapping with Turbo ...")
+		reconcileMapping(*turbo_instance, auth, normalizer, appId2Name, appId2Servers, appServerUuids, allServerActions, duplicateNames, *reconcile_output)
+
+		time_now = time.Now()
+		time_elapsed = int(time_now.Sub(time_start).Seconds())
+		fmt.Printf("took %d seconds.\n\n", time_elapsed)
+		time_start = time_now
+	}
+	
 	fmt.Println("Done.")
 }
 
+// Reads the JSON config file. No file means all the defaults.
+func loadConfig(config_file string) resizeConfig {
+	var config resizeConfig
+	if (config_file == "") {
+		return config
+	}
+	
+	data, err := ioutil.ReadFile(config_file)
+	if (err != nil) {
+		fmt.Println("*** Error opening file: "+ config_file)
+		os.Exit(5)
+	}
+	err = json.Unmarshal(data, &config)
+	if (err != nil) {
+		fmt.Println("*** Error parsing config file: "+ config_file)
+		fmt.Println(err)
+		os.Exit(5)
+	}
+	return config
+}
+
+// The execute subcommand: accepts the actions allowed by the approval CSV.
+func executeCommand(args []string) {
+	flags := flag.NewFlagSet("execute", flag.ExitOnError)
+	turbo_user := flags.String("turbo_user", "", "Turbo Username")
+	turbo_password := flags.String("turbo_password", "", "Turbo Password")
+	turbo_instance := flags.String("turbo_instance", "", "Turbo IP or FQDN")
+	approval_file := flags.String("approval_file", "", "CSV file of the approved Action_UUIDs, Server_Names or Components")
+	csv_file := flags.String("csv_file", "", "CSV File containing App to Server mapping, for approvals by Component (optional)")
+	config_file := flags.String("config", "", "JSON config file (optional)")
+	audit_file := flags.String("audit_file", "", "CSV file for the audit log (default execute_audit_<time>.csv)")
+	dry_run := flags.Bool("dry_run", false, "Check the approved actions but don't accept them")
+	allow_blanket_approval := flags.Bool("allow_blanket_approval", false, "Allow server and application approval lines without Action_From and Action_To")
+	poll_interval := flags.Duration("poll_interval", 30*time.Second, "How often to check on the accepted actions")
+	timeout := flags.Duration("timeout", 30*time.Minute, "How long to wait for the accepted actions to finish")
+	flags.Parse(args)
+	
+	if ((*turbo_user == "") || (*turbo_password == "") || (*turbo_instance == "") || (*approval_file == "")) {
+		fmt.Println("*************")
+		fmt.Println("Missing command line argument ...")
+		fmt.Println("Run \""+os.Args[0]+" execute -h\" for more information.")
+		fmt.Println("*************")
+		os.Exit(1)
+	}
+	if (*audit_file == "") {
+		*audit_file = "execute_audit_" + time.Now().Format("20060102_150405") + ".csv"
+	}
+	
+	config := loadConfig(*config_file)
+	approvals, badLines, err := readApprovalCsv(*approval_file, *allow_blanket_approval)
+	if (err != nil) {
+		fmt.Println("*** Error processing approval file: " + err.Error())
+		os.Exit(10)
+	}
+	for _,badLine := range badLines {
+		fmt.Println("### Skipped approval " + badLine)
+	}
+	mapping := newAppMapping()
+	if (*csv_file != "") {
+		mapping.appId2Name,mapping.appId2Servers,mapping.appServerUuids = getAppServerMapping(*csv_file, config.CSV)
+	}
+	
+	// The actions for server and application approvals: only READY ones are ever executed
+	query := newActionQuery("RESIZE","RIGHT_SIZE","SCALE").withOverrides(config.Actions)
+	query.ActionStates = []string{"READY"}
+	action_payload, err := query.payload()
+	if (err != nil) {
+		fmt.Println("*** Bad action filter: " + err.Error())
+		os.Exit(1)
+	}
+	
+	auth := turboLogin(*turbo_instance, *turbo_user, *turbo_password)
+	
+	fmt.Println("*** Finding the approved actions ...")
+	// Approvals have always matched server names ignoring case
+	serverNameRules := config.ServerNames
+	serverNameRules.CaseFold = true
+	selected, problems, err := selectApprovedActions(*turbo_instance, auth, approvals, mapping, newNormalizer(serverNameRules), action_payload)
+	if (err != nil) {
+		fmt.Println("*** Error getting actions from Turbo: " + err.Error())
+		os.Exit(3)
+	}
+	for _,problem := range problems {
+		fmt.Println("### Skipped approval " + problem)
+	}
+	fmt.Printf("... %d action(s) approved\n", len(selected))
+	
+	audit, err := newRowSink(*audit_file, executeAuditColumns)
+	if (err != nil) {
+		fmt.Println("*** Error creating audit log: " + err.Error())
+		os.Exit(10)
+	}
+	if (*dry_run) {
+		fmt.Println("*** Checking the approved actions (dry run) ...")
+	} else {
+		fmt.Println("*** Executing the approved actions ...")
+	}
+	counts, err := executeApprovedActions(*turbo_instance, auth, selected, executeOptions{dryRun: *dry_run, pollInterval: *poll_interval, timeout: *timeout}, audit)
+	if (err != nil) {
+		fmt.Println("### ERROR ### writing audit log, stopped without accepting any more actions: " + err.Error())
+	}
+	if err := audit.close(); (err != nil) {
+		fmt.Println("### ERROR ### writing audit log: " + err.Error())
+	}
+	
+	var results []string
+	for result := range counts {
+		results = append(results, result)
+	}
+	sort.Strings(results)
+	for _,result := range results {
+		fmt.Printf("... %d %s\n", counts[result], result)
+	}
+	fmt.Println("Done.")
+}
+
+// Finds the entities for -mode stats and reports the ones over the thresholds.
+func statsMode(turbo_instance string, auth string, stats_group string, mapping_source string, csv_file string, bizapp_group string, config resizeConfig, destination string) {
+	var entities []statsEntity
+	if (stats_group != "") {
+		fmt.Println("*** Getting the members of group " + stats_group + " ...")
+		var err error
+		entities, err = getStatsGroupEntities(turbo_instance, auth, stats_group)
+		if (err != nil) {
+			fmt.Println("*** Error getting group members: " + err.Error())
+			os.Exit(6)
+		}
+	} else {
+		var appId2Name map[string]string
+		var appId2Servers map[string][]string
+		var appServerUuids map[string]map[string]string
+		if (mapping_source == "bizapps") {
+			fmt.Println("*** Getting Business Applications from Turbo for application to server mapping ...")
+			appId2Name,appId2Servers,appServerUuids = getBizAppServerMapping(turbo_instance, auth, bizapp_group)
+		} else {
+			fmt.Println("*** Processing CSV file for application to server mapping ...")
+			appId2Name,appId2Servers,appServerUuids = getAppServerMapping(csv_file, config.CSV)
+		}
+		fmt.Println("*** Finding the mapping's servers in Turbo ...")
+		var skipped []string
+		var err error
+		entities, skipped, err = getMappingEntities(turbo_instance, auth, appId2Name, appId2Servers, appServerUuids)
+		if (err != nil) {
+			fmt.Println("*** Error finding servers in Turbo: " + err.Error())
+			os.Exit(3)
+		}
+		for _,serverName := range skipped {
+			fmt.Println("### Skipped server " + serverName)
+		}
+	}
+	
+	fmt.Printf("*** Getting stats for %d entities from Turbo ...\n", len(entities))
+	statsReport(turbo_instance, auth, entities, config.Stats, destination)
+}
+
 // Processes the CSV and creates a base mapping of applications (aka components) and servers
 // Returns:
 //   map: App ID -> App Name as given in the CSV
 //   map: App ID -> array of Server Names as given in the CSV
-func getAppServerMapping(csv_file string) (map[string]string, map[string][]string) {
+//   map: App ID -> Server Name -> Server UUID as given in the CSV. Only populated for rows that have a Server_UUID.
+func getAppServerMapping(csv_file string, config csvMappingConfig) (map[string]string, map[string][]string, map[string]map[string]string) {
 
-	// Get size of file and application and server name column numbers for subsequent processing
-	var componentIdColumn, componentNameColumn, serverNameColumn int
-	_, componentIdColumn, componentNameColumn, serverNameColumn = getFileInfo(csv_file)
+	mapping, err := readAppMappingCsv(csv_file, config)
+	if (err != nil) {
+		fmt.Println("*** Error processing CSV file: " + err.Error())
+		os.Exit(10)
+	}
 	
-	// For storing the app to server mappings (and later the server actions)
-	var appId2Name map[string]string
-	var appId2Servers map[string][]string
-	appId2Name = make(map[string]string)
-	appId2Servers = make(map[string][]string)
+	if (len(mapping.badLines) > 0) {
+		fmt.Printf("### Skipped %d line(s) in the CSV file:\n", len(mapping.badLines))
+		for _,badLine := range mapping.badLines {
+			fmt.Println("###    " + badLine)
+		}
+	}
+	
+	return mapping.appId2Name, mapping.appId2Servers, mapping.appServerUuids
+}
+// Gets the application to server mapping from the Business Applications in Turbo.
+// Returns the same maps as getAppServerMapping with the Business Application UUID as the App ID.
+func getBizAppServerMapping(turbo_instance string, auth string, bizapp_group string) (map[string]string, map[string][]string, map[string]map[string]string) {
 
-	// Read through the file this time to build the application to server mapping
-	fileLine := 1
-	appservercsv, err := os.Open(csv_file)
+	mapping, err := getBizAppMapping(turbo_instance, auth, bizapp_group)
 	if (err != nil) {
-		fmt.Println("*** Error opening file: "+ csv_file)
-		os.Exit(5)
+		fmt.Println("*** Error getting Business Applications: " + err.Error())
+		os.Exit(6)
+	}
+	if (len(mapping.appId2Name) == 0) {
+		fmt.Println("*** No Business Applications found.")
+		os.Exit(6)
 	}
+	
+	return mapping.appId2Name, mapping.appId2Servers, mapping.appServerUuids
+}
 
-	readfile := csv.NewReader(appservercsv)
-	for {
-		record, err := readfile.Read()
-		if (err == io.EOF) {
-			break
-		}	
+// Gets the application to server mapping from the tags on the servers with actions.
+// Returns the same maps as getAppServerMapping with "<tag key>:<tag value>" as the App ID.
+func getTagServerMapping(turbo_instance string, auth string, serverUuids map[string][]string, tagKeys []string, untaggedApp string) (map[string]string, map[string][]string, map[string]map[string]string) {
 
-		if (err != nil) {
-			fmt.Println("*** Failed to read a record in CSV file.") 
-		} else {
-			// Skip the first line which contains the column headings
-			if (fileLine > 1) {
-			
-				appId := record[componentIdColumn]
-				appName := record[componentNameColumn]
-				serverName := record[serverNameColumn]
-				
-				appId2Name[appId] = appName	
-				appId2Servers[appId] = append(appId2Servers[appId], serverName)
-			}	
-			fileLine += 1
-		}
-	}	
-	
-	return appId2Name, appId2Servers
+	// The actions' servers as server UUID -> server name
+	servers := make(map[string]string)
+	for serverName,uuids := range serverUuids {
+		for _,uuid := range uuids {
+			if (uuid != "UNKNOWN") {
+				servers[uuid] = serverName
+			}
+		}
+	}
+	for index := range tagKeys {
+		tagKeys[index] = strings.TrimSpace(tagKeys[index])
+	}
+
+	mapping, err := getTagMapping(turbo_instance, auth, servers, tagKeys, untaggedApp)
+	if (err != nil) {
+		fmt.Println("*** Error getting tags: " + err.Error())
+		os.Exit(6)
+	}
+	
+	return mapping.appId2Name, mapping.appId2Servers, mapping.appServerUuids
 }
+
 // 
 // // Calls Turbo API to get ALL current actions.
 // // Returns:
@@ -258,33 +893,69 @@ func getAppServerMapping(csv_file string) (map[string]string, map[string][]strin
 // }
 
 
+// Gets the savings and investment in $ per month from the action's costPrice stats.
+// Like Get-Cost-Improving-Perf_Actions_XL.js, a missing stat is taken to be 0.
+func parseActionCosts(responseAction map[string]interface{}) (savingsPerMonth float64, investmentPerMonth float64) {
+	stats, _ := responseAction["stats"].([]interface{})
+	for _,statItem := range stats {
+		stat, ok := statItem.(map[string]interface{})
+		if (!ok) || (stat["name"] != "costPrice") {
+			continue
+		}
+		value, ok := stat["value"].(float64)
+		if (!ok) {
+			continue
+		}
+		// Per hour unless Turbo says otherwise
+		units, _ := stat["units"].(string)
+		if (!strings.HasSuffix(units, "/mo")) && (!strings.HasSuffix(units, "/month")) {
+			value = value * hoursPerMonth
+		}
+		
+		savingsType := ""
+		filters, _ := stat["filters"].([]interface{})
+		for _,filterItem := range filters {
+			if filter, ok := filterItem.(map[string]interface{}); ok && (filter["type"] == "savingsType") {
+				savingsType, _ = filter["value"].(string)
+			}
+		}
+		switch (savingsType) {
+		case "savings":
+			savingsPerMonth += value
+		case "investment":
+			investmentPerMonth += value
+		}
+	}
+	return savingsPerMonth, investmentPerMonth
+}
+
+
 // Using the data found in the various maps, assemble API calls to push PowerBi to push the data stream
-func pushPowerBiData(appId2Name map[string]string, appId2Servers map[string][]string, allServerActions map[string][]Action, serverUuids map[string][]string, powerbi_url string) {
+// Servers are matched to actions by the Server_UUID from the CSV if there is one, otherwise by name.
+// Names in duplicateNames (i.e. found on more than one server) without a Server_UUID are skipped since the actions may not be for the CSV's server.
+// appServerPatterns gives the Server_Name pattern, if any, that each server came from.
+func pushPowerBiData(appId2Name map[string]string, appId2Servers map[string][]string, appServerUuids map[string]map[string]string, appServerPatterns map[string]map[string]string, allServerActions map[string][]Action, duplicateNames map[string][]string, powerbi_url string) {
 
 	t := time.Now()
 	timeString := t.Format(time.RFC3339)
   	method := "POST"
 	
+	uuidActions := getUuidActions(allServerActions)
+	
 	powerBiApiCount := 0
+	// App ID -> total $ per month of the app's actions
+	appSavings := make(map[string]float64)
+	appInvestment := make(map[string]float64)
+	appActionCounts := make(map[string]int)
 	for appId,appName := range appId2Name {
 		var payload string
 		app_action_count := 0
 		for _,serverName := range appId2Servers[appId] {
-			for _,action := range allServerActions[serverName] {
-				timestamp_part := "\"Timestamp\": \""+timeString+"\""
-				appid_part := "\"Component_ID\": \""+appId+"\""
-				appname_part := "\"Component_Name\": \""+appName+"\""
-				servername_part := "\"Server_Name\": \""+serverName+"\""
-				actiondetails_part := "\"Action_Details\": \""+action.actionDetails+"\""
-				actiontype_part := "\"Action_Type\": \""+action.actionType+"\""
-				actionfrom_part := "\"Action_From\": \""+action.actionFrom+"\""
-				actionto_part := "\"Action_To\": \""+action.actionTo+"\""
-				reason_part := "\"Reason\": \""+action.reason+"\""
-				severity_part := "\"Severity\": \""+action.severity+"\""
-				category_part := "\"Category\": \""+action.category+"\""
-				
-				action_payload := "{"+timestamp_part+","+appid_part+","+appname_part+","+servername_part+","+actiondetails_part+","+actiontype_part+","+actionfrom_part+","+actionto_part+","+reason_part+","+severity_part+","+category_part+"}"
+			for _,action := range getServerActions(serverName, appServerUuids[appId][serverName], allServerActions, uuidActions, duplicateNames) {
+				action_payload := actionRowPayload(timeString, appId, appName, serverName, appServerPatterns[appId][serverName], action)
 				app_action_count++ 
+				appSavings[appId] += action.savingsPerMonth
+				appInvestment[appId] += action.investmentPerMonth
 				if (payload == "") {
 					payload =  "[" + action_payload
 				} else {
@@ -293,6 +964,7 @@ func pushPowerBiData(appId2Name map[string]string, appId2Servers map[string][]st
   			}
 	  	}
 	  	payload = payload + "]"
+	  	appActionCounts[appId] = app_action_count
 	  	
 	    if (app_action_count > 0) {
 	  	
@@ -310,117 +982,344 @@ func pushPowerBiData(appId2Name map[string]string, appId2Servers map[string][]st
 // 		}
 // 		fmt.Println(string(requestDump))
 	
-			res, _:= client.Do(req)
-			defer res.Body.Close()
-			
-			
-			if (res.StatusCode != 200) {
-				fmt.Printf("### ERROR ### sending %d records for application %s\n:", app_action_count, appName) 
-				fmt.Println("### HTML ERROR ### ", res.StatusCode, http.StatusText(res.StatusCode))
+			res, err := client.Do(req)
+			if err != nil {
+				fmt.Printf("### ERROR ### sending %d records for application %s:\n", app_action_count, appName) 
+				fmt.Println(err)
 			} else {
-				fmt.Printf("... sent %d action(s) for application %s\n", app_action_count, appName)
+				defer res.Body.Close()
+				if (res.StatusCode != 200) {
+					fmt.Printf("### ERROR ### sending %d records for application %s:\n", app_action_count, appName) 
+					fmt.Println("### HTML ERROR ### ", res.StatusCode, http.StatusText(res.StatusCode))
+				} else {
+					fmt.Printf("... sent %d action(s) for application %s (savings $%.2f/month, investment $%.2f/month)\n", app_action_count, appName, appSavings[appId], appInvestment[appId])
+				}
 			}
 			
 			powerBiApiCount++
- 			if ((powerBiApiCount % 110) == 0) {
-				fmt.Printf("... made %d API calls. SLEEPING for 70 seconds to avoid overloading PowerBI API limits ...", powerBiApiCount)
-				time.Sleep(70 * time.Second)
+ 			if ((powerBiApiCount % powerBiThrottleCalls) == 0) {
+				fmt.Printf("... made %d API calls. SLEEPING for %d seconds to avoid overloading PowerBI API limits ...", powerBiApiCount, int(powerBiThrottleSleep.Seconds()))
+				powerBiSleep(powerBiThrottleSleep)
 				fmt.Printf(" continuing ...\n")
 			}
 		}
 	}
+	
+	printAppCostSummary(appId2Name, appActionCounts, appSavings, appInvestment)
 }
 
-// Does basic processing of the csv file
-func getFileInfo(csv_file string) (int, int, int, int) {
+// Prints the actions, savings and investment per application, biggest savings first, and the totals.
+func printAppCostSummary(appId2Name map[string]string, appActionCounts map[string]int, appSavings map[string]float64, appInvestment map[string]float64) {
+	var appIds []string
+	for appId,count := range appActionCounts {
+		if (count > 0) {
+			appIds = append(appIds, appId)
+		}
+	}
+	if (len(appIds) == 0) {
+		return
+	}
+	sort.Slice(appIds, func(i, j int) bool {
+		if (appSavings[appIds[i]] != appSavings[appIds[j]]) {
+			return appSavings[appIds[i]] > appSavings[appIds[j]]
+		}
+		return appIds[i] < appIds[j]
+	})
 	
-	// Open the file
-	appservercsv, err := os.Open(csv_file)
-	if (err != nil) {
-		fmt.Println("*** Error opening file: "+ csv_file)
-		os.Exit(5)
+	totalActions := 0
+	totalSavings := 0.0
+	totalInvestment := 0.0
+	fmt.Println("\n*** Savings and investment per application ($ per month):")
+	fmt.Printf("%-40s %8s %12s %12s\n", "Application", "Actions", "Savings", "Investment")
+	for _,appId := range appIds {
+		fmt.Printf("%-40s %8d %12.2f %12.2f\n", appId2Name[appId], appActionCounts[appId], appSavings[appId], appInvestment[appId])
+		totalActions += appActionCounts[appId]
+		totalSavings += appSavings[appId]
+		totalInvestment += appInvestment[appId]
 	}
-	readfile := csv.NewReader(appservercsv)
+	fmt.Printf("%-40s %8d %12.2f %12.2f\n\n", "TOTAL", totalActions, totalSavings, totalInvestment)
+}
 
-	// Run through the file and find the number of lines in the file and the columns that have the server name and app (i.e. component) id
-	numLines := 0
+// Builds the JSON for one PowerBI row for the given action
+// The Server_Pattern field is only included if the server came from a pattern so datasets without it still work for CSVs without patterns.
+func actionRowPayload(timeString string, appId string, appName string, serverName string, serverPattern string, action Action) string {
+	timestamp_part := "\"Timestamp\": \""+timeString+"\""
+	appid_part := "\"Component_ID\": \""+appId+"\""
+	appname_part := "\"Component_Name\": \""+appName+"\""
+	servername_part := "\"Server_Name\": \""+serverName+"\""
+	actiondetails_part := "\"Action_Details\": \""+action.actionDetails+"\""
+	actiontype_part := "\"Action_Type\": \""+action.actionType+"\""
+	actionfrom_part := "\"Action_From\": \""+action.actionFrom+"\""
+	actionto_part := "\"Action_To\": \""+action.actionTo+"\""
+	reason_part := "\"Reason\": \""+action.reason+"\""
+	severity_part := "\"Severity\": \""+action.severity+"\""
+	category_part := "\"Category\": \""+action.category+"\""
+	savings_part := "\"Savings_Per_Month\": "+strconv.FormatFloat(action.savingsPerMonth, 'f', 2, 64)
+	investment_part := "\"Investment_Per_Month\": "+strconv.FormatFloat(action.investmentPerMonth, 'f', 2, 64)
+	fromvalue_part := "\"Action_From_Value\": null"
+	tovalue_part := "\"Action_To_Value\": null"
+	if (action.valueUnit != "") {
+		fromvalue_part = "\"Action_From_Value\": "+formatUnitValue(action.fromValue)
+		tovalue_part = "\"Action_To_Value\": "+formatUnitValue(action.toValue)
+	}
+	unit_part := "\"Action_Unit\": \""+action.valueUnit+"\""
+	
+	serverpattern_part := ""
+	if (serverPattern != "") {
+		// Patterns are likely to have backslashes so this one is encoded properly
+		encodedPattern, _ := json.Marshal(serverPattern)
+		serverpattern_part = ",\"Server_Pattern\": "+string(encodedPattern)
+	}
 	
-	componentIdColName := "Component_Id"
-	componentIdColumn := -1 
-	componentNameColName := "Component_Name"
-	componentNameColumn := -1 
-	serverNameColName := "Server_Name"
-	serverNameColumn := -1
-	columnNameLine := -1
-	for {
-		record, err := readfile.Read()
-		if (err == io.EOF) {
-			break
-		}	
+	return "{"+timestamp_part+","+appid_part+","+appname_part+","+servername_part+","+actiondetails_part+","+actiontype_part+","+actionfrom_part+","+actionto_part+","+reason_part+","+severity_part+","+category_part+","+savings_part+","+investment_part+","+fromvalue_part+","+tovalue_part+","+unit_part+serverpattern_part+"}"
+}
 
-		if (err != nil) {
-			fmt.Println("*** Failed to read a record in CSV file.") 
-		} else {
-			numLines += 1
-
-			for index,content := range record {
-				if (content == componentIdColName) {
-					componentIdColumn = index
-					columnNameLine = numLines
-				}  else if (content == serverNameColName) {
-					serverNameColumn = index	
-					columnNameLine = numLines
-				}	else if (content == componentNameColName) {
-					componentNameColumn = index	
-					columnNameLine = numLines
+// Builds the normalizer for the server_names rules in the config file
+func newNormalizer(rules serverNameRules) *serverNameNormalizer {
+	normalizer, err := newServerNameNormalizer(rules)
+	if (err != nil) {
+		fmt.Println("*** Error in server_names config: " + err.Error())
+		os.Exit(12)
+	}
+	return normalizer
+}
+
+// Applies the normalization rules to the server names in the mapping and in the actions and reports any different names that were made the same.
+// Server names in Turbo that are made the same end up with more than one UUID, so they are then handled like any other duplicate name.
+// Returns the mapping and action maps keyed by the normalized names.
+func normalizeServerNames(normalizer *serverNameNormalizer, appId2Servers map[string][]string, appServerUuids map[string]map[string]string, allServerActions map[string][]Action, serverUuids map[string][]string) (map[string][]string, map[string]map[string]string, map[string][]Action, map[string][]string) {
+	if (!normalizer.active()) {
+		return appId2Servers, appServerUuids, allServerActions, serverUuids
+	}
+	
+	// Turbo side
+	var turboNames []string
+	for serverName := range serverUuids {
+		turboNames = append(turboNames, serverName)
+	}
+	for serverName := range allServerActions {
+		if _,ok := serverUuids[serverName]; !ok {
+			turboNames = append(turboNames, serverName)
+		}
+	}
+	sort.Strings(turboNames)
+	turboNormalized,turboCollisions := normalizer.normalizeNames(turboNames)
+	
+	normalizedActions := make(map[string][]Action)
+	normalizedUuids := make(map[string][]string)
+	for _,serverName := range turboNames {
+		name := turboNormalized[serverName]
+		normalizedActions[name] = append(normalizedActions[name], allServerActions[serverName]...)
+		normalizedUuids[name] = append(normalizedUuids[name], serverUuids[serverName]...)
+	}
+	
+	// Mapping side
+	var mappingNames []string
+	for _,servers := range appId2Servers {
+		for _,serverName := range servers {
+			if (!isServerPattern(serverName)) {
+				mappingNames = append(mappingNames, serverName)
+			}
+		}
+	}
+	sort.Strings(mappingNames)
+	mappingNormalized,mappingCollisions := normalizer.normalizeNames(mappingNames)
+	
+	normalizedServers := make(map[string][]string)
+	normalizedServerUuids := make(map[string]map[string]string)
+	for appId,servers := range appId2Servers {
+		seen := make(map[string]bool)
+		for _,serverName := range servers {
+			name := serverName
+			if (!isServerPattern(serverName)) {
+				name = mappingNormalized[serverName]
+			}
+			if (!seen[name]) {
+				seen[name] = true
+				normalizedServers[appId] = append(normalizedServers[appId], name)
+			}
+			if serverUuid := appServerUuids[appId][serverName]; (serverUuid != "") {
+				if (normalizedServerUuids[appId] == nil) {
+					normalizedServerUuids[appId] = make(map[string]string)
 				}
+				normalizedServerUuids[appId][name] = serverUuid
 			}
 		}
 	}
+	
+	if (len(turboCollisions) + len(mappingCollisions) > 0) {
+		fmt.Printf("\n#####\n#### Normalizing made %d Turbo server name(s) and %d mapping server name(s) the same. #####\n", len(turboCollisions), len(mappingCollisions))
+		printNameCollisions("Turbo", turboCollisions)
+		printNameCollisions("mapping", mappingCollisions)
+		fmt.Printf("#####\n\n")
+	}
+	
+	return normalizedServers, normalizedServerUuids, normalizedActions, normalizedUuids
+}
 
-	if (columnNameLine != 1) {
-		// The CSV file needs to have the column headers at the top otherwise
-		fmt.Println("*** CSV file MUST have the column names on the first line of the file. ***")
-		os.Exit(10)
-	}	
+func printNameCollisions(source string, collisions map[string][]string) {
+	var names []string
+	for name := range collisions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _,name := range names {
+		fmt.Printf("### %s: %s <- %s\n", source, name, strings.Join(collisions[name], ", "))
+	}
+}
+
+// Resolves the Server_Name patterns in the mapping against the names of the servers with actions and reports what each pattern matched.
+// Returns:
+// - map: App ID -> array of Server Names with the patterns replaced by the names they matched
+// - map: App ID -> Server Name -> pattern it matched
+func resolveServerPatterns(appId2Servers map[string][]string, allServerActions map[string][]Action) (map[string][]string, map[string]map[string]string) {
+	var serverNames []string
+	for serverName := range allServerActions {
+		serverNames = append(serverNames, serverName)
+	}
 	
-	if (componentIdColumn < 0) {
-		fmt.Println("*** No \""+componentIdColName+"\" column found.")
-		fmt.Println("*** Either the column heading is not there, or there's some weird ufeff character in that row.")
+	expanded, appServerPatterns, unmatched, err := expandServerPatterns(appId2Servers, serverNames)
+	if (err != nil) {
+		fmt.Println("*** Error in Server_Name pattern: " + err.Error())
 		os.Exit(11)
 	}
 	
-	if (componentNameColumn < 0) {
-		fmt.Println("*** No \""+componentNameColName+"\" column found.")
-		fmt.Println("*** Either the column heading is not there, or there's some weird ufeff character in that row.")
-		os.Exit(11)
+	var appIds []string
+	for appId := range appServerPatterns {
+		appIds = append(appIds, appId)
 	}
+	for appId := range unmatched {
+		if (appServerPatterns[appId] == nil) {
+			appIds = append(appIds, appId)
+		}
+	}
+	sort.Strings(appIds)
+	for _,appId := range appIds {
+		var matches []string
+		for serverName,pattern := range appServerPatterns[appId] {
+			matches = append(matches, serverName + " (matched " + pattern + ")")
+		}
+		sort.Strings(matches)
+		fmt.Printf("... application %s: %d server(s) from patterns\n", appId, len(matches))
+		for _,match := range matches {
+			fmt.Println("...    " + match)
+		}
+		for _,pattern := range unmatched[appId] {
+			fmt.Println("### pattern " + pattern + " did not match any server with actions")
+		}
+	}
+	
+	return expanded, appServerPatterns
+}
 
-	if (serverNameColumn < 0) {
-		fmt.Println("*** No \""+serverNameColName+"\" column found.")
-		fmt.Println("*** Either the column heading is not there, or there's some weird ufeff character in that row.")
-		os.Exit(11)
+// Returns the actions for a server in an application.
+// If the CSV gave the server's UUID, that is used to find the actions, otherwise the server name is used.
+// A name found on more than one server without a UUID returns no actions since there's no telling which server the CSV meant.
+func getServerActions(serverName string, serverUuid string, allServerActions map[string][]Action, uuidActions map[string][]Action, duplicateNames map[string][]string) []Action {
+	if (serverUuid != "") {
+		return uuidActions[serverUuid]
+	}
+	if (len(duplicateNames[serverName]) > 0) {
+		return nil
+	}
+	return allServerActions[serverName]
+}
+
+// Re-indexes the actions by server UUID
+func getUuidActions(allServerActions map[string][]Action) map[string][]Action {
+	uuidActions := make(map[string][]Action)
+	for _,actions := range allServerActions {
+		for _,action := range actions {
+			uuidActions[action.serverUuid] = append(uuidActions[action.serverUuid], action)
+		}
+	}
+	return uuidActions
+}
+
+// Finds the server names that are used by more than one server.
+// Returns:
+// - map: Server Name -> the distinct Server UUIDs with that name. Only names with more than one UUID are included.
+func findDuplicateServerNames(serverUuids map[string][]string) map[string][]string {
+	duplicateNames := make(map[string][]string)
+	for serverName,uuids := range serverUuids {
+		var distinctUuids []string
+		seen := make(map[string]bool)
+		for _,uuid := range uuids {
+			if (!seen[uuid]) {
+				seen[uuid] = true
+				distinctUuids = append(distinctUuids, uuid)
+			}
+		}
+		if (len(distinctUuids) > 1) {
+			sort.Strings(distinctUuids)
+			duplicateNames[serverName] = distinctUuids
+		}
+	}
+	return duplicateNames
+}
+
+// Prints the server names found on more than one server along with where each server was discovered and the applications that use the name.
+func reportDuplicateServerNames(duplicateNames map[string][]string, allServerActions map[string][]Action, appId2Servers map[string][]string, appServerUuids map[string]map[string]string, allowDuplicateNames bool) {
+	if (len(duplicateNames) == 0) {
+		return
 	}
 	
-	return numLines, componentIdColumn, componentNameColumn, serverNameColumn
+	var serverNames []string
+	for serverName := range duplicateNames {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+	
+	fmt.Printf("\n#####\n#### Found %d server name(s) used by more than one server. #####\n", len(duplicateNames))
+	if (allowDuplicateNames) {
+		fmt.Println("#### Actions for all the servers with these names will be sent for applications without a Server_UUID for them.")
+	} else {
+		fmt.Println("#### Actions for these names will NOT be sent for applications without a Server_UUID for them in the CSV.")
+	}
+	for _,serverName := range serverNames {
+		fmt.Printf("### %s\n", serverName)
+		for _,uuid := range duplicateNames[serverName] {
+			discoveredBy := "UNKNOWN"
+			for _,action := range allServerActions[serverName] {
+				if ((action.serverUuid == uuid) && (action.discoveredBy != "")) {
+					discoveredBy = action.discoveredBy
+					break
+				}
+			}
+			fmt.Printf("###    UUID %s discovered by %s\n", uuid, discoveredBy)
+		}
+		var appIds []string
+		for appId,servers := range appId2Servers {
+			for _,server := range servers {
+				if (server == serverName) {
+					appLabel := appId
+					if (appServerUuids[appId][serverName] == "") {
+						appLabel = appId + " (no Server_UUID)"
+					}
+					appIds = append(appIds, appLabel)
+					break
+				}
+			}
+		}
+		if (len(appIds) > 0) {
+			sort.Strings(appIds)
+			fmt.Printf("###    used by application(s): %s\n", strings.Join(appIds, ", "))
+		}
+	}
+	fmt.Printf("#####\n\n")
 }
 
-// Calls Turbo Actions API to get all resize actions currently identified by Turbo.
+// Calls Turbo Actions API to get all the actions currently identified by Turbo that match the payload (see actionQuery).
 // Returns:
 // - map: Server Name as found in the actions -> Array of Server UUIDs found in the actions for the given server name. 
 // - map: Server Name as found in the actions -> Array of Actions for the server.
-// CAVEAT: This and related logic assumes server names are unique in the system. If that is not the case, then the server name -> server UUID mapping
-// may be used to debug that and figure out how best to handle the situation. But since the CSV is the rosetta stone here and it does
-// not have Turbo UUIDs in it, we have to use the Server Name as the key.
-func getAllActions (turbo_instance string, turbo_user string, turbo_password string) (map[string][]Action, map[string][]string) {
-	
-	auth := turboLogin(turbo_instance, turbo_user, turbo_password) 
+// The actions are keyed by Server Name since that is what the mapping has. Server names aren't always unique, so the UUIDs are kept
+// for findDuplicateServerNames, and getServerActions uses the mapping's Server_UUID to pick a server's actions when there is one.
+func getAllActions (turbo_instance string, auth string, payload []byte) (map[string][]Action, map[string][]string) {
 	
 	base_url := "https://"+turbo_instance+"/vmturbo/rest/markets/Market/actions"
 	url := base_url
 	method := "POST"
-	// We only care about resize actions
-	payload := []byte(`{"actionTypeList":["RESIZE","RIGHT_SIZE","SCALE"],"environmentType":"HYBRID","detailLevel":"EXECUTION"}`)
 	
 	customTransport := http.DefaultTransport.(*http.Transport).Clone()
 	customTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
@@ -477,106 +1376,11 @@ func getAllActions (turbo_instance string, turbo_user string, turbo_password str
 		// Map that indexes by server name and contains all the resize actions for that server name
 		// Later on we'll use that sever name to map the actions to the applicable application (aka componen)
 		var allActions []Action
-		var riskcommodity string
-		var fromval, toval float64
 		for _, responseAction := range responseActions {
-			var serverName, serverUuid string
-			var action Action
-			var actionFrom, actionTo string
-			badAction := false
-			
-			if (responseAction["target"].(map[string]interface{})["displayName"] != nil) {
-				serverName = responseAction["target"].(map[string]interface{})["displayName"].(string)
-			} else {
-				serverName = "UNKNOWN"
-				badAction = true
-			}
-
-			if (responseAction["target"].(map[string]interface{})["uuid"] != nil) {
-				serverUuid = responseAction["target"].(map[string]interface{})["uuid"].(string)
-			} else {
-				serverUuid = "UNKNOWN"
-				badAction = true
-			}
-
-			if (responseAction["uuid"] != nil) {
-				action.actionUuid = responseAction["uuid"].(string)
-			} else {
-				action.actionUuid = "UNKNOWN"
-				badAction = true
-			}
-
-			if (responseAction["actionType"] != nil) {
-				action.actionType = responseAction["actionType"].(string)
-			} else {
-				action.actionType = "UNKNOWN"
-				badAction = true
-			}
-			
-			if (responseAction["risk"].(map[string]interface{})["description"] != nil) {
-				action.reason = responseAction["risk"].(map[string]interface{})["description"].(string)
-			} else {
-				action.reason = "UNKNOWN"
-				badAction = true
-			}
-			
-			if (responseAction["risk"].(map[string]interface{})["severity"] != nil) {
-				action.severity = responseAction["risk"].(map[string]interface{})["severity"].(string)
-			} else {
-				action.severity = "UNKNOWN"
-				badAction = true
-			}
-
-			if (responseAction["risk"].(map[string]interface{})["subCategory"] != nil) {
-				action.category = responseAction["risk"].(map[string]interface{})["subCategory"].(string)
-			} else {
-				action.category = "UNKNOWN"
-				badAction = true
-			}
-
-			if (responseAction["details"] != nil) {
-				action.actionDetails = responseAction["details"].(string)
-			} else {
-				action.actionDetails = "UNKNOWN"
-				badAction = true
-			}
-
-			if  (responseAction["target"].(map[string]interface{})["environmentType"] == "CLOUD") {
-				actionFrom = responseAction["currentEntity"].(map[string]interface{})["displayName"].(string)
-				actionTo = responseAction["newEntity"].(map[string]interface{})["displayName"].(string)
-			} else {
-				riskcommodity = "UNKNOWN"
-				if (responseAction["risk"].(map[string]interface{})["reasonCommodity"] != nil) {
-					riskcommodity = responseAction["risk"].(map[string]interface{})["reasonCommodity"].(string)
-				}
-
-				if (riskcommodity == "VCPU") {
-					// Get CPU values (in float)
-					fromval, _ = strconv.ParseFloat(responseAction["currentValue"].(string), 32)
-					toval, _ = strconv.ParseFloat(responseAction["resizeToValue"].(string), 32)
-					// Convert from float to int
-					actionFrom = strconv.Itoa(int(fromval))
-					actionTo = strconv.Itoa(int(toval))
-				} else if (riskcommodity == "VMem") {
-					fromval, _ = strconv.ParseFloat(responseAction["currentValue"].(string), 32)
-					// Convert to GB
-					fromval = (fromval/(1024*1024))
-					toval, _ = strconv.ParseFloat(responseAction["resizeToValue"].(string), 32)
-					// Convert to GB
-					toval = (toval/(1024*1024))
-					// Convert from float to int
-					actionFrom = strconv.Itoa(int(fromval))
-					actionTo = strconv.Itoa(int(toval))
-				} else {
-					actionFrom = "NA"
-					actionTo = "NA"
-				}
-			}
-			action.actionFrom = actionFrom
-			action.actionTo = actionTo
+			serverName, serverUuid, action, badAction := parseAction(responseAction)
 			allActions = append(allResizeActions[serverName], action)
 			allResizeActions[serverName] = allActions
-			// add the server uuid to the map in case it's handy later.
+			// add the server uuid to the map so servers that share a name can be told apart.
 			allActionServerUuids[serverName] = append(allActionServerUuids[serverName], serverUuid)	
 			
 			if (badAction) {
@@ -606,6 +1410,139 @@ func getAllActions (turbo_instance string, turbo_user string, turbo_password str
 	
 
 
+// Maps a single action as returned by the Turbo actions API to what is pushed to PowerBI.
+// For CLOUD targets Action_From/Action_To are the current and new template names.
+// For on-prem targets, resizes of commodities with a known unit get their from/to values converted to human units
+// (e.g. VMem from KB to GB), the same as the Action_From_Value/Action_To_Value numbers. Anything else is "NA".
+// Returns:
+// - Server (i.e. action target) name and UUID. "UNKNOWN" if not in the action.
+// - The action.
+// - Whether or not the action was missing data.
+func parseAction(responseAction map[string]interface{}) (serverName string, serverUuid string, action Action, badAction bool) {
+
+	var actionFrom, actionTo string
+	var riskcommodity string
+	badAction = false
+
+	// A missing target or risk would otherwise panic on the lookups below; treat them as empty so the action is just flagged as bad.
+	target, ok := responseAction["target"].(map[string]interface{})
+	if (!ok) {
+		target = map[string]interface{}{}
+	}
+	risk, ok := responseAction["risk"].(map[string]interface{})
+	if (!ok) {
+		risk = map[string]interface{}{}
+	}
+	
+	if (target["displayName"] != nil) {
+		serverName = target["displayName"].(string)
+	} else {
+		serverName = "UNKNOWN"
+		badAction = true
+	}
+
+	if (target["uuid"] != nil) {
+		serverUuid = target["uuid"].(string)
+	} else {
+		serverUuid = "UNKNOWN"
+		badAction = true
+	}
+	action.serverUuid = serverUuid
+	
+	// Where the server was discovered (e.g. vCenter or cloud account). Only used for reporting so it's fine if it's missing.
+	if discoveredBy, ok := target["discoveredBy"].(map[string]interface{}); ok && (discoveredBy["displayName"] != nil) {
+		action.discoveredBy = discoveredBy["displayName"].(string)
+	}
+
+	if (responseAction["uuid"] != nil) {
+		action.actionUuid = responseAction["uuid"].(string)
+	} else {
+		action.actionUuid = "UNKNOWN"
+		badAction = true
+	}
+
+	if (responseAction["actionType"] != nil) {
+		action.actionType = responseAction["actionType"].(string)
+	} else {
+		action.actionType = "UNKNOWN"
+		badAction = true
+	}
+	
+	if (risk["description"] != nil) {
+		action.reason = risk["description"].(string)
+	} else {
+		action.reason = "UNKNOWN"
+		badAction = true
+	}
+	
+	if (risk["severity"] != nil) {
+		action.severity = risk["severity"].(string)
+	} else {
+		action.severity = "UNKNOWN"
+		badAction = true
+	}
+
+	if (risk["subCategory"] != nil) {
+		action.category = risk["subCategory"].(string)
+	} else {
+		action.category = "UNKNOWN"
+		badAction = true
+	}
+
+	if (responseAction["details"] != nil) {
+		action.actionDetails = responseAction["details"].(string)
+	} else {
+		action.actionDetails = "UNKNOWN"
+		badAction = true
+	}
+
+	if  (target["environmentType"] == "CLOUD") {
+		currentEntity, _ := responseAction["currentEntity"].(map[string]interface{})
+		newEntity, _ := responseAction["newEntity"].(map[string]interface{})
+		if (currentEntity["displayName"] != nil) && (newEntity["displayName"] != nil) {
+			actionFrom = currentEntity["displayName"].(string)
+			actionTo = newEntity["displayName"].(string)
+		} else {
+			actionFrom = "UNKNOWN"
+			actionTo = "UNKNOWN"
+			badAction = true
+		}
+	} else {
+		riskcommodity = "UNKNOWN"
+		if (risk["reasonCommodity"] != nil) {
+			riskcommodity = risk["reasonCommodity"].(string)
+		}
+
+		currentValue, _ := responseAction["currentValue"].(string)
+		resizeToValue, _ := responseAction["resizeToValue"].(string)
+		// Numbers in human units (e.g. GB) for the _Value columns and the text, so they always agree
+		valueUnits, _ := responseAction["valueUnits"].(string)
+		from, fromUnit, fromOk := convertCommodityValue(riskcommodity, valueUnits, currentValue)
+		to, _, toOk := convertCommodityValue(riskcommodity, valueUnits, resizeToValue)
+		if (fromOk && toOk) {
+			action.fromValue = from
+			action.toValue = to
+			action.valueUnit = fromUnit
+			actionFrom = formatUnitValue(from)
+			actionTo = formatUnitValue(to)
+		} else if (riskcommodity == "VCPU") || (riskcommodity == "VMem") {
+			// Every VCPU and VMem resize should have its values
+			actionFrom = "UNKNOWN"
+			actionTo = "UNKNOWN"
+			badAction = true
+		} else {
+			actionFrom = "NA"
+			actionTo = "NA"
+		}
+	}
+	action.actionFrom = actionFrom
+	action.actionTo = actionTo
+	action.savingsPerMonth, action.investmentPerMonth = parseActionCosts(responseAction)
+
+	return serverName, serverUuid, action, badAction
+}
+
+
 
 // Login to turbo
 func turboLogin(turbo_instance string, turbo_user string, turbo_password string) string {
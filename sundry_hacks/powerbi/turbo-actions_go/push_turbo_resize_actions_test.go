@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResizeAction(uuid string, actionType string) Action {
+	return Action{
+		actionUuid:    uuid,
+		actionDetails: "Resize VCPU for Virtual Machine " + uuid,
+		actionType:    actionType,
+		actionFrom:    "4",
+		actionTo:      "2",
+		reason:        "Underutilized VCPU",
+		severity:      "MINOR",
+		category:      "Efficiency Improvement",
+	}
+}
+
+// Stops the throttling from actually sleeping and records how long it would have slept.
+func stubPowerBiSleep(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	savedSleep := powerBiSleep
+	powerBiSleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { powerBiSleep = savedSleep })
+	return &slept
+}
+
+func TestPushPowerBiDataSendsOnePostPerApplication(t *testing.T) {
+	stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+
+	appId2Name := map[string]string{"APP1": "Payroll", "APP2": "Web Store", "APP3": "No Actions"}
+	appId2Servers := map[string][]string{
+		"APP1": {"pay01", "pay02"},
+		"APP2": {"web01"},
+		"APP3": {"idle01"},
+	}
+	allServerActions := map[string][]Action{
+		"pay01": {testResizeAction("a1", "RIGHT_SIZE"), testResizeAction("a2", "RIGHT_SIZE")},
+		"pay02": {testResizeAction("a3", "RESIZE")},
+		"web01": {testResizeAction("a4", "SCALE")},
+	}
+
+	pushPowerBiData(appId2Name, appId2Servers, nil, nil, allServerActions, nil, url)
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertPostCount(t, 2)
+	fake.assertRowCount(t, 4)
+	fake.assertRowsWhere(t, map[string]interface{}{"Component_ID": "APP1", "Component_Name": "Payroll"}, 3)
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "web01", "Action_Type": "SCALE"}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Component_ID": "APP3"}, 0)
+}
+
+func TestPushPowerBiDataThrottles(t *testing.T) {
+	slept := stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+	fake.setRateLimit(powerBiThrottleCalls, time.Hour)
+
+	appId2Name := make(map[string]string)
+	appId2Servers := make(map[string][]string)
+	allServerActions := make(map[string][]Action)
+	apps := powerBiThrottleCalls + 5
+	for i := 0; i < apps; i++ {
+		appId := "APP" + strconv.Itoa(i)
+		server := "srv" + strconv.Itoa(i)
+		appId2Name[appId] = "Application " + strconv.Itoa(i)
+		appId2Servers[appId] = []string{server}
+		allServerActions[server] = []Action{testResizeAction("a"+strconv.Itoa(i), "RESIZE")}
+	}
+
+	pushPowerBiData(appId2Name, appId2Servers, nil, nil, allServerActions, nil, url)
+
+	if len(*slept) != 1 || (*slept)[0] != powerBiThrottleSleep {
+		t.Errorf("throttle slept %v, want one sleep of %v", *slept, powerBiThrottleSleep)
+	}
+	fake.assertPostCount(t, apps)
+	fake.assertNoSchemaErrors(t)
+	// The stubbed sleep does not reset the fake's rate window so the POSTs after the pause are refused.
+	// What matters here is that the pause happened exactly at the limit.
+	fake.assertRowCount(t, powerBiThrottleCalls)
+}
+
+func TestPushPowerBiDataKeepsGoingAfterErrors(t *testing.T) {
+	stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+	fake.injectStatus(http.StatusInternalServerError)
+	fake.setLatency(10 * time.Millisecond)
+
+	appId2Name := map[string]string{"APP1": "Payroll", "APP2": "Web Store"}
+	appId2Servers := map[string][]string{"APP1": {"pay01"}, "APP2": {"web01"}}
+	allServerActions := map[string][]Action{
+		"pay01": {testResizeAction("a1", "RESIZE")},
+		"web01": {testResizeAction("a2", "RESIZE")},
+	}
+
+	pushPowerBiData(appId2Name, appId2Servers, nil, nil, allServerActions, nil, url)
+
+	fake.assertPostCount(t, 2)
+	fake.assertRowCount(t, 1)
+	statuses := fake.postStatuses()
+	if statuses[0] != http.StatusInternalServerError || statuses[1] != http.StatusOK {
+		t.Errorf("statuses = %v, want [500 200]", statuses)
+	}
+}
+
+func TestPushPowerBiDataDisambiguatesDuplicateNames(t *testing.T) {
+	stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+
+	east := testResizeAction("a1", "RESIZE")
+	east.serverUuid = "uuid-east"
+	west := testResizeAction("a2", "RESIZE")
+	west.serverUuid = "uuid-west"
+	allServerActions := map[string][]Action{"db01": {east, west}}
+	serverUuids := map[string][]string{"db01": {"uuid-east", "uuid-west"}}
+	duplicateNames := findDuplicateServerNames(serverUuids)
+	if len(duplicateNames["db01"]) != 2 {
+		t.Fatalf("duplicate names = %v, want db01 with 2 UUIDs", duplicateNames)
+	}
+
+	appId2Name := map[string]string{"APP1": "Payroll", "APP2": "Web Store"}
+	appId2Servers := map[string][]string{"APP1": {"db01"}, "APP2": {"db01"}}
+	// Only APP1 says which db01 it means
+	appServerUuids := map[string]map[string]string{"APP1": {"db01": "uuid-west"}}
+
+	pushPowerBiData(appId2Name, appId2Servers, appServerUuids, nil, allServerActions, duplicateNames, url)
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 1)
+	rows := fake.rowsWhere(map[string]interface{}{"Component_ID": "APP1"})
+	if len(rows) != 1 || rows[0]["Action_Details"] != west.actionDetails {
+		t.Errorf("APP1 rows = %v, want only the uuid-west action", rows)
+	}
+}
+
+func TestPushPowerBiDataCsvWithDuplicateServerNames(t *testing.T) {
+	stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+
+	mapping, err := readAppMappingCsv(filepath.Join("testdata", "csv", "duplicate_server_names.csv"), csvMappingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	east := testResizeAction("a1", "RESIZE")
+	east.serverUuid = "uuid-east"
+	west := testResizeAction("a2", "RESIZE")
+	west.serverUuid = "uuid-west"
+	allServerActions := map[string][]Action{"db01": {east, west}}
+	duplicateNames := findDuplicateServerNames(map[string][]string{"db01": {"uuid-east", "uuid-west"}})
+
+	pushPowerBiData(map[string]string{"APP1": "Payroll"}, mapping.appId2Servers, mapping.appServerUuids, nil, allServerActions, duplicateNames, url)
+
+	fake.assertNoSchemaErrors(t)
+	// Each db01's action once, under the name the server is listed as
+	fake.assertRowCount(t, 2)
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "db01", "Action_Details": east.actionDetails}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "db01 (uuid-west)", "Action_Details": west.actionDetails}, 1)
+}
+
+func TestPushPowerBiDataRowsMatchSchema(t *testing.T) {
+	stubPowerBiSleep(t)
+	fake, url := startFakePowerBi(t, "resize")
+	fake.strict = true
+
+	pushPowerBiData(map[string]string{"APP1": "Payroll"}, map[string][]string{"APP1": {"pay01"}}, nil, nil,
+		map[string][]Action{"pay01": {testResizeAction("a1", "RESIZE")}}, nil, url)
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 1)
+}
+
+func TestFakePowerBiRejectsRowsNotInSchema(t *testing.T) {
+	fake, url := startFakePowerBi(t, "Timestamp:DateTime,Name:Text,Count:Number")
+
+	res, err := http.Post(url, "application/json", strings.NewReader(`[{"Timestamp":"not a time","Name":"x","Count":"3","Extra":"y"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", res.StatusCode)
+	}
+	if got := len(fake.schemaProblems()); got != 3 {
+		t.Errorf("got %d schema problems, want 3: %v", got, fake.schemaProblems())
+	}
+	fake.assertRowCount(t, 0)
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// Each case is a recorded action from the Turbo actions API in testdata/actions/<name>.json.
+// The golden file, testdata/golden/<name>.golden, holds what parseAction makes of it and the row that is pushed to PowerBI.
+// Run with -update after an intended change to what lands in PowerBI and review the diff.
+func TestParseActionGolden(t *testing.T) {
+	cases := []struct {
+		name      string
+		badAction bool
+	}{
+		{"cloud_scale", false},
+		{"cloud_scale_investment", false},
+		{"onprem_vcpu_resize", false},
+		{"onprem_vmem_resize", false},
+		{"onprem_vstorage_resize", false},
+		{"onprem_dbmem_resize_no_units", false},
+		{"onprem_no_reason_commodity", false},
+		{"malformed_missing_target_name", true},
+		{"malformed_missing_uuid_type_details", true},
+		{"malformed_missing_risk_fields", true},
+		{"malformed_missing_target_and_risk", true},
+		{"malformed_cloud_missing_templates", true},
+		{"malformed_onprem_missing_resize_values", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorded, err := ioutil.ReadFile(filepath.Join("testdata", "actions", tc.name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var responseAction map[string]interface{}
+			if err := json.Unmarshal(recorded, &responseAction); err != nil {
+				t.Fatal(err)
+			}
+
+			serverName, serverUuid, action, badAction := parseAction(responseAction)
+			if badAction != tc.badAction {
+				t.Errorf("badAction = %v, want %v", badAction, tc.badAction)
+			}
+
+			row := actionRowPayload("2020-09-08T12:00:00Z", "APP1", "Payroll", serverName, "", action)
+			var decoded map[string]interface{}
+			if err := json.Unmarshal([]byte(row), &decoded); err != nil {
+				t.Errorf("row is not valid JSON: %v\n%s", err, row)
+			}
+			got := fmt.Sprintf("server_name: %s\nserver_uuid: %s\naction_uuid: %s\nbad_action: %v\nrow: %s\n",
+				serverName, serverUuid, action.actionUuid, badAction, row)
+
+			goldenFile := filepath.Join("testdata", "golden", tc.name+".golden")
+			if *updateGolden {
+				if err := ioutil.WriteFile(goldenFile, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("mapping changed for %s\n--- got\n%s--- want\n%s", tc.name, got, want)
+			}
+		})
+	}
+}
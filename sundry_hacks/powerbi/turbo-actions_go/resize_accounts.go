@@ -0,0 +1,222 @@
+package main
+
+/*
+Actions by cloud account or business unit (-mode accounts).
+Does what tbutil_scripts/get_actions_by_cloud_account.js does: walks /businessunits and gets the actions for each one,
+so the actions are grouped by account instead of by the applications in a mapping.
+*/
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var accountColumns = []string{"Timestamp", "Account_ID", "Account_Name", "Cloud_Type", "Server_Name", "Server_UUID", "Action_Details", "Action_Type",
+	"Action_From", "Action_To", "Reason", "Severity", "Category", "Savings_Per_Month", "Investment_Per_Month"}
+
+type businessUnit struct {
+	uuid      string
+	name      string
+	cloudType string
+}
+
+// Gets the actions for each business unit and writes them to the destination (a CSV file or a Power BI URL).
+// groupBy is "account" for the discovered cloud accounts or "business_unit" for all business units (including billing families).
+// With perAccount and a file destination, each account gets its own file (see accountFileName).
+func accountsReport(turbo_instance string, auth string, payload []byte, groupBy string, destination string, perAccount bool) {
+	businessUnits, err := getBusinessUnits(turbo_instance, auth, groupBy)
+	if err != nil {
+		fmt.Println("*** Error getting business units from Turbo: " + err.Error())
+		os.Exit(3)
+	}
+	if len(businessUnits) == 0 {
+		fmt.Println("*** No cloud accounts found.")
+		return
+	}
+
+	isFile := !strings.HasPrefix(destination, "http://") && !strings.HasPrefix(destination, "https://")
+	if perAccount && !isFile {
+		fmt.Println("### -per_account only applies to CSV files. Sending all accounts to " + destination)
+		perAccount = false
+	}
+
+	var sink rowSink
+	var fileNames map[string]string
+	if perAccount {
+		fileNames = accountFileNames(destination, businessUnits)
+	} else {
+		sink, err = newRowSink(destination, accountColumns)
+		if err != nil {
+			fmt.Println("### ERROR ### " + err.Error())
+			return
+		}
+	}
+
+	timeString := time.Now().Format(time.RFC3339)
+	for _, unit := range businessUnits {
+		actions, err := turboApiGetAll(turbo_instance, auth, "POST", "/businessunits/"+unit.uuid+"/actions", payload)
+		if err != nil {
+			fmt.Printf("### ERROR ### getting actions for %s (%s): %v\n", unit.name, unit.uuid, err)
+			continue
+		}
+		if len(actions) == 0 {
+			fmt.Printf("... no actions found for %s\n", unit.name)
+			continue
+		}
+
+		var rows []map[string]interface{}
+		badActions := 0
+		for _, responseAction := range actions {
+			serverName, serverUuid, action, badAction := parseAction(responseAction)
+			if badAction {
+				badActions++
+			}
+			rows = append(rows, accountActionRow(timeString, unit, serverName, serverUuid, action))
+		}
+		if badActions > 0 {
+			fmt.Printf("### %d action(s) for %s were missing some details\n", badActions, unit.name)
+		}
+
+		if perAccount {
+			writeAccountFile(fileNames[unit.uuid], unit.name, rows)
+		} else if err := sink.writeRows("account "+unit.name, rows); err != nil {
+			fmt.Println("### ERROR ### " + err.Error())
+		}
+	}
+
+	if sink != nil {
+		if err := sink.close(); err != nil {
+			fmt.Println("### ERROR ### " + err.Error())
+		}
+	}
+}
+
+func writeAccountFile(csv_file string, accountName string, rows []map[string]interface{}) {
+	sink, err := newRowSink(csv_file, accountColumns)
+	if err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+		return
+	}
+	if err := sink.writeRows("account "+accountName, rows); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+	if err := sink.close(); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+}
+
+// Gets the business units: the discovered cloud accounts, or all of them, sorted by name.
+func getBusinessUnits(turbo_instance string, auth string, groupBy string) ([]businessUnit, error) {
+	path := "/businessunits?type=DISCOVERED"
+	if groupBy == "business_unit" {
+		path = "/businessunits"
+	}
+	results, err := turboApiGetAll(turbo_instance, auth, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Member accounts found through a master account's target have no target of their own but do have actions.
+	// They are named after the master's target if Turbo only gives their account ID.
+	masterNames := make(map[string]string)
+	for _, result := range results {
+		masterName := targetName(result)
+		if masterName == "" {
+			continue
+		}
+		children, _ := result["children"].([]interface{})
+		for _, child := range children {
+			if childUuid, ok := child.(string); ok {
+				masterNames[childUuid] = masterName
+			}
+		}
+	}
+
+	var businessUnits []businessUnit
+	for _, result := range results {
+		unit := businessUnit{uuid: jsonString(result, "uuid"), name: jsonString(result, "displayName"), cloudType: jsonString(result, "cloudType")}
+		// Like get_actions_by_cloud_account.js, use the name the account's target was given if there is one
+		if name := targetName(result); name != "" {
+			unit.name = name
+		} else if masterName := masterNames[unit.uuid]; masterName != "" && (unit.name == "" || unit.name == unit.uuid) {
+			unit.name = masterName + " / " + unit.uuid
+		}
+		if unit.name == "" {
+			unit.name = unit.uuid
+		}
+		businessUnits = append(businessUnits, unit)
+	}
+	sort.Slice(businessUnits, func(i, j int) bool {
+		return businessUnits[i].name < businessUnits[j].name
+	})
+	return businessUnits, nil
+}
+
+// The display name of a business unit's first target, or "" if it has none
+func targetName(result map[string]interface{}) string {
+	if targets, ok := result["targets"].([]interface{}); ok && len(targets) > 0 {
+		if target, ok := targets[0].(map[string]interface{}); ok {
+			return jsonString(target, "displayName")
+		}
+	}
+	return ""
+}
+
+func accountActionRow(timeString string, unit businessUnit, serverName string, serverUuid string, action Action) map[string]interface{} {
+	return map[string]interface{}{
+		"Timestamp":            timeString,
+		"Account_ID":           unit.uuid,
+		"Account_Name":         unit.name,
+		"Cloud_Type":           unit.cloudType,
+		"Server_Name":          serverName,
+		"Server_UUID":          serverUuid,
+		"Action_Details":       action.actionDetails,
+		"Action_Type":          action.actionType,
+		"Action_From":          action.actionFrom,
+		"Action_To":            action.actionTo,
+		"Reason":               action.reason,
+		"Severity":             action.severity,
+		"Category":             action.category,
+		"Savings_Per_Month":    math.Round(action.savingsPerMonth*100) / 100,
+		"Investment_Per_Month": math.Round(action.investmentPerMonth*100) / 100,
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// File for an account's actions: {account} in the destination is replaced by the account name,
+// otherwise the account name is added before the extension (e.g. actions.csv -> actions_AWS-Prod.csv).
+// See accountFileNames for accounts whose names give the same file.
+func accountFileName(destination string, accountName string) string {
+	account := strings.Trim(unsafeFileChars.ReplaceAllString(accountName, "_"), "_")
+	if strings.Contains(destination, "{account}") {
+		return strings.Replace(destination, "{account}", account, -1)
+	}
+	extension := filepath.Ext(destination)
+	return strings.TrimSuffix(destination, extension) + "_" + account + extension
+}
+
+// Files for each account's actions by account UUID. Accounts whose names would give the same file (e.g. "AWS Prod" and
+// "AWS-Prod", or two accounts with the same name) get their UUID added to the name so neither overwrites the other.
+func accountFileNames(destination string, businessUnits []businessUnit) map[string]string {
+	// Compared in lower case for case-insensitive file systems
+	counts := make(map[string]int)
+	for _, unit := range businessUnits {
+		counts[strings.ToLower(accountFileName(destination, unit.name))]++
+	}
+	fileNames := make(map[string]string)
+	for _, unit := range businessUnits {
+		fileName := accountFileName(destination, unit.name)
+		if counts[strings.ToLower(fileName)] > 1 {
+			fileName = accountFileName(destination, unit.name+"_"+unit.uuid)
+		}
+		fileNames[unit.uuid] = fileName
+	}
+	return fileNames
+}
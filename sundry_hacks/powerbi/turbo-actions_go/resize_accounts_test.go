@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Stands in for the Turbo API with four cloud accounts:
+// - 111111111111, named by its target, with an action. It's the master account of 333333333333.
+// - 222222222222 without actions.
+// - 333333333333, a member account without a target of its own, with an action.
+// - 444444444444, with an action. Its name gives the same file name as 111111111111's.
+func startFakeTurboAccounts(t *testing.T) string {
+	t.Helper()
+	action, err := ioutil.ReadFile(filepath.Join("testdata", "actions", "cloud_scale.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/businessunits", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"uuid": "111111111111", "displayName": "111111111111", "cloudType": "AWS", "hasRelatedTarget": true, "master": true,
+			 "children": ["333333333333"], "targets": [{"displayName": "AWS Prod"}]},
+			{"uuid": "222222222222", "displayName": "AWS-Dev", "cloudType": "AWS", "hasRelatedTarget": true},
+			{"uuid": "333333333333", "displayName": "333333333333", "cloudType": "AWS", "hasRelatedTarget": false},
+			{"uuid": "444444444444", "displayName": "AWS_Prod", "cloudType": "AWS", "hasRelatedTarget": true}
+		]`))
+	})
+	for _, uuid := range []string{"111111111111", "333333333333", "444444444444"} {
+		mux.HandleFunc("/vmturbo/rest/businessunits/"+uuid+"/actions", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("[" + string(action) + "]"))
+		})
+	}
+	mux.HandleFunc("/vmturbo/rest/businessunits/222222222222/actions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+// Reads a CSV written by the report into one map per row
+func readAccountCsv(t *testing.T, csv_file string) []map[string]string {
+	t.Helper()
+	file, err := os.Open(csv_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for index, column := range records[0] {
+			row[column] = record[index]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestAccountsReportPerAccountFiles(t *testing.T) {
+	turbo_instance := startFakeTurboAccounts(t)
+	dir := t.TempDir()
+	payload, _ := newActionQuery().payload()
+
+	accountsReport(turbo_instance, "", payload, "account", filepath.Join(dir, "actions.csv"), true)
+
+	wantNames := map[string]string{
+		"actions_AWS_Prod_111111111111.csv": "AWS Prod",
+		"actions_AWS_Prod_333333333333.csv": "AWS Prod / 333333333333",
+		"actions_AWS_Prod_444444444444.csv": "AWS_Prod",
+	}
+	for fileName, wantName := range wantNames {
+		rows := readAccountCsv(t, filepath.Join(dir, fileName))
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows, want 1 action", fileName, len(rows))
+		}
+		row := rows[0]
+		if row["Account_Name"] != wantName || row["Server_Name"] != "payweb-prd-01" || row["Savings_Per_Month"] != "70.08" {
+			t.Errorf("%s: row = %v", fileName, row)
+		}
+	}
+
+	// No file for the account without actions, and the colliding name isn't used
+	for _, fileName := range []string{"actions_AWS-Dev.csv", "actions_AWS_Prod.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, fileName)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s", fileName)
+		}
+	}
+}
+
+func TestAccountsReportToPowerBi(t *testing.T) {
+	turbo_instance := startFakeTurboAccounts(t)
+	fake, url := startFakePowerBi(t, "accounts")
+	fake.strict = true
+	payload, _ := newActionQuery().payload()
+
+	accountsReport(turbo_instance, "", payload, "account", url, false)
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 3)
+	fake.assertRowsWhere(t, map[string]interface{}{"Account_Name": "AWS Prod", "Cloud_Type": "AWS"}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Account_ID": "333333333333", "Account_Name": "AWS Prod / 333333333333"}, 1)
+}
+
+func TestAccountFileName(t *testing.T) {
+	cases := map[string]string{
+		"actions.csv":               "actions_AWS_Prod_1.csv",
+		"out/{account}-actions.csv": "out/AWS_Prod_1-actions.csv",
+		"actions":                   "actions_AWS_Prod_1",
+	}
+	for destination, want := range cases {
+		if got := accountFileName(destination, "AWS Prod (1)"); got != want {
+			t.Errorf("accountFileName(%q) = %q, want %q", destination, got, want)
+		}
+	}
+}
+
+func TestAccountFileNames(t *testing.T) {
+	businessUnits := []businessUnit{{uuid: "1", name: "AWS Prod"}, {uuid: "2", name: "aws-prod"}, {uuid: "3", name: "aws prod"}, {uuid: "4", name: "AWS Dev"}}
+	want := map[string]string{"1": "actions_AWS_Prod_1.csv", "2": "actions_aws-prod.csv", "3": "actions_aws_prod_3.csv", "4": "actions_AWS_Dev.csv"}
+	got := accountFileNames("actions.csv", businessUnits)
+	for uuid, fileName := range want {
+		if got[uuid] != fileName {
+			t.Errorf("file for %s = %q, want %q", uuid, got[uuid], fileName)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+/*
+Executes approved actions (the execute subcommand).
+
+Only actions allowed by the approval CSV are touched. Each line of the approval CSV allows one of:
+- Action_UUID: that action. Action_From and Action_To are required and must still match the action's.
+- Server_Name: the READY actions on that server with the line's Action_From and Action_To. It may be a pattern like the
+  mapping's Server_Name.
+- Component_Id or Component_Name: the READY actions on the application's servers, as given in the -csv_file mapping,
+  with the line's Action_From and Action_To.
+Server names are matched as in -mode actions, with the config's server_names rules, patterns and the mapping's Server_UUIDs.
+If more than one server has the name, only Action_UUID lines (or a Server_UUID in the mapping) can approve its actions.
+Action_From and Action_To are required on every line, so nothing is executed that wasn't seen when it was approved.
+Server and application lines without them (approving whatever is READY at run time) are only allowed with allowBlanket
+(the -allow_blanket_approval flag).
+Approved_By is optional and is copied to the audit log.
+
+Just before an action is accepted it is fetched again and skipped unless it is still READY and still has the approved from/to.
+Accepted actions are then polled until they succeed, fail or the timeout runs out. Every action considered ends up in
+the audit log with its result. Each row is written as soon as it is known, so an accepted action is in the log (as ACCEPTED)
+even if the run is stopped before it finishes.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var executeAuditColumns = []string{"Timestamp", "Action_UUID", "Server_Name", "Action_Type", "Action_From", "Action_To", "Approval_Line", "Approved_By", "Result", "Detail"}
+
+// Results in the audit log
+const (
+	resultAccepted    = "ACCEPTED"
+	resultSucceeded   = "SUCCEEDED"
+	resultFailed      = "FAILED"
+	resultTimedOut    = "TIMED_OUT"
+	resultNotReady    = "SKIPPED_NOT_READY"
+	resultChanged     = "SKIPPED_CHANGED"
+	resultNotFound    = "SKIPPED_NOT_FOUND"
+	resultAcceptError = "ACCEPT_FAILED"
+	resultDryRun      = "DRY_RUN"
+)
+
+// executeSleep is a variable so tests can poll without waiting
+var executeSleep = time.Sleep
+
+type approval struct {
+	line          int
+	actionUuid    string
+	serverName    string
+	componentId   string
+	componentName string
+	actionFrom    string
+	actionTo      string
+	approvedBy    string
+}
+
+type executeOptions struct {
+	dryRun       bool
+	pollInterval time.Duration
+	timeout      time.Duration
+}
+
+// An action picked for execution and the approval that allows it
+type approvedAction struct {
+	uuid     string
+	approval approval
+}
+
+var approvalColumnNames = []string{"Action_UUID", "Server_Name", "Component_Id", "Component_Name", "Action_From", "Action_To", "Approved_By"}
+
+// Reads the approval CSV. Lines that don't allow anything, or don't give the from/to the action was approved with, are
+// listed in badLines. With allowBlanket, server and application lines don't need the from/to.
+func readApprovalCsv(approval_file string, allowBlanket bool) ([]approval, []string, error) {
+	file, err := os.Open(approval_file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file %s: %v", approval_file, err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	if start, _ := buffered.Peek(len(utf8Bom)); bytes.Equal(start, utf8Bom) {
+		buffered.Discard(len(utf8Bom))
+	}
+	delimiter, err := csvDelimiter("auto", buffered)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(buffered)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read the header line of %s: %v", approval_file, err)
+	}
+	columns := make(map[string]int)
+	for index, content := range header {
+		content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+		for _, name := range approvalColumnNames {
+			if strings.EqualFold(content, name) {
+				columns[name] = index
+			}
+		}
+	}
+	_, hasUuid := columns["Action_UUID"]
+	_, hasServer := columns["Server_Name"]
+	_, hasId := columns["Component_Id"]
+	_, hasName := columns["Component_Name"]
+	if !hasUuid && !hasServer && !hasId && !hasName {
+		return nil, nil, fmt.Errorf("no Action_UUID, Server_Name, Component_Id or Component_Name column found on the first line of %s", approval_file)
+	}
+
+	var approvals []approval
+	var badLines []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			badLines = append(badLines, err.Error())
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		entry := approval{
+			line:          line,
+			actionUuid:    field("Action_UUID"),
+			serverName:    field("Server_Name"),
+			componentId:   field("Component_Id"),
+			componentName: field("Component_Name"),
+			actionFrom:    field("Action_From"),
+			actionTo:      field("Action_To"),
+			approvedBy:    field("Approved_By"),
+		}
+		if entry.actionUuid == "" && entry.serverName == "" && entry.componentId == "" && entry.componentName == "" {
+			badLines = append(badLines, fmt.Sprintf("line %d: no Action_UUID, Server_Name or Component", line))
+			continue
+		}
+		if entry.actionUuid != "" && (entry.actionFrom == "" || entry.actionTo == "") {
+			badLines = append(badLines, fmt.Sprintf("line %d: Action_UUID %s needs the Action_From and Action_To it was approved with", line, entry.actionUuid))
+			continue
+		}
+		if entry.actionUuid == "" && !allowBlanket && (entry.actionFrom == "" || entry.actionTo == "") {
+			badLines = append(badLines, fmt.Sprintf("line %d: %s%s%s needs the Action_From and Action_To it was approved with (or -allow_blanket_approval)",
+				line, entry.serverName, entry.componentId, entry.componentName))
+			continue
+		}
+		approvals = append(approvals, entry)
+	}
+	return approvals, badLines, nil
+}
+
+// Works out which actions the approvals allow. Actions for server and application approvals come from the action query.
+// Their servers are matched to the actions' servers the way -mode actions matches the mapping: the names are normalized
+// (see normalizeServerNames), Server_Name patterns are expanded and a server the mapping gives a Server_UUID for only
+// gets that server's actions. A name that more than one server has is refused without a UUID, since only an Action_UUID
+// line can say which of them was approved. An action allowed by more than one line is only listed once, for the first line.
+func selectApprovedActions(turbo_instance string, auth string, approvals []approval, mapping appMapping, normalizer *serverNameNormalizer, payload []byte) ([]approvedAction, []string, error) {
+	var selected []approvedAction
+	var problems []string
+	seen := make(map[string]bool)
+	add := func(uuid string, entry approval) {
+		if !seen[uuid] {
+			seen[uuid] = true
+			selected = append(selected, approvedAction{uuid: uuid, approval: entry})
+		}
+	}
+
+	// The servers of each server and application approval, keyed by the approval's index like the mapping's App IDs
+	approvalServers := make(map[string][]string)
+	approvalServerUuids := make(map[string]map[string]string)
+	var appIds []string
+	for appId := range mapping.appId2Name {
+		appIds = append(appIds, appId)
+	}
+	sort.Strings(appIds)
+	for index, entry := range approvals {
+		key := strconv.Itoa(index)
+		switch {
+		case entry.actionUuid != "":
+		case entry.serverName != "":
+			approvalServers[key] = []string{entry.serverName}
+		default:
+			found := false
+			for _, appId := range appIds {
+				appName := mapping.appId2Name[appId]
+				if (entry.componentId != "" && appId == entry.componentId) || (entry.componentId == "" && strings.EqualFold(appName, entry.componentName)) {
+					found = true
+					approvalServers[key] = append(approvalServers[key], mapping.appId2Servers[appId]...)
+					for serverName, serverUuid := range mapping.appServerUuids[appId] {
+						if approvalServerUuids[key] == nil {
+							approvalServerUuids[key] = make(map[string]string)
+						}
+						approvalServerUuids[key][serverName] = serverUuid
+					}
+				}
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("line %d: application %s%s isn't in the mapping", entry.line, entry.componentId, entry.componentName))
+			}
+		}
+	}
+
+	allServerActions := make(map[string][]Action)
+	serverUuids := make(map[string][]string)
+	if len(approvalServers) > 0 {
+		responseActions, err := turboApiGetAll(turbo_instance, auth, "POST", "/markets/Market/actions", payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting actions: %v", err)
+		}
+		for _, responseAction := range responseActions {
+			serverName, serverUuid, action, badAction := parseAction(responseAction)
+			if badAction {
+				continue
+			}
+			allServerActions[serverName] = append(allServerActions[serverName], action)
+			serverUuids[serverName] = append(serverUuids[serverName], serverUuid)
+		}
+	}
+	approvalServers, approvalServerUuids, allServerActions, serverUuids = normalizeServerNames(normalizer, approvalServers, approvalServerUuids, allServerActions, serverUuids)
+	var serverNames []string
+	for serverName := range allServerActions {
+		serverNames = append(serverNames, serverName)
+	}
+	expanded, _, unmatched, err := expandServerPatterns(approvalServers, serverNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Server_Name pattern: %v", err)
+	}
+	duplicateNames := findDuplicateServerNames(serverUuids)
+	uuidActions := getUuidActions(allServerActions)
+
+	for index, entry := range approvals {
+		if entry.actionUuid != "" {
+			add(entry.actionUuid, entry)
+			continue
+		}
+		key := strconv.Itoa(index)
+		for _, pattern := range unmatched[key] {
+			problems = append(problems, fmt.Sprintf("line %d: pattern %s did not match any server with actions", entry.line, pattern))
+		}
+		for _, serverName := range expanded[key] {
+			serverUuid := approvalServerUuids[key][serverName]
+			if serverUuid == "" && len(duplicateNames[serverName]) > 0 {
+				problems = append(problems, fmt.Sprintf("line %d: %d servers are named %s, approve their actions by Action_UUID", entry.line, len(duplicateNames[serverName]), serverName))
+				continue
+			}
+			for _, action := range getServerActions(serverName, serverUuid, allServerActions, uuidActions, duplicateNames) {
+				// From/to on a server or application line narrow it down to those actions
+				if (entry.actionFrom != "" && entry.actionFrom != action.actionFrom) || (entry.actionTo != "" && entry.actionTo != action.actionTo) {
+					continue
+				}
+				add(action.actionUuid, entry)
+			}
+		}
+	}
+	return selected, problems, nil
+}
+
+// Checks each approved action is still as approved, accepts it, waits for the results and writes them all to the audit sink.
+// Each row is written to the sink when it is recorded. If a row can't be written no more actions are accepted and the error
+// is returned. Returns the number of audit rows with each result.
+func executeApprovedActions(turbo_instance string, auth string, selected []approvedAction, options executeOptions, audit rowSink) (map[string]int, error) {
+	counts := make(map[string]int)
+	record := func(item approvedAction, serverName string, action Action, result string, detail string) error {
+		counts[result]++
+		row := map[string]interface{}{
+			"Timestamp":     time.Now().Format(time.RFC3339),
+			"Action_UUID":   item.uuid,
+			"Server_Name":   serverName,
+			"Action_Type":   action.actionType,
+			"Action_From":   action.actionFrom,
+			"Action_To":     action.actionTo,
+			"Approval_Line": float64(item.approval.line),
+			"Approved_By":   item.approval.approvedBy,
+			"Result":        result,
+			"Detail":        detail,
+		}
+		return audit.writeRows("action "+item.uuid, []map[string]interface{}{row})
+	}
+
+	type pending struct {
+		item       approvedAction
+		serverName string
+		action     Action
+	}
+	var accepted []pending
+	for _, item := range selected {
+		responseAction, err := getTurboAction(turbo_instance, auth, item.uuid)
+		if err != nil {
+			if err := record(item, item.approval.serverName, Action{}, resultNotFound, err.Error()); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		serverName, _, action, _ := parseAction(responseAction)
+		state := jsonString(responseAction, "actionState")
+		if state != "READY" {
+			if err := record(item, serverName, action, resultNotReady, "action is "+state); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		if item.approval.serverName != "" && !strings.EqualFold(item.approval.serverName, serverName) {
+			if err := record(item, serverName, action, resultChanged, "approved for server "+item.approval.serverName); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		if (item.approval.actionFrom != "" && item.approval.actionFrom != action.actionFrom) || (item.approval.actionTo != "" && item.approval.actionTo != action.actionTo) {
+			if err := record(item, serverName, action, resultChanged, fmt.Sprintf("approved %s -> %s", item.approval.actionFrom, item.approval.actionTo)); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		if options.dryRun {
+			if err := record(item, serverName, action, resultDryRun, ""); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		if _, _, err := turboApiRequest(turbo_instance, auth, "POST", "/actions/"+item.uuid+"?accept=true", nil); err != nil {
+			if err := record(item, serverName, action, resultAcceptError, err.Error()); err != nil {
+				return counts, err
+			}
+			continue
+		}
+		fmt.Printf("... accepted %s %s on %s (%s -> %s)\n", item.uuid, action.actionType, serverName, action.actionFrom, action.actionTo)
+		if err := record(item, serverName, action, resultAccepted, ""); err != nil {
+			return counts, err
+		}
+		accepted = append(accepted, pending{item, serverName, action})
+	}
+
+	// Poll until every accepted action has finished or the time is up
+	deadline := time.Now().Add(options.timeout)
+	states := make(map[string]string)
+	for len(accepted) > 0 {
+		var still []pending
+		for _, p := range accepted {
+			responseAction, err := getTurboAction(turbo_instance, auth, p.item.uuid)
+			if err != nil {
+				states[p.item.uuid] = err.Error()
+				still = append(still, p)
+				continue
+			}
+			state := jsonString(responseAction, "actionState")
+			states[p.item.uuid] = state
+			var writeErr error
+			switch state {
+			case "SUCCEEDED":
+				writeErr = record(p.item, p.serverName, p.action, resultSucceeded, "")
+			case "FAILED":
+				writeErr = record(p.item, p.serverName, p.action, resultFailed, jsonString(responseAction, "actionExecutionDetails"))
+			default:
+				still = append(still, p)
+			}
+			if writeErr != nil {
+				return counts, writeErr
+			}
+		}
+		accepted = still
+		if len(accepted) == 0 {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			for _, p := range accepted {
+				if err := record(p.item, p.serverName, p.action, resultTimedOut, "last state "+states[p.item.uuid]); err != nil {
+					return counts, err
+				}
+			}
+			break
+		}
+		fmt.Printf("... waiting for %d action(s) to finish ...\n", len(accepted))
+		executeSleep(options.pollInterval)
+	}
+	return counts, nil
+}
+
+func getTurboAction(turbo_instance string, auth string, uuid string) (map[string]interface{}, error) {
+	body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/actions/"+uuid, nil)
+	if err != nil {
+		return nil, err
+	}
+	var responseAction map[string]interface{}
+	if err := json.Unmarshal(body, &responseAction); err != nil {
+		return nil, fmt.Errorf("decoding action %s: %v", uuid, err)
+	}
+	return responseAction, nil
+}
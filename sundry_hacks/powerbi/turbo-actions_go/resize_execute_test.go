@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stands in for the Turbo actions API. Accepted actions go IN_PROGRESS and then to their final state on the next GET.
+type fakeTurboActions struct {
+	mu       sync.Mutex
+	actions  map[string]map[string]interface{}
+	final    map[string]string
+	accepted []string
+}
+
+func (fake *fakeTurboActions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if r.URL.Path == "/vmturbo/rest/markets/Market/actions" {
+		var all []map[string]interface{}
+		for _, action := range fake.actions {
+			all = append(all, action)
+		}
+		data, _ := json.Marshal(all)
+		w.Write(data)
+		return
+	}
+	uuid := strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/actions/")
+	action, ok := fake.actions[uuid]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == "POST" {
+		if r.URL.Query().Get("accept") != "true" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fake.accepted = append(fake.accepted, uuid)
+		action["actionState"] = "ACCEPTED"
+	} else if action["actionState"] == "IN_PROGRESS" {
+		action["actionState"] = fake.final[uuid]
+	} else if action["actionState"] == "ACCEPTED" {
+		action["actionState"] = "IN_PROGRESS"
+	}
+	data, _ := json.Marshal(action)
+	w.Write(data)
+}
+
+func testExecuteAction(t *testing.T, uuid string, server string, state string) map[string]interface{} {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "actions", "onprem_vmem_resize.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var action map[string]interface{}
+	json.Unmarshal(data, &action)
+	action["uuid"] = uuid
+	action["actionState"] = state
+	action["target"].(map[string]interface{})["displayName"] = server
+	action["target"].(map[string]interface{})["uuid"] = "vm-" + uuid
+	return action
+}
+
+func TestExecuteApprovedActions(t *testing.T) {
+	fake := &fakeTurboActions{
+		actions: map[string]map[string]interface{}{
+			"a1": testExecuteAction(t, "a1", "HR-DB-01", "READY"),
+			"a2": testExecuteAction(t, "a2", "HR-DB-01", "QUEUED"),
+			"a3": testExecuteAction(t, "a3", "HR-DB-02", "READY"),
+			"a4": testExecuteAction(t, "a4", "HR-WEB-01", "READY"),
+			"a5": testExecuteAction(t, "a5", "HR-APP-01", "READY"),
+		},
+		final: map[string]string{"a1": "SUCCEEDED", "a4": "FAILED"},
+	}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	turbo_instance := strings.TrimPrefix(server.URL, "https://")
+
+	dir := t.TempDir()
+	approval_file := filepath.Join(dir, "approved.csv")
+	approvals := "Action_UUID,Server_Name,Action_From,Action_To,Approved_By\n" +
+		"a1,,16,20.5,alice\n" +
+		"a2,,16,20.5,alice\n" +
+		"a3,,16,24,bob\n" +
+		",hr-web-01,16,20.5,carol\n" +
+		"a9,,,,dave\n" +
+		",hr-app-01,,,erin\n"
+	if err := ioutil.WriteFile(approval_file, []byte(approvals), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Blanket server approvals (without from/to) are only allowed when asked for
+	if entries, badLines, err := readApprovalCsv(approval_file, true); err != nil || len(entries) != 5 || len(badLines) != 1 {
+		t.Fatalf("with blanket approvals got %d approvals and bad lines %v %v, want 5 and the a9 line", len(entries), badLines, err)
+	}
+	entries, badLines, err := readApprovalCsv(approval_file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || len(badLines) != 2 {
+		t.Fatalf("got %d approvals and bad lines %v, want 4 and the lines without from/to", len(entries), badLines)
+	}
+
+	selected, problems, err := selectApprovedActions(turbo_instance, "", entries, newAppMapping(), newNormalizer(serverNameRules{CaseFold: true}), []byte("{}"))
+	if err != nil || len(problems) > 0 {
+		t.Fatal(err, problems)
+	}
+	var uuids []string
+	for _, item := range selected {
+		uuids = append(uuids, item.uuid)
+	}
+	if strings.Join(uuids, ",") != "a1,a2,a3,a4" {
+		t.Errorf("selected %v, want a1,a2,a3,a4 (a5 isn't approved)", uuids)
+	}
+
+	audit_file := filepath.Join(dir, "audit.csv")
+	audit, err := newRowSink(audit_file, executeAuditColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The accepted actions must already be in the audit log while they are being polled
+	saved := executeSleep
+	polled := false
+	executeSleep = func(time.Duration) {
+		polled = true
+		data, _ := ioutil.ReadFile(audit_file)
+		for _, line := range []string{"a1,HR-DB-01,RESIZE,16,20.5,2,alice,ACCEPTED", "a3,HR-DB-02,RESIZE,16,20.5,4,bob,SKIPPED_CHANGED"} {
+			if !strings.Contains(string(data), line) {
+				t.Errorf("audit log doesn't have %q while polling:\n%s", line, data)
+			}
+		}
+	}
+	defer func() { executeSleep = saved }()
+	counts, err := executeApprovedActions(turbo_instance, "", selected, executeOptions{pollInterval: time.Second, timeout: time.Minute}, audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit.close()
+
+	if !polled {
+		t.Error("never waited for the accepted actions")
+	}
+	want := map[string]int{resultAccepted: 2, resultSucceeded: 1, resultFailed: 1, resultNotReady: 1, resultChanged: 1}
+	for result, count := range want {
+		if counts[result] != count {
+			t.Errorf("%d %s, want %d (counts %v)", counts[result], result, count, counts)
+		}
+	}
+	if strings.Join(fake.accepted, ",") != "a1,a4" {
+		t.Errorf("accepted %v, want a1,a4", fake.accepted)
+	}
+	data, _ := ioutil.ReadFile(audit_file)
+	for _, line := range []string{"a1,HR-DB-01,RESIZE,16,20.5,2,alice,SUCCEEDED", "a3,HR-DB-02,RESIZE,16,20.5,4,bob,SKIPPED_CHANGED", "a4,HR-WEB-01,RESIZE,16,20.5,5,carol,FAILED"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("audit log doesn't have %q:\n%s", line, data)
+		}
+	}
+}
+
+func TestSelectApprovedActionsMatchesServersLikeTheMapping(t *testing.T) {
+	fake := &fakeTurboActions{actions: map[string]map[string]interface{}{
+		// PAY-DB-01 is in two vCenters (testExecuteAction gives each action's server its own UUID)
+		"b1": testExecuteAction(t, "b1", "PAY-DB-01", "READY"),
+		"b2": testExecuteAction(t, "b2", "PAY-DB-01", "READY"),
+		"b3": testExecuteAction(t, "b3", "PAYWEB-PRD-01", "READY"),
+		"b4": testExecuteAction(t, "b4", "PAYWEB-PRD-02", "READY"),
+		"b5": testExecuteAction(t, "b5", "PAYWEB-STG-01", "READY"),
+	}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	turbo_instance := strings.TrimPrefix(server.URL, "https://")
+
+	mapping := newAppMapping()
+	mapping.appId2Name["APP1"] = "Payroll"
+	mapping.appId2Servers["APP1"] = []string{"pay-db-01", "payweb-prd-*"}
+	mapping.appServerUuids["APP1"] = map[string]string{"pay-db-01": "vm-b2"}
+	entries := []approval{
+		{line: 2, componentId: "APP1", actionFrom: "16", actionTo: "20.5"},
+		{line: 3, serverName: "pay-db-01", actionFrom: "16", actionTo: "20.5"},
+		{line: 4, serverName: "payweb-stg-*", actionFrom: "16", actionTo: "20.5"},
+		{line: 5, serverName: "payweb-dev-*", actionFrom: "16", actionTo: "20.5"},
+		{line: 6, actionUuid: "b1", actionFrom: "16", actionTo: "20.5"},
+	}
+
+	selected, problems, err := selectApprovedActions(turbo_instance, "", entries, mapping, newNormalizer(serverNameRules{CaseFold: true}), []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The application only gets the PAY-DB-01 its Server_UUID names and the servers its pattern matches.
+	// The server line for PAY-DB-01 can't say which one it means so only the Action_UUID line gets the other one.
+	var got []string
+	for _, item := range selected {
+		got = append(got, item.uuid+"@"+strconv.Itoa(item.approval.line))
+	}
+	if strings.Join(got, ",") != "b2@2,b3@2,b4@2,b5@4,b1@6" {
+		t.Errorf("selected %v, want b2,b3,b4 for line 2, b5 for line 4 and b1 for line 6", got)
+	}
+	wantProblems := []string{
+		"line 3: 2 servers are named pay-db-01, approve their actions by Action_UUID",
+		"line 5: pattern payweb-dev-* did not match any server with actions",
+	}
+	if strings.Join(problems, "\n") != strings.Join(wantProblems, "\n") {
+		t.Errorf("problems = %q, want %q", problems, wantProblems)
+	}
+}
+
+func TestExecuteDryRunAndTimeout(t *testing.T) {
+	fake := &fakeTurboActions{
+		actions: map[string]map[string]interface{}{"a1": testExecuteAction(t, "a1", "HR-DB-01", "READY")},
+		// Never finishes
+		final: map[string]string{"a1": "IN_PROGRESS"},
+	}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	turbo_instance := strings.TrimPrefix(server.URL, "https://")
+	selected := []approvedAction{{uuid: "a1", approval: approval{line: 2, actionUuid: "a1", actionFrom: "16", actionTo: "20.5"}}}
+
+	audit, err := newRowSink(filepath.Join(t.TempDir(), "audit.csv"), executeAuditColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.close()
+	counts, _ := executeApprovedActions(turbo_instance, "", selected, executeOptions{dryRun: true}, audit)
+	if counts[resultDryRun] != 1 || len(fake.accepted) != 0 {
+		t.Errorf("dry run counts %v, accepted %v", counts, fake.accepted)
+	}
+
+	saved := executeSleep
+	executeSleep = func(time.Duration) {}
+	defer func() { executeSleep = saved }()
+	counts, _ = executeApprovedActions(turbo_instance, "", selected, executeOptions{timeout: 0}, audit)
+	if counts[resultTimedOut] != 1 {
+		t.Errorf("counts %v, want the action to time out", counts)
+	}
+}
+
+// Fails every write after the first few
+type failingSink struct {
+	rows   int
+	failAt int
+}
+
+func (sink *failingSink) writeRows(label string, rows []map[string]interface{}) error {
+	sink.rows += len(rows)
+	if sink.rows > sink.failAt {
+		return errors.New("disk full")
+	}
+	return nil
+}
+
+func (sink *failingSink) close() error { return nil }
+
+func TestExecuteStopsWhenAuditFails(t *testing.T) {
+	fake := &fakeTurboActions{
+		actions: map[string]map[string]interface{}{
+			"a1": testExecuteAction(t, "a1", "HR-DB-01", "READY"),
+			"a2": testExecuteAction(t, "a2", "HR-DB-02", "READY"),
+		},
+		final: map[string]string{"a1": "SUCCEEDED", "a2": "SUCCEEDED"},
+	}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	selected := []approvedAction{
+		{uuid: "a1", approval: approval{line: 2, actionUuid: "a1", actionFrom: "16", actionTo: "20.5"}},
+		{uuid: "a2", approval: approval{line: 3, actionUuid: "a2", actionFrom: "16", actionTo: "20.5"}},
+	}
+
+	_, err := executeApprovedActions(strings.TrimPrefix(server.URL, "https://"), "", selected, executeOptions{timeout: time.Minute}, &failingSink{failAt: 0})
+	if err == nil {
+		t.Fatal("expected the audit error")
+	}
+	if strings.Join(fake.accepted, ",") != "a1" {
+		t.Errorf("accepted %v, want only a1 (its ACCEPTED row couldn't be written)", fake.accepted)
+	}
+}
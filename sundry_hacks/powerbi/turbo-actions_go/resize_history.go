@@ -0,0 +1,184 @@
+package main
+
+/*
+Executed-action history and realized savings (-mode history).
+
+Gets the actions that were executed (SUCCEEDED) or failed in a time window instead of the pending ones, and groups them by
+application with the same mapping as -mode actions (CSV, Business Applications or tags, with the server_names rules and
+Server_Name patterns). Realized savings and investment are those of the actions that succeeded. A failed action realized
+nothing, but its Savings_Per_Month still shows what it would have saved.
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+var historyColumns = []string{"Timestamp", "Component_ID", "Component_Name", "Server_Name", "Action_UUID", "Action_Type", "Action_Details",
+	"Action_From", "Action_To", "Outcome", "Created_Time", "Executed_Time", "Savings_Per_Month", "Realized_Savings_Per_Month", "Realized_Investment_Per_Month"}
+
+// Action states that mean the action is done, one way or the other
+var historyActionStates = []string{"SUCCEEDED", "FAILED"}
+
+// What the actions API says about an action once it has run
+type actionOutcome struct {
+	state string
+	// RFC3339, "" if Turbo didn't give it
+	createTime   string
+	executedTime string
+}
+
+// Returns the start and end (RFC3339) of the last days days
+func historyWindow(now time.Time, days int) (string, string) {
+	return now.AddDate(0, 0, -days).Format(time.RFC3339), now.Format(time.RFC3339)
+}
+
+// Gets the executed and failed actions. Returns the actions and server UUIDs by server name as getAllActions does,
+// the outcome of each action by action UUID and the number of actions with missing data.
+func getActionHistory(turbo_instance string, auth string, payload []byte) (map[string][]Action, map[string][]string, map[string]actionOutcome, int, error) {
+	responseActions, err := turboApiGetAll(turbo_instance, auth, "POST", "/markets/Market/actions", payload)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("getting actions: %v", err)
+	}
+
+	allServerActions := make(map[string][]Action)
+	serverUuids := make(map[string][]string)
+	outcomes := make(map[string]actionOutcome)
+	badActions := 0
+	for _, responseAction := range responseActions {
+		serverName, serverUuid, action, badAction := parseAction(responseAction)
+		if badAction {
+			badActions++
+		}
+		allServerActions[serverName] = append(allServerActions[serverName], action)
+		serverUuids[serverName] = append(serverUuids[serverName], serverUuid)
+
+		outcome := actionOutcome{
+			state:        jsonString(responseAction, "actionState"),
+			createTime:   turboTime(responseAction["createTime"]),
+			executedTime: turboTime(responseAction["updateTime"]),
+		}
+		if outcome.executedTime == "" {
+			outcome.executedTime = outcome.createTime
+		}
+		outcomes[action.actionUuid] = outcome
+	}
+	return allServerActions, serverUuids, outcomes, badActions, nil
+}
+
+// Turns a time from the actions API (RFC3339 text or milliseconds since the epoch) into RFC3339, or "" if it isn't either
+func turboTime(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	case float64:
+		return time.UnixMilli(int64(value)).UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// Writes a row for each executed or failed action on each application's servers and prints the outcomes and realized
+// savings per application. The mapping and actions are as they are for pushPowerBiData.
+func pushHistoryData(appId2Name map[string]string, appId2Servers map[string][]string, appServerUuids map[string]map[string]string, allServerActions map[string][]Action, outcomes map[string]actionOutcome, duplicateNames map[string][]string, destination string) error {
+	sink, err := newRowSink(destination, historyColumns)
+	if err != nil {
+		return err
+	}
+
+	timeString := time.Now().Format(time.RFC3339)
+	uuidActions := getUuidActions(allServerActions)
+
+	var appIds []string
+	for appId := range appId2Name {
+		appIds = append(appIds, appId)
+	}
+	sort.Strings(appIds)
+
+	// App ID -> counts by outcome and realized $ per month
+	appOutcomes := make(map[string]map[string]int)
+	appSavings := make(map[string]float64)
+	appInvestment := make(map[string]float64)
+	for _, appId := range appIds {
+		appName := appId2Name[appId]
+		appOutcomes[appId] = make(map[string]int)
+		var rows []map[string]interface{}
+		for _, serverName := range appId2Servers[appId] {
+			for _, action := range getServerActions(serverName, appServerUuids[appId][serverName], allServerActions, uuidActions, duplicateNames) {
+				outcome := outcomes[action.actionUuid]
+				appOutcomes[appId][outcome.state]++
+				realizedSavings, realizedInvestment := 0.0, 0.0
+				if outcome.state == "SUCCEEDED" {
+					realizedSavings, realizedInvestment = action.savingsPerMonth, action.investmentPerMonth
+				}
+				appSavings[appId] += realizedSavings
+				appInvestment[appId] += realizedInvestment
+				rows = append(rows, map[string]interface{}{
+					"Timestamp":                     timeString,
+					"Component_ID":                  appId,
+					"Component_Name":                appName,
+					"Server_Name":                   serverName,
+					"Action_UUID":                   action.actionUuid,
+					"Action_Type":                   action.actionType,
+					"Action_Details":                action.actionDetails,
+					"Action_From":                   action.actionFrom,
+					"Action_To":                     action.actionTo,
+					"Outcome":                       outcome.state,
+					"Created_Time":                  optionalTime(outcome.createTime),
+					"Executed_Time":                 optionalTime(outcome.executedTime),
+					"Savings_Per_Month":             math.Round(action.savingsPerMonth*100) / 100,
+					"Realized_Savings_Per_Month":    math.Round(realizedSavings*100) / 100,
+					"Realized_Investment_Per_Month": math.Round(realizedInvestment*100) / 100,
+				})
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if err := sink.writeRows("application "+appName, rows); err != nil {
+			fmt.Println("### ERROR ### " + err.Error())
+		} else {
+			fmt.Printf("... sent %d executed action(s) for application %s (realized savings $%.2f/month)\n", len(rows), appName, appSavings[appId])
+		}
+	}
+
+	printHistorySummary(appIds, appId2Name, appOutcomes, appSavings, appInvestment)
+	return sink.close()
+}
+
+// nil (blank) for a time Turbo didn't give
+func optionalTime(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// Prints the succeeded and failed actions and the realized savings and investment per application, and the totals.
+func printHistorySummary(appIds []string, appId2Name map[string]string, appOutcomes map[string]map[string]int, appSavings map[string]float64, appInvestment map[string]float64) {
+	var totalSucceeded, totalFailed int
+	var totalSavings, totalInvestment float64
+	printed := false
+	for _, appId := range appIds {
+		succeeded, failed := appOutcomes[appId]["SUCCEEDED"], appOutcomes[appId]["FAILED"]
+		if succeeded+failed == 0 {
+			continue
+		}
+		if !printed {
+			fmt.Println("\n*** Executed actions and realized savings per application ($ per month):")
+			fmt.Printf("%-40s %10s %8s %12s %12s\n", "Application", "Succeeded", "Failed", "Savings", "Investment")
+			printed = true
+		}
+		fmt.Printf("%-40s %10d %8d %12.2f %12.2f\n", appId2Name[appId], succeeded, failed, appSavings[appId], appInvestment[appId])
+		totalSucceeded += succeeded
+		totalFailed += failed
+		totalSavings += appSavings[appId]
+		totalInvestment += appInvestment[appId]
+	}
+	if printed {
+		fmt.Printf("%-40s %10d %8d %12.2f %12.2f\n\n", "TOTAL", totalSucceeded, totalFailed, totalSavings, totalInvestment)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHistoryAction(t *testing.T, file string, uuid string, server string, state string, updateTime interface{}) map[string]interface{} {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "actions", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var action map[string]interface{}
+	json.Unmarshal(data, &action)
+	action["uuid"] = uuid
+	action["actionState"] = state
+	action["updateTime"] = updateTime
+	action["target"].(map[string]interface{})["displayName"] = server
+	action["target"].(map[string]interface{})["uuid"] = "vm-" + uuid
+	return action
+}
+
+func TestHistoryReport(t *testing.T) {
+	actions := []map[string]interface{}{
+		testHistoryAction(t, "cloud_scale.json", "a1", "payweb-prd-01", "SUCCEEDED", "2020-09-05T02:00:00Z"),
+		// Epoch milliseconds for 2020-09-06T00:00:00Z
+		testHistoryAction(t, "cloud_scale.json", "a2", "payweb-prd-02", "FAILED", 1599350400000.0),
+		testHistoryAction(t, "onprem_vmem_resize.json", "a3", "HR-DB-01", "SUCCEEDED", nil),
+		testHistoryAction(t, "onprem_vmem_resize.json", "a4", "unmapped-01", "SUCCEEDED", nil),
+	}
+	var request actionQuery
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/markets/Market/actions", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		data, _ := json.Marshal(actions)
+		w.Write(data)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	query := newActionQuery()
+	query.ActionStates = historyActionStates
+	query.StartTime, query.EndTime = historyWindow(time.Date(2020, 9, 8, 12, 0, 0, 0, time.UTC), 30)
+	payload, err := query.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allServerActions, _, outcomes, badActions, err := getActionHistory(strings.TrimPrefix(server.URL, "https://"), "", payload)
+	if err != nil || badActions != 0 {
+		t.Fatal(err, badActions)
+	}
+	if request.StartTime != "2020-08-09T12:00:00Z" || request.EndTime != "2020-09-08T12:00:00Z" || strings.Join(request.ActionStates, ",") != "SUCCEEDED,FAILED" {
+		t.Errorf("asked Turbo for %+v", request)
+	}
+	if outcomes["a2"].executedTime != "2020-09-06T00:00:00Z" || outcomes["a3"].executedTime != "2020-09-04T14:21:37Z" {
+		t.Errorf("outcomes %+v", outcomes)
+	}
+
+	fake, url := startFakePowerBi(t, "history")
+	fake.strict = true
+	appId2Name := map[string]string{"APP1": "Payroll", "APP2": "HR"}
+	appId2Servers := map[string][]string{"APP1": {"payweb-prd-01", "payweb-prd-02"}, "APP2": {"HR-DB-01"}}
+	if err := pushHistoryData(appId2Name, appId2Servers, map[string]map[string]string{}, allServerActions, outcomes, nil, url); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 3)
+	// $0.096/h saved is $70.08/month, but only the action that succeeded realized it
+	fake.assertRowsWhere(t, map[string]interface{}{"Action_UUID": "a1", "Component_Name": "Payroll", "Outcome": "SUCCEEDED", "Executed_Time": "2020-09-05T02:00:00Z", "Savings_Per_Month": 70.08, "Realized_Savings_Per_Month": 70.08}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Action_UUID": "a2", "Outcome": "FAILED", "Savings_Per_Month": 70.08, "Realized_Savings_Per_Month": 0.0}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Action_UUID": "a3", "Component_ID": "APP2", "Action_From": "16", "Action_To": "20.5", "Created_Time": "2020-09-04T14:21:37Z"}, 1)
+}
@@ -0,0 +1,182 @@
+package main
+
+/*
+Reconciliation of the application to server mapping against what Turbo knows and what it has actions for.
+Much like csv_processors/find_missing_items.ps1 does for two CSVs, it lists the servers that fall through the cracks
+when the actions are joined to the mapping:
+- NOT_IN_TURBO: a mapping server Turbo doesn't know at all (checked by UUID if the mapping has one, otherwise by name with /search)
+- NO_ACTIONS: a mapping server Turbo knows but has no actions for
+- NOT_IN_MAPPING: a server with actions that isn't in any application in the mapping
+- DUPLICATE_NAME: a server with actions whose name is in the mapping but is used by more than one server in Turbo, so its actions were not sent
+- LOOKUP_ERROR: a mapping server without actions that couldn't be looked up in Turbo (e.g. a 500 or a permissions error),
+  so it isn't known whether Turbo has it. Only a 404 or a search with no results counts as NOT_IN_TURBO.
+*/
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var reconcileColumns = []string{"Timestamp", "Status", "Component_ID", "Component_Name", "Server_Name", "Server_UUID", "Action_Count"}
+
+// Works out the reconciliation rows and writes them to the given file or Power BI URL.
+// normalizer gives the server_names rules the mapping and action names were normalized with so Turbo's names can be compared the same way.
+func reconcileMapping(turbo_instance string, auth string, normalizer *serverNameNormalizer, appId2Name map[string]string, appId2Servers map[string][]string, appServerUuids map[string]map[string]string, allServerActions map[string][]Action, duplicateNames map[string][]string, destination string) {
+
+	timeString := time.Now().Format(time.RFC3339)
+	uuidActions := getUuidActions(allServerActions)
+
+	var rows []map[string]interface{}
+	// Turbo lookups can be slow so only do them once per server
+	knownServers := make(map[string]string)
+	lookupErrors := make(map[string]error)
+	mappedUuids := make(map[string]bool)
+	mappedNames := make(map[string]bool)
+
+	var appIds []string
+	for appId := range appId2Name {
+		appIds = append(appIds, appId)
+	}
+	sort.Strings(appIds)
+
+	for _, appId := range appIds {
+		for _, serverName := range appId2Servers[appId] {
+			serverUuid := appServerUuids[appId][serverName]
+			if serverUuid != "" {
+				mappedUuids[serverUuid] = true
+			} else {
+				mappedNames[serverName] = true
+			}
+
+			if len(getServerActions(serverName, serverUuid, allServerActions, uuidActions, duplicateNames)) > 0 {
+				continue
+			}
+
+			key := serverUuid
+			if key == "" {
+				key = "name:" + serverName
+			}
+			foundUuid, checked := knownServers[key]
+			lookupErr := lookupErrors[key]
+			if !checked {
+				foundUuid, lookupErr = findTurboServer(turbo_instance, auth, normalizer, serverName, serverUuid)
+				knownServers[key] = foundUuid
+				if lookupErr != nil {
+					fmt.Printf("### ERROR ### looking up %s in Turbo: %v\n", serverName, lookupErr)
+					lookupErrors[key] = lookupErr
+				}
+			}
+
+			status := "NO_ACTIONS"
+			if lookupErr != nil {
+				status = "LOOKUP_ERROR"
+				foundUuid = serverUuid
+			} else if foundUuid == "" {
+				status = "NOT_IN_TURBO"
+			}
+			rows = append(rows, reconcileRow(timeString, status, appId, appId2Name[appId], serverName, foundUuid, 0))
+		}
+	}
+
+	var serverNames []string
+	for serverName := range allServerActions {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+
+	for _, serverName := range serverNames {
+		actionCounts := make(map[string]int)
+		var uuids []string
+		for _, action := range allServerActions[serverName] {
+			if actionCounts[action.serverUuid] == 0 {
+				uuids = append(uuids, action.serverUuid)
+			}
+			actionCounts[action.serverUuid]++
+		}
+		for _, serverUuid := range uuids {
+			if mappedUuids[serverUuid] {
+				continue
+			}
+			status := "NOT_IN_MAPPING"
+			if mappedNames[serverName] {
+				if len(duplicateNames[serverName]) == 0 {
+					continue
+				}
+				status = "DUPLICATE_NAME"
+			}
+			rows = append(rows, reconcileRow(timeString, status, "", "", serverName, serverUuid, actionCounts[serverUuid]))
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row["Status"].(string)]++
+	}
+	fmt.Printf("... %d NOT_IN_TURBO, %d NO_ACTIONS, %d NOT_IN_MAPPING, %d DUPLICATE_NAME, %d LOOKUP_ERROR\n", counts["NOT_IN_TURBO"], counts["NO_ACTIONS"], counts["NOT_IN_MAPPING"], counts["DUPLICATE_NAME"], counts["LOOKUP_ERROR"])
+
+	sink, err := newRowSink(destination, reconcileColumns)
+	if err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+		return
+	}
+	if err := sink.writeRows("reconciliation", rows); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+	if err := sink.close(); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+}
+
+func reconcileRow(timeString string, status string, appId string, appName string, serverName string, serverUuid string, actionCount int) map[string]interface{} {
+	return map[string]interface{}{
+		"Timestamp":      timeString,
+		"Status":         status,
+		"Component_ID":   appId,
+		"Component_Name": appName,
+		"Server_Name":    serverName,
+		"Server_UUID":    serverUuid,
+		"Action_Count":   actionCount,
+	}
+}
+
+// Looks for the server in Turbo, by UUID if there is one, otherwise by name.
+// Returns the server's UUID or "" if Turbo doesn't know it (a 404 for the UUID or no search results).
+// Any other failure is returned as an error since it says nothing about whether Turbo knows the server.
+// If more than one server has the name, the UUIDs are returned comma separated.
+// With normalization rules, serverName is a normalized name so the search is for names containing it and Turbo's names are
+// normalized before comparing. A name a rewrite changed beyond containing it won't be found.
+func findTurboServer(turbo_instance string, auth string, normalizer *serverNameNormalizer, serverName string, serverUuid string) (string, error) {
+	if serverUuid != "" {
+		_, _, err := turboApiRequest(turbo_instance, auth, "GET", "/entities/"+serverUuid, nil)
+		if apiErr, ok := err.(*turboApiError); ok && apiErr.status == http.StatusNotFound {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("looking up %s: %v", serverUuid, err)
+		}
+		return serverUuid, nil
+	}
+
+	query := "^" + regexp.QuoteMeta(serverName) + "$"
+	normalize := strings.TrimSpace
+	if normalizer.active() {
+		query = regexp.QuoteMeta(serverName)
+		normalize = normalizer.normalize
+	}
+	entities, err := turboApiGetAll(turbo_instance, auth, "GET", "/search?q="+url.QueryEscape(query)+"&types=VirtualMachine&types=DatabaseServer&types=Database", nil)
+	if err != nil {
+		return "", fmt.Errorf("searching for %s: %v", serverName, err)
+	}
+	var uuids []string
+	for _, entity := range entities {
+		if strings.EqualFold(normalize(jsonString(entity, "displayName")), serverName) {
+			uuids = append(uuids, jsonString(entity, "uuid"))
+		}
+	}
+	return strings.Join(uuids, ","), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Stands in for the Turbo entity lookups the reconciliation does. status gives the response for an entity UUID (default 404)
+// and a search for a name in failSearches returns a 500.
+func fakeReconcileTurbo(t *testing.T, status map[string]int, entities []map[string]interface{}, failSearches map[string]bool) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/entities/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/entities/")
+		code, ok := status[uuid]
+		if !ok {
+			code = http.StatusNotFound
+		}
+		if code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		w.Write([]byte(`{"uuid": "` + uuid + `"}`))
+	})
+	mux.HandleFunc("/vmturbo/rest/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		for name := range failSearches {
+			if strings.Contains(query, name) {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		re := regexp.MustCompile("(?i)" + query)
+		var found []map[string]interface{}
+		for _, entity := range entities {
+			if re.MatchString(entity["displayName"].(string)) {
+				found = append(found, entity)
+			}
+		}
+		data, _ := json.Marshal(found)
+		w.Write(data)
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestReconcileMapping(t *testing.T) {
+	turbo_instance := fakeReconcileTurbo(t,
+		map[string]int{"uuid-known": http.StatusOK, "uuid-forbidden": http.StatusForbidden},
+		[]map[string]interface{}{{"uuid": "v-idle", "displayName": "hr-idle-01"}, {"uuid": "v-dup1", "displayName": "pay-dup"}, {"uuid": "v-dup2", "displayName": "pay-dup"}},
+		map[string]bool{"hr-flaky-01": true})
+
+	appId2Name := map[string]string{"APP1": "HR", "APP2": "Payroll"}
+	appId2Servers := map[string][]string{
+		"APP1": {"hr-db-01", "hr-idle-01", "hr-gone-01", "hr-flaky-01"},
+		"APP2": {"pay-known", "pay-gone", "pay-forbidden", "pay-dup"},
+	}
+	appServerUuids := map[string]map[string]string{"APP2": {"pay-known": "uuid-known", "pay-gone": "uuid-gone", "pay-forbidden": "uuid-forbidden"}}
+	allServerActions := map[string][]Action{
+		"hr-db-01":    {{actionUuid: "a1", serverUuid: "v-db"}},
+		"pay-dup":     {{actionUuid: "a2", serverUuid: "v-dup1"}, {actionUuid: "a3", serverUuid: "v-dup2"}},
+		"unmapped-01": {{actionUuid: "a4", serverUuid: "v-unmapped"}, {actionUuid: "a5", serverUuid: "v-unmapped"}},
+	}
+	duplicateNames := map[string][]string{"pay-dup": {"v-dup1", "v-dup2"}}
+	normalizer, _ := newServerNameNormalizer(serverNameRules{})
+
+	fake, url := startFakePowerBi(t, "reconcile")
+	fake.strict = true
+	reconcileMapping(turbo_instance, "", normalizer, appId2Name, appId2Servers, appServerUuids, allServerActions, duplicateNames, url)
+
+	fake.assertNoSchemaErrors(t)
+	want := []map[string]interface{}{
+		{"Status": "NO_ACTIONS", "Server_Name": "hr-idle-01", "Server_UUID": "v-idle"},
+		{"Status": "NO_ACTIONS", "Server_Name": "pay-known", "Server_UUID": "uuid-known"},
+		// pay-dup's actions weren't sent since there's no telling which server the mapping means
+		{"Status": "NO_ACTIONS", "Server_Name": "pay-dup", "Server_UUID": "v-dup1,v-dup2"},
+		// Only a 404 or an empty search means Turbo doesn't have the server
+		{"Status": "NOT_IN_TURBO", "Server_Name": "hr-gone-01", "Server_UUID": ""},
+		{"Status": "NOT_IN_TURBO", "Server_Name": "pay-gone", "Server_UUID": ""},
+		// A 403 or a failed search says nothing either way
+		{"Status": "LOOKUP_ERROR", "Server_Name": "pay-forbidden", "Server_UUID": "uuid-forbidden"},
+		{"Status": "LOOKUP_ERROR", "Server_Name": "hr-flaky-01", "Server_UUID": ""},
+		{"Status": "NOT_IN_MAPPING", "Server_Name": "unmapped-01", "Server_UUID": "v-unmapped", "Action_Count": 2.0},
+		{"Status": "DUPLICATE_NAME", "Server_Name": "pay-dup", "Server_UUID": "v-dup1", "Action_Count": 1.0},
+		{"Status": "DUPLICATE_NAME", "Server_Name": "pay-dup", "Server_UUID": "v-dup2", "Action_Count": 1.0},
+	}
+	for _, match := range want {
+		fake.assertRowsWhere(t, match, 1)
+	}
+	fake.assertRowCount(t, len(want))
+}
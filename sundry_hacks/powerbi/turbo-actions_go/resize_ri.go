@@ -0,0 +1,241 @@
+package main
+
+/*
+Reserved Instance report (-mode ri).
+Does what js_console_hacks/Get-RI-Improving-Actions_XL.js and tbutil_scripts/find_RI-util_actions.js do: finds the cloud
+SCALE and BUY_RI actions and works out if each one improves RI coverage of the instance or utilization of the RI.
+
+Coverage (how much of the instance the RI pays for) is taken from the first of these there is:
+- riCoverageBefore and riCoverageAfter (coupons used / coupon capacity) from GET /actions/{uuid}/details, which is fetched
+  for each SCALE action as Get-RI-Improving-Actions_XL.js does. The actions list doesn't have them.
+- the target's cloudAspect riCoveragePercentage (before) and the action's reservedInstance coupons (after).
+
+Utilization (how much of the RI is used) comes from the action's reservedInstance coupons (coupons used / coupons bought)
+with the action. Before the action the instance's coupons (the details' riCoverageAfter value) aren't used yet, so it is
+blank if the details don't have riCoverageAfter. Like find_RI-util_actions.js, an action that uses an RI is utilization-improving if
+there is no before value.
+
+BUY_RI actions always count as RI-improving since buying the RI is what adds the coverage.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var riColumns = []string{"Timestamp", "Server_Name", "Server_UUID", "Account_Name", "Instance_Family", "Action_Type", "Action_From", "Action_To",
+	"RI_Coverage_Before", "RI_Coverage_After", "RI_Utilization_Before", "RI_Utilization_After", "RI_Improving", "Savings_Per_Month", "Investment_Per_Month", "Action_Details", "Reason"}
+
+// Gets the actions for the query, classifies them and writes them to the given file or Power BI URL.
+func riReport(turbo_instance string, auth string, payload []byte, destination string) {
+	actions, err := turboApiGetAll(turbo_instance, auth, "POST", "/markets/Market/actions", payload)
+	if err != nil {
+		fmt.Println("*** Error getting actions from Turbo: " + err.Error())
+		os.Exit(3)
+	}
+
+	timeString := time.Now().Format(time.RFC3339)
+	var rows []map[string]interface{}
+	improving := 0
+	missingDetails := 0
+	// Account -> number of RI-improving actions
+	accountCounts := make(map[string]int)
+	for _, responseAction := range actions {
+		var details map[string]interface{}
+		if jsonString(responseAction, "actionType") == "SCALE" {
+			details, err = getActionDetails(turbo_instance, auth, jsonString(responseAction, "uuid"))
+			if err != nil {
+				fmt.Println("### Couldn't get the details of action " + jsonString(responseAction, "uuid") + ": " + err.Error())
+				missingDetails++
+			}
+		}
+		row := riActionRow(timeString, responseAction, details)
+		rows = append(rows, row)
+		if row["RI_Improving"] == true {
+			improving++
+			accountCounts[row["Account_Name"].(string)]++
+		}
+	}
+
+	if missingDetails > 0 {
+		fmt.Printf("### %d action(s) without details use the entity's RI coverage, if it has one\n", missingDetails)
+	}
+	fmt.Printf("... %d of %d action(s) improve RI coverage or utilization\n", improving, len(rows))
+	var accounts []string
+	for account := range accountCounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		fmt.Printf("...    %s: %d\n", account, accountCounts[account])
+	}
+
+	sink, err := newRowSink(destination, riColumns)
+	if err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+		return
+	}
+	if err := sink.writeRows("RI actions", rows); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+	if err := sink.close(); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+}
+
+// Gets GET /actions/{uuid}/details, which has the RI coverage before and after a cloud SCALE action.
+func getActionDetails(turbo_instance string, auth string, actionUuid string) (map[string]interface{}, error) {
+	body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/actions/"+actionUuid+"/details", nil)
+	if err != nil {
+		return nil, err
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(body, &details); err != nil {
+		return nil, fmt.Errorf("decoding details of action %s: %v", actionUuid, err)
+	}
+	return details, nil
+}
+
+// Builds the report row for an action. details is from getActionDetails, nil if there aren't any.
+// Coverage and utilization values are nil when the action doesn't have them.
+func riActionRow(timeString string, responseAction map[string]interface{}, details map[string]interface{}) map[string]interface{} {
+	target, _ := responseAction["target"].(map[string]interface{})
+	risk, _ := responseAction["risk"].(map[string]interface{})
+	currentEntity, _ := responseAction["currentEntity"].(map[string]interface{})
+	newEntity, _ := responseAction["newEntity"].(map[string]interface{})
+	template, _ := responseAction["template"].(map[string]interface{})
+	actionType := jsonString(responseAction, "actionType")
+
+	actionFrom := jsonString(currentEntity, "displayName")
+	actionTo := jsonString(newEntity, "displayName")
+	if actionTo == "" {
+		actionTo = jsonString(template, "displayName")
+	}
+
+	var before, after interface{}
+	if coverage, ok := riCoverage(details, "riCoverageBefore"); ok {
+		before = coverage
+	} else if coverage, ok := aspectRiCoverage(target); ok {
+		before = coverage
+	}
+	if coverage, ok := riCoverage(details, "riCoverageAfter"); ok {
+		after = coverage
+	} else if reservedInstance, ok := responseAction["reservedInstance"].(map[string]interface{}); ok {
+		if coverage, ok := riCoverage(reservedInstance, "coupons"); ok {
+			after = coverage
+		}
+	}
+
+	utilizationBefore, utilizationAfter := riUtilization(responseAction, details)
+
+	improving := actionType == "BUY_RI"
+	if (before != nil) && (after != nil) {
+		improving = improving || (after.(float64) > before.(float64))
+	}
+	if utilizationAfter != nil {
+		improving = improving || (utilizationBefore == nil && utilizationAfter.(float64) > 0) ||
+			(utilizationBefore != nil && utilizationAfter.(float64) > utilizationBefore.(float64))
+	}
+
+	savings, investment := parseActionCosts(responseAction)
+	return map[string]interface{}{
+		"Timestamp":             timeString,
+		"Server_Name":           jsonString(target, "displayName"),
+		"Server_UUID":           jsonString(target, "uuid"),
+		"Account_Name":          actionAccount(responseAction, target),
+		"Instance_Family":       instanceFamily(actionTo),
+		"Action_Type":           actionType,
+		"Action_From":           actionFrom,
+		"Action_To":             actionTo,
+		"RI_Coverage_Before":    before,
+		"RI_Coverage_After":     after,
+		"RI_Utilization_Before": utilizationBefore,
+		"RI_Utilization_After":  utilizationAfter,
+		"RI_Improving":          improving,
+		"Savings_Per_Month":     math.Round(savings*100) / 100,
+		"Investment_Per_Month":  math.Round(investment*100) / 100,
+		"Action_Details":        jsonString(responseAction, "details"),
+		"Reason":                jsonString(risk, "description"),
+	}
+}
+
+// Coverage percentage from a stat with a value (coupons used) and a capacity (coupons available), rounded like the JS scripts do.
+func riCoverage(object map[string]interface{}, field string) (float64, bool) {
+	stat, ok := object[field].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	value, ok := stat["value"].(float64)
+	if !ok {
+		return 0, false
+	}
+	capacity, _ := stat["capacity"].(map[string]interface{})
+	capacityAvg, _ := capacity["avg"].(float64)
+	if capacityAvg == 0 {
+		return 0, true
+	}
+	return math.Round((value / capacityAvg) * 100), true
+}
+
+// Utilization percentage of the RI the action uses, before and after the action. nil when the action doesn't have it.
+func riUtilization(responseAction map[string]interface{}, details map[string]interface{}) (interface{}, interface{}) {
+	reservedInstance, _ := responseAction["reservedInstance"].(map[string]interface{})
+	coupons, _ := reservedInstance["coupons"].(map[string]interface{})
+	used, ok := coupons["value"].(float64)
+	if !ok {
+		return nil, nil
+	}
+	capacity, _ := coupons["capacity"].(map[string]interface{})
+	capacityAvg, _ := capacity["avg"].(float64)
+	if capacityAvg == 0 {
+		return nil, nil
+	}
+	after := math.Round((used / capacityAvg) * 100)
+
+	// The coupons the instance will use from the RI
+	coverageAfter, _ := details["riCoverageAfter"].(map[string]interface{})
+	instanceCoupons, ok := coverageAfter["value"].(float64)
+	if !ok {
+		return nil, after
+	}
+	return math.Round((math.Max(used-instanceCoupons, 0) / capacityAvg) * 100), after
+}
+
+func aspectRiCoverage(target map[string]interface{}) (float64, bool) {
+	aspects, _ := target["aspects"].(map[string]interface{})
+	cloudAspect, _ := aspects["cloudAspect"].(map[string]interface{})
+	coverage, ok := cloudAspect["riCoveragePercentage"].(float64)
+	return math.Round(coverage), ok
+}
+
+// The cloud account the action is in: where the instance currently is, otherwise where the target was discovered.
+func actionAccount(responseAction map[string]interface{}, target map[string]interface{}) string {
+	for _, location := range []interface{}{responseAction["currentLocation"], target} {
+		locationObject, _ := location.(map[string]interface{})
+		discoveredBy, _ := locationObject["discoveredBy"].(map[string]interface{})
+		if account := jsonString(discoveredBy, "displayName"); account != "" {
+			return account
+		}
+	}
+	return "UNKNOWN"
+}
+
+var azureSizePattern = regexp.MustCompile(`^(Standard_[A-Za-z]+)\d+(-\d+)?([a-z]*)(_.*)?$`)
+
+// Works out the instance family from an instance type, e.g. m5.large -> m5, Standard_D4s_v3 -> Standard_Ds_v3.
+// Anything else is returned as is.
+func instanceFamily(instanceType string) string {
+	if dot := strings.Index(instanceType, "."); dot > 0 {
+		return instanceType[:dot]
+	}
+	if match := azureSizePattern.FindStringSubmatch(instanceType); match != nil {
+		return match[1] + match[3] + match[4]
+	}
+	return instanceType
+}
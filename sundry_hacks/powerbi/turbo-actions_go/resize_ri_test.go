@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadRiAction(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ri", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var responseAction map[string]interface{}
+	if err := json.Unmarshal(data, &responseAction); err != nil {
+		t.Fatal(err)
+	}
+	return responseAction
+}
+
+// The recorded GET /actions/{uuid}/details response for an action, or nil if there isn't one
+func loadRiDetails(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ri", "details", name+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(data, &details); err != nil {
+		t.Fatal(err)
+	}
+	return details
+}
+
+var riActionNames = []string{"scale_aspect_coupons", "scale_details_coverage_down", "buy_ri", "scale_no_ri_data", "scale_ri_utilization_up", "scale_ri_off_ri"}
+
+// Stands in for the Turbo actions list and the action details with the actions in testdata/ri.
+// Records the actions whose details were asked for.
+func startFakeTurboRi(t *testing.T) (string, *[]string) {
+	t.Helper()
+	var actions []map[string]interface{}
+	details := make(map[string][]byte)
+	for _, name := range riActionNames {
+		responseAction := loadRiAction(t, name)
+		actions = append(actions, responseAction)
+		if data, err := ioutil.ReadFile(filepath.Join("testdata", "ri", "details", name+".json")); err == nil {
+			details[jsonString(responseAction, "uuid")] = data
+		}
+	}
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/markets/Market/actions", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(actions)
+		w.Write(data)
+	})
+	mux.HandleFunc("/vmturbo/rest/actions/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/actions/"), "/details")
+		requested = append(requested, uuid)
+		data, ok := details[uuid]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+	return startFakeTurbo(t, mux), &requested
+}
+
+func TestRiActionRow(t *testing.T) {
+	cases := []struct {
+		name              string
+		improving         bool
+		before            interface{}
+		after             interface{}
+		utilizationBefore interface{}
+		utilizationAfter  interface{}
+		account           string
+		family            string
+		savings           float64
+	}{
+		{"scale_aspect_coupons", true, 0.0, 100.0, nil, 100.0, "AWS-Billing", "m5", 70.08},
+		{"scale_details_coverage_down", false, 100.0, 25.0, nil, nil, "Azure-Prod", "Standard_Es_v3", 0},
+		{"buy_ri", true, nil, nil, nil, nil, "AWS-Prod", "m5", 14.6},
+		{"scale_no_ri_data", false, nil, nil, nil, nil, "AWS-Dev", "t3", 0},
+		// Coverage stays at 100% but the instance fills the other half of the RI
+		{"scale_ri_utilization_up", true, 100.0, 100.0, 50.0, 100.0, "AWS-Prod", "m5", 140.16},
+		// Moves off the RI, which stays half used
+		{"scale_ri_off_ri", false, 100.0, 0.0, 50.0, 50.0, "AWS-Prod", "m5", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			row := riActionRow("2020-09-08T12:00:00Z", loadRiAction(t, c.name), loadRiDetails(t, c.name))
+			if row["RI_Improving"] != c.improving {
+				t.Errorf("RI_Improving = %v, want %v", row["RI_Improving"], c.improving)
+			}
+			if row["RI_Coverage_Before"] != c.before || row["RI_Coverage_After"] != c.after {
+				t.Errorf("coverage = %v -> %v, want %v -> %v", row["RI_Coverage_Before"], row["RI_Coverage_After"], c.before, c.after)
+			}
+			if row["RI_Utilization_Before"] != c.utilizationBefore || row["RI_Utilization_After"] != c.utilizationAfter {
+				t.Errorf("utilization = %v -> %v, want %v -> %v", row["RI_Utilization_Before"], row["RI_Utilization_After"], c.utilizationBefore, c.utilizationAfter)
+			}
+			if row["Account_Name"] != c.account {
+				t.Errorf("Account_Name = %v, want %v", row["Account_Name"], c.account)
+			}
+			if row["Instance_Family"] != c.family {
+				t.Errorf("Instance_Family = %v, want %v", row["Instance_Family"], c.family)
+			}
+			if row["Savings_Per_Month"] != c.savings {
+				t.Errorf("Savings_Per_Month = %v, want %v", row["Savings_Per_Month"], c.savings)
+			}
+		})
+	}
+}
+
+func TestRiReport(t *testing.T) {
+	turbo_instance, requested := startFakeTurboRi(t)
+	fake, url := startFakePowerBi(t, "ri")
+	fake.strict = true
+
+	riReport(turbo_instance, "", []byte(`{}`), url)
+
+	// The details are only fetched for the SCALE actions. scale_no_ri_data has none and is still reported.
+	want := []string{"637145236490001", "637145236490002", "637145236490004", "637145236490005", "637145236490006"}
+	if !reflect.DeepEqual(*requested, want) {
+		t.Errorf("details requested for %v, want %v", *requested, want)
+	}
+	fake.assertNoSchemaErrors(t)
+	fake.assertRowCount(t, 6)
+	fake.assertRowsWhere(t, map[string]interface{}{"RI_Improving": true}, 3)
+	// Coverage from the details
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "crm-db-01", "RI_Coverage_Before": 100.0, "RI_Coverage_After": 25.0}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "hr-app-01", "RI_Utilization_Before": 50.0, "RI_Utilization_After": 100.0}, 1)
+	// Details without coverage fall back to the aspect and coupons
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "billing-01", "RI_Coverage_Before": 0.0, "RI_Coverage_After": 100.0}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Server_Name": "web-01", "RI_Coverage_Before": nil, "RI_Coverage_After": nil}, 1)
+}
@@ -0,0 +1,355 @@
+package main
+
+/*
+Utilization report (-mode stats).
+Does what js_console_hacks/Find_High_RdyQ_VMs.js does, for any commodity: gets each entity's stats over the last few days,
+works out the utilization (value / capacity) of each snapshot, reduces them to one number (max, avg or a percentile) and
+reports the entities over the threshold.
+
+The entities are the members of -stats_group (with any groups in it expanded), or else the servers in the application mapping.
+The stats are set in the "stats" section of the -config file, e.g.
+  "stats": {"days": 7, "stats": [{"name": "ReadyQueue", "measure": "max", "threshold": 4},
+                                 {"name": "VCPU", "measure": "p95", "threshold": 90}]}
+
+ReadyQueue is the VM's CPU ready queue. Turbo has a commodity per queue size (Q1VCPU, Q2VCPU, ...) so the one for the
+VM's number of vCPUs is used, and its utilization is divided by the number of vCPUs as the console hack does.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var statsColumns = []string{"Timestamp", "Entity_Name", "Entity_UUID", "Entity_Type", "Component_Name", "Stat_Name", "Measure", "Value", "Threshold", "Days"}
+
+type statsConfig struct {
+	// Days of history to look at, default 7
+	Days  int        `json:"days"`
+	Stats []statRule `json:"stats"`
+}
+
+type statRule struct {
+	// Turbo commodity (e.g. VCPU, VMem) or ReadyQueue
+	Name string `json:"name"`
+	// max (default), avg or pNN for a percentile, e.g. p95
+	Measure string `json:"measure"`
+	// Entities whose measured utilization (percent) is over this are reported
+	Threshold float64 `json:"threshold"`
+}
+
+// Used if the config file doesn't give any stats
+var defaultStatRules = []statRule{
+	{Name: "ReadyQueue", Measure: "max", Threshold: 4},
+	{Name: "VCPU", Measure: "p95", Threshold: 90},
+	{Name: "VMem", Measure: "p95", Threshold: 90},
+}
+
+type statsEntity struct {
+	uuid      string
+	name      string
+	className string
+	// Applications the entity is mapped to, if it came from the mapping
+	apps []string
+}
+
+// Checks the config and fills in the defaults.
+func (config statsConfig) normalized() (statsConfig, error) {
+	if config.Days == 0 {
+		config.Days = 7
+	}
+	if config.Days < 0 {
+		return config, fmt.Errorf("days must be positive")
+	}
+	if len(config.Stats) == 0 {
+		config.Stats = defaultStatRules
+	}
+	var rules []statRule
+	for _, rule := range config.Stats {
+		if rule.Name == "" {
+			return config, fmt.Errorf("stat without a name")
+		}
+		if rule.Measure == "" {
+			rule.Measure = "max"
+		}
+		if _, err := measureUtilization([]float64{0}, rule.Measure); err != nil {
+			return config, fmt.Errorf("stat %s: %v", rule.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	config.Stats = rules
+	return config, nil
+}
+
+// Reduces the utilizations to one number: max, avg or pNN (nearest rank percentile).
+func measureUtilization(utilizations []float64, measure string) (float64, error) {
+	if len(utilizations) == 0 {
+		return 0, fmt.Errorf("no values")
+	}
+	switch measure {
+	case "max":
+		highest := utilizations[0]
+		for _, utilization := range utilizations {
+			highest = math.Max(highest, utilization)
+		}
+		return highest, nil
+	case "avg":
+		total := 0.0
+		for _, utilization := range utilizations {
+			total += utilization
+		}
+		return total / float64(len(utilizations)), nil
+	}
+	if !strings.HasPrefix(measure, "p") {
+		return 0, fmt.Errorf("unknown measure %s (use max, avg or pNN)", measure)
+	}
+	percentile, err := strconv.ParseFloat(measure[1:], 64)
+	if err != nil || percentile <= 0 || percentile > 100 {
+		return 0, fmt.Errorf("unknown measure %s (use max, avg or pNN)", measure)
+	}
+	sorted := append([]float64(nil), utilizations...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	return sorted[rank-1], nil
+}
+
+// Utilization (percent) of the stat in each snapshot. Snapshots without the stat are skipped.
+// A stat without a capacity is taken to be a percentage already.
+func snapshotUtilizations(snapshots []map[string]interface{}, statName string) []float64 {
+	var utilizations []float64
+	for _, snapshot := range snapshots {
+		statistics, _ := snapshot["statistics"].([]interface{})
+		for _, item := range statistics {
+			stat, ok := item.(map[string]interface{})
+			if !ok || jsonString(stat, "name") != statName {
+				continue
+			}
+			value := statValue(stat)
+			if value < 0 {
+				continue
+			}
+			capacity := statNumber(stat, "capacity", "avg")
+			if capacity > 0 {
+				value = value / capacity * 100
+			}
+			utilizations = append(utilizations, value)
+		}
+	}
+	return utilizations
+}
+
+func getEntityStats(turbo_instance string, auth string, uuid string, statName string, start time.Time, end time.Time) ([]map[string]interface{}, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"statistics": []map[string]string{{"name": statName}},
+		"startDate":  start.UnixNano() / int64(time.Millisecond),
+		"endDate":    end.UnixNano() / int64(time.Millisecond),
+	})
+	return turboApiGetAll(turbo_instance, auth, "POST", "/stats/"+uuid, body)
+}
+
+// Number of vCPUs of the VM, or 0 if Turbo doesn't say
+func getVmCpuCount(turbo_instance string, auth string, uuid string) (int, error) {
+	body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/entities/"+uuid+"/aspects/virtualMachineAspect", nil)
+	if err != nil {
+		return 0, err
+	}
+	var aspect struct {
+		NumVCPUs int `json:"numVCPUs"`
+	}
+	if err := json.Unmarshal(body, &aspect); err != nil {
+		return 0, fmt.Errorf("decoding VM aspect: %v", err)
+	}
+	return aspect.NumVCPUs, nil
+}
+
+// Measures the stat for the entity. Returns false if the entity doesn't have the stat.
+func measureEntityStat(turbo_instance string, auth string, entity statsEntity, rule statRule, start time.Time, end time.Time) (float64, bool, error) {
+	statName := rule.Name
+	divisor := 1.0
+	if rule.Name == "ReadyQueue" {
+		if entity.className != "VirtualMachine" {
+			return 0, false, nil
+		}
+		cpus, err := getVmCpuCount(turbo_instance, auth, entity.uuid)
+		if err != nil || cpus == 0 {
+			return 0, false, err
+		}
+		statName = "Q" + strconv.Itoa(cpus) + "VCPU"
+		divisor = float64(cpus)
+	}
+
+	snapshots, err := getEntityStats(turbo_instance, auth, entity.uuid, statName, start, end)
+	if err != nil {
+		return 0, false, err
+	}
+	utilizations := snapshotUtilizations(snapshots, statName)
+	if len(utilizations) == 0 {
+		return 0, false, nil
+	}
+	measured, err := measureUtilization(utilizations, rule.Measure)
+	if err != nil {
+		return 0, false, err
+	}
+	return math.Round(measured/divisor*100) / 100, true, nil
+}
+
+// Measures each stat for each entity and writes the entities over the thresholds to the given file or Power BI URL.
+func statsReport(turbo_instance string, auth string, entities []statsEntity, config statsConfig, destination string) {
+	config, err := config.normalized()
+	if err != nil {
+		fmt.Println("*** Error in stats config: " + err.Error())
+		os.Exit(5)
+	}
+
+	end := time.Now()
+	start := end.Add(-time.Duration(config.Days) * 24 * time.Hour)
+	timeString := end.Format(time.RFC3339)
+
+	var rows []map[string]interface{}
+	for _, entity := range entities {
+		for _, rule := range config.Stats {
+			measured, found, err := measureEntityStat(turbo_instance, auth, entity, rule, start, end)
+			if err != nil {
+				fmt.Printf("### ERROR ### getting %s for %s: %v\n", rule.Name, entity.name, err)
+				continue
+			}
+			if !found || measured <= rule.Threshold {
+				continue
+			}
+			rows = append(rows, map[string]interface{}{
+				"Timestamp":      timeString,
+				"Entity_Name":    entity.name,
+				"Entity_UUID":    entity.uuid,
+				"Entity_Type":    entity.className,
+				"Component_Name": strings.Join(entity.apps, "; "),
+				"Stat_Name":      rule.Name,
+				"Measure":        rule.Measure,
+				"Value":          measured,
+				"Threshold":      rule.Threshold,
+				"Days":           float64(config.Days),
+			})
+		}
+	}
+	fmt.Printf("... %d of %d entities have stats over the thresholds (%d rows)\n", countEntities(rows), len(entities), len(rows))
+
+	sink, err := newRowSink(destination, statsColumns)
+	if err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+		return
+	}
+	if err := sink.writeRows("stats", rows); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+	if err := sink.close(); err != nil {
+		fmt.Println("### ERROR ### " + err.Error())
+	}
+}
+
+func countEntities(rows []map[string]interface{}) int {
+	uuids := make(map[string]bool)
+	for _, row := range rows {
+		uuids[row["Entity_UUID"].(string)] = true
+	}
+	return len(uuids)
+}
+
+// Group classes whose members are checked instead of the group itself
+var statsGroupClasses = map[string]bool{"Group": true, "Cluster": true, "StorageCluster": true, "VirtualMachineCluster": true, "ResourceGroup": true, "BillingFamily": true}
+
+// The members of the group given by UUID or exact name (see resolveGroup). Groups in the group, e.g. the clusters in
+// a group of clusters, are expanded into their members. An entity found more than once is only returned once.
+func getStatsGroupEntities(turbo_instance string, auth string, group string) ([]statsEntity, error) {
+	found, err := resolveGroup(turbo_instance, auth, group, "exact")
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []statsEntity
+	// Entity and group UUIDs already seen, so a group that contains itself doesn't loop
+	seen := make(map[string]bool)
+	var expand func(groupUuid string, groupName string) error
+	expand = func(groupUuid string, groupName string) error {
+		seen[groupUuid] = true
+		members, err := turboApiGetAll(turbo_instance, auth, "GET", "/groups/"+groupUuid+"/members", nil)
+		if err != nil {
+			return fmt.Errorf("getting members of group %s: %v", groupName, err)
+		}
+		for _, member := range members {
+			uuid := jsonString(member, "uuid")
+			if uuid == "" || seen[uuid] {
+				continue
+			}
+			if statsGroupClasses[jsonString(member, "className")] {
+				if err := expand(uuid, jsonString(member, "displayName")); err != nil {
+					return err
+				}
+				continue
+			}
+			seen[uuid] = true
+			entities = append(entities, statsEntity{uuid: uuid, name: jsonString(member, "displayName"), className: jsonString(member, "className")})
+		}
+		return nil
+	}
+	if err := expand(found.uuid, found.name); err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// The servers in the application mapping. Servers are found in Turbo by their Server_UUID if they have one, otherwise by name.
+// Server_Name patterns aren't supported here and are skipped.
+func getMappingEntities(turbo_instance string, auth string, appId2Name map[string]string, appId2Servers map[string][]string, appServerUuids map[string]map[string]string) ([]statsEntity, []string, error) {
+	var appIds []string
+	for appId := range appId2Servers {
+		appIds = append(appIds, appId)
+	}
+	sort.Strings(appIds)
+
+	var entities []statsEntity
+	var skipped []string
+	// Entity UUID -> index in entities, so a server in several applications is only measured once
+	found := make(map[string]int)
+	for _, appId := range appIds {
+		for _, serverName := range appId2Servers[appId] {
+			if isServerPattern(serverName) {
+				skipped = append(skipped, serverName+" (pattern)")
+				continue
+			}
+			var matches []map[string]interface{}
+			if serverUuid := appServerUuids[appId][serverName]; serverUuid != "" {
+				body, _, err := turboApiRequest(turbo_instance, auth, "GET", "/entities/"+serverUuid, nil)
+				if err == nil {
+					var entity map[string]interface{}
+					if err := json.Unmarshal(body, &entity); err == nil {
+						matches = append(matches, entity)
+					}
+				} else if _, ok := err.(*turboApiError); !ok {
+					return nil, nil, err
+				}
+			} else {
+				var err error
+				matches, err = turboSearchByName(turbo_instance, auth, "VirtualMachine", "vmsByName", serverName, false)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			if len(matches) != 1 {
+				skipped = append(skipped, fmt.Sprintf("%s (%d matches in Turbo)", serverName, len(matches)))
+				continue
+			}
+			uuid := jsonString(matches[0], "uuid")
+			if index, ok := found[uuid]; ok {
+				entities[index].apps = appendUnique(entities[index].apps, appId2Name[appId])
+				continue
+			}
+			found[uuid] = len(entities)
+			entities = append(entities, statsEntity{uuid: uuid, name: jsonString(matches[0], "displayName"), className: jsonString(matches[0], "className"), apps: []string{appId2Name[appId]}})
+		}
+	}
+	return entities, skipped, nil
+}
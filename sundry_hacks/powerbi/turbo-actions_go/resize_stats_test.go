@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMeasureUtilization(t *testing.T) {
+	utilizations := []float64{10, 50, 20, 90, 30, 40, 60, 70, 80, 100}
+	cases := map[string]float64{"max": 100, "avg": 55, "p50": 50, "p95": 100, "p90": 90, "p10": 10}
+	for measure, want := range cases {
+		got, err := measureUtilization(utilizations, measure)
+		if err != nil || got != want {
+			t.Errorf("%s = %v %v, want %v", measure, got, err, want)
+		}
+	}
+	for _, measure := range []string{"median", "p0", "p101", "px"} {
+		if _, err := measureUtilization(utilizations, measure); err == nil {
+			t.Errorf("expected an error for measure %s", measure)
+		}
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	// Stats by entity UUID and stat name: the value of each snapshot against a capacity of 100
+	stats := map[string]map[string][]float64{
+		"v1": {"Q2VCPU": {4, 12, 6}, "VCPU": {50, 95, 60}},
+		"v2": {"Q4VCPU": {8, 8, 8}, "VCPU": {10, 20, 30}},
+	}
+	cpus := map[string]int{"v1": 2, "v2": 4}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vmturbo/rest/stats/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/stats/")
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			Statistics []struct{ Name string } `json:"statistics"`
+		}
+		json.Unmarshal(body, &request)
+		name := request.Statistics[0].Name
+		var snapshots []map[string]interface{}
+		for _, value := range stats[uuid][name] {
+			snapshots = append(snapshots, map[string]interface{}{"statistics": []map[string]interface{}{
+				{"name": name, "value": value, "capacity": map[string]interface{}{"avg": 100}},
+			}})
+		}
+		data, _ := json.Marshal(snapshots)
+		w.Write(data)
+	})
+	mux.HandleFunc("/vmturbo/rest/entities/", func(w http.ResponseWriter, r *http.Request) {
+		uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/vmturbo/rest/entities/"), "/aspects/virtualMachineAspect")
+		data, _ := json.Marshal(map[string]interface{}{"numVCPUs": cpus[uuid]})
+		w.Write(data)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	fake, url := startFakePowerBi(t, "stats")
+	fake.strict = true
+	entities := []statsEntity{
+		{uuid: "v1", name: "payroll-db01", className: "VirtualMachine", apps: []string{"Payroll", "HR"}},
+		{uuid: "v2", name: "hr-web01", className: "VirtualMachine", apps: []string{"HR"}},
+		{uuid: "s1", name: "datastore1", className: "Storage"},
+	}
+	config := statsConfig{Stats: []statRule{{Name: "ReadyQueue", Threshold: 4}, {Name: "VCPU", Measure: "p50", Threshold: 55}}}
+	statsReport(strings.TrimPrefix(server.URL, "https://"), "", entities, config, url)
+
+	fake.assertNoSchemaErrors(t)
+	// v1's ready queue is 12% / 2 vCPUs = 6, v2's is 8% / 4 = 2. v1's median VCPU is 60.
+	fake.assertRowCount(t, 2)
+	fake.assertRowsWhere(t, map[string]interface{}{"Entity_UUID": "v1", "Stat_Name": "ReadyQueue", "Measure": "max", "Value": 6.0, "Component_Name": "Payroll; HR", "Days": 7.0}, 1)
+	fake.assertRowsWhere(t, map[string]interface{}{"Entity_UUID": "v1", "Stat_Name": "VCPU", "Value": 60.0}, 1)
+}
+
+func TestGetStatsGroupEntitiesExpandsGroups(t *testing.T) {
+	groups := []map[string]interface{}{
+		{"uuid": "284551234567010", "displayName": "Payroll Servers", "className": "Group", "members": []map[string]interface{}{
+			{"uuid": "v1", "displayName": "payroll-db01", "className": "VirtualMachine"},
+			{"uuid": "284551234567011", "displayName": "Payroll Web", "className": "Group"},
+			{"uuid": "284551234567012", "displayName": "Payroll Hosts", "className": "Cluster"},
+			// A group that contains itself isn't expanded again
+			{"uuid": "284551234567010", "displayName": "Payroll Servers", "className": "Group"},
+		}},
+		{"uuid": "284551234567011", "displayName": "Payroll Web", "className": "Group", "members": []map[string]interface{}{
+			{"uuid": "v2", "displayName": "payroll-web01", "className": "VirtualMachine"},
+			// Also directly in Payroll Servers
+			{"uuid": "v1", "displayName": "payroll-db01", "className": "VirtualMachine"},
+		}},
+		{"uuid": "284551234567012", "displayName": "Payroll Hosts", "className": "Cluster", "members": []map[string]interface{}{
+			{"uuid": "h1", "displayName": "esx01", "className": "PhysicalMachine"},
+		}},
+	}
+	turbo_instance := startFakeTurboGroups(t, groups)
+	want := []statsEntity{
+		{uuid: "v1", name: "payroll-db01", className: "VirtualMachine"},
+		{uuid: "v2", name: "payroll-web01", className: "VirtualMachine"},
+		{uuid: "h1", name: "esx01", className: "PhysicalMachine"},
+	}
+	for _, group := range []string{"Payroll Servers", "284551234567010"} {
+		entities, err := getStatsGroupEntities(turbo_instance, "", group)
+		if err != nil {
+			t.Fatalf("%s: %v", group, err)
+		}
+		if !reflect.DeepEqual(entities, want) {
+			t.Errorf("%s: got %+v, want %+v", group, entities, want)
+		}
+	}
+}